@@ -0,0 +1,255 @@
+package websocket_manager
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+// tokenExpiredCloseMessage is sent to the client when the token of its Session expires.
+var tokenExpiredCloseMessage = CloseMessage(websocket.ClosePolicyViolation, "Token expired.")
+
+// JWTAuthenticator authenticates websocket requests with a bearer JWT before they are upgraded.
+// Supports the HS256, RS256 and EdDSA algorithms.
+type JWTAuthenticator struct {
+	// Key returns the key that verifies tokens signed with alg and identified by kid (which may be empty).
+	// It must return a []byte for HS256, an *rsa.PublicKey for RS256 and an ed25519.PublicKey for EdDSA.
+	Key func(alg, kid string) (any, error)
+	// Refresh extracts a new token from an inbound message, reporting false if the message is not a refresh request.
+	// Refresh requests are not passed to the Socket, a valid token for the same subject extends the Session.
+	// If nil, tokens cannot be refreshed without reconnecting. See JSONRefresh.
+	Refresh func(payload []byte) (token string, ok bool)
+	// Header The request header holding the token as "Bearer <token>".
+	Header string
+	// QueryParam The query parameter holding the token.
+	QueryParam string
+	// Subprotocol The subprotocol that announces the token, the client offers it followed by the token as the next subprotocol.
+	// The Subprotocol is selected through the Session.ResponseHeader, therefore the Upgrader must not set Subprotocols.
+	Subprotocol string
+	// Issuer If set, the "iss" claim must match it.
+	Issuer string
+	// Audience If set, the "aud" claim must contain it.
+	Audience string
+	// Leeway How much clock skew to tolerate when validating the "exp" and "nbf" claims.
+	Leeway time.Duration
+	// Clock The source of time to validate the "exp" and "nbf" claims of the requests. If nil, the RealClock is used.
+	// The tokens refreshed by a Session are validated with the Config.Clock of its connection, which also schedules its expiry.
+	Clock Clock
+}
+
+// Authenticate extracts and validates the token of the request, it must be called before the connection is upgraded.
+// The token is looked up in the Header, QueryParam and Subprotocol in that order; if none is set, the Authorization header is used.
+// Returns ErrAuthTokenMissing if the request carries no token.
+// Returns ErrAuthTokenInvalid if the token is malformed, badly signed or fails the Issuer and Audience checks.
+// Returns ErrAuthTokenExpired if the token is expired or not yet valid.
+func (a *JWTAuthenticator) Authenticate(r *http.Request) (*Session, error) {
+	token, subprotocol := a.tokenFromRequest(r)
+	if token == "" {
+		return nil, ErrAuthTokenMissing
+	}
+
+	clock := a.Clock
+	if clock == nil {
+		clock = realClock{}
+	}
+	claims, err := a.validate(token, clock.Now())
+	if err != nil {
+		return nil, err
+	}
+
+	return &Session{
+		authenticator: a,
+		claims:        claims,
+		subprotocol:   subprotocol,
+	}, nil
+}
+
+// Middleware rejects requests that fail Authenticate with http.StatusUnauthorized and stores the Session of the others in their context.
+// Use SessionFromContext to retrieve it.
+func (a *JWTAuthenticator) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		session, err := a.Authenticate(r)
+		if err != nil {
+			http.Error(w, http.StatusText(http.StatusUnauthorized), http.StatusUnauthorized)
+			return
+		}
+
+		next.ServeHTTP(w, r.WithContext(contextWithSession(r.Context(), session)))
+	})
+}
+
+func (a *JWTAuthenticator) tokenFromRequest(r *http.Request) (token string, subprotocol string) {
+	header := a.Header
+	if a.Header == "" && a.QueryParam == "" && a.Subprotocol == "" {
+		header = "Authorization"
+	}
+
+	if header != "" {
+		if val, ok := strings.CutPrefix(r.Header.Get(header), "Bearer "); ok {
+			return strings.TrimSpace(val), ""
+		}
+	}
+	if a.QueryParam != "" {
+		if val := r.URL.Query().Get(a.QueryParam); val != "" {
+			return val, ""
+		}
+	}
+	if a.Subprotocol != "" {
+		protocols := websocket.Subprotocols(r)
+		for i := 0; i < len(protocols)-1; i++ {
+			if protocols[i] == a.Subprotocol {
+				return protocols[i+1], a.Subprotocol
+			}
+		}
+	}
+
+	return "", ""
+}
+
+// validate checks token at the time now.
+func (a *JWTAuthenticator) validate(token string, now time.Time) (Claims, error) {
+	claims, err := parseJWT(token, a.Key)
+	if err != nil {
+		return nil, err
+	}
+
+	if exp, ok := claims.ExpiresAt(); ok && !now.Before(exp.Add(a.Leeway)) {
+		return nil, fmt.Errorf("%w: expired at %s", ErrAuthTokenExpired, exp)
+	}
+	if nbf, ok := claims.NotBefore(); ok && now.Add(a.Leeway).Before(nbf) {
+		return nil, fmt.Errorf("%w: not valid before %s", ErrAuthTokenExpired, nbf)
+	}
+	if a.Issuer != "" && claims.Issuer() != a.Issuer {
+		return nil, fmt.Errorf("%w: unexpected issuer %q", ErrAuthTokenInvalid, claims.Issuer())
+	}
+	if a.Audience != "" && !claims.HasAudience(a.Audience) {
+		return nil, fmt.Errorf("%w: audience %q not allowed", ErrAuthTokenInvalid, a.Audience)
+	}
+
+	return claims, nil
+}
+
+// JSONRefresh returns a JWTAuthenticator.Refresh function that accepts messages like {"type":"<messageType>","token":"<token>"}.
+func JSONRefresh(messageType string) func(payload []byte) (string, bool) {
+	return func(payload []byte) (string, bool) {
+		var req struct {
+			Type  string `json:"type"`
+			Token string `json:"token"`
+		}
+		if err := json.Unmarshal(payload, &req); err != nil || req.Type != messageType || req.Token == "" {
+			return "", false
+		}
+
+		return req.Token, true
+	}
+}
+
+// Session is an authenticated connection, it closes the connection with gorilla/websocket.ClosePolicyViolation once its token expires.
+type Session struct {
+	authenticator *JWTAuthenticator
+	claims        Claims
+	conn          *Conn
+	// clock is the Config.Clock of the connection, it is set once the Session is attached.
+	clock       Clock
+	timer       Timer
+	subprotocol string
+	mu          sync.Mutex
+}
+
+// Claims returns the claims of the latest valid token of the Session.
+func (s *Session) Claims() Claims {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.claims
+}
+
+// ExpiresAt returns when the Session expires, reports false if its token does not expire.
+func (s *Session) ExpiresAt() (time.Time, bool) {
+	return s.Claims().ExpiresAt()
+}
+
+// ResponseHeader returns the header to pass to gorilla/websocket.Upgrader.Upgrade, it selects the JWTAuthenticator.Subprotocol if the token was sent through it.
+func (s *Session) ResponseHeader() http.Header {
+	if s.subprotocol == "" {
+		return nil
+	}
+
+	return http.Header{"Sec-Websocket-Protocol": {s.subprotocol}}
+}
+
+// Socket wraps socket so that the connection is closed when the Session expires, and refresh requests extend it.
+func (s *Session) Socket(socket Socket) Socket {
+	return &socketWrapper{Socket: socket, attach: s.attach, filter: s.handleRefresh, detach: func(*Conn) { s.detach() }}
+}
+
+// attach schedules the close of conn at the expiry of the Session.
+func (s *Session) attach(conn *Conn) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.conn = conn
+	s.clock = conn.w.clock
+	s.scheduleExpiry()
+}
+
+// scheduleExpiry (re)schedules the close of the connection, it must be called with the mutex held.
+func (s *Session) scheduleExpiry() {
+	if s.timer != nil {
+		s.timer.Stop()
+		s.timer = nil
+	}
+
+	exp, ok := s.claims.ExpiresAt()
+	if !ok || s.conn == nil {
+		return
+	}
+
+	conn := s.conn
+	s.timer = s.clock.AfterFunc(exp.Add(s.authenticator.Leeway).Sub(s.clock.Now()), func() {
+		_ = conn.closeWithReason(tokenExpiredCloseMessage, ErrAuthTokenExpired)
+	})
+}
+
+// refresh replaces the claims of the Session with those of token, which must be valid and belong to the same subject.
+func (s *Session) refresh(token string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	claims, err := s.authenticator.validate(token, s.clock.Now())
+	if err != nil {
+		return err
+	}
+	if claims.Subject() != s.claims.Subject() {
+		return fmt.Errorf("%w: subject %q does not match the session", ErrAuthTokenInvalid, claims.Subject())
+	}
+
+	s.claims = claims
+	s.scheduleExpiry()
+	return nil
+}
+
+func (s *Session) detach() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.timer != nil {
+		s.timer.Stop()
+		s.timer = nil
+	}
+}
+
+// handleRefresh is the messageFilter of the refresh requests.
+func (s *Session) handleRefresh(payload []byte, _ func([]byte)) bool {
+	if s.authenticator.Refresh == nil {
+		return false
+	}
+	token, ok := s.authenticator.Refresh(payload)
+	if !ok {
+		return false
+	}
+
+	_ = s.refresh(token) // A rejected refresh keeps the current expiry.
+	return true
+}
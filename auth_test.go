@@ -0,0 +1,185 @@
+package websocket_manager
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+func TestJWTAuthenticatorValidate(t *testing.T) {
+	secret := []byte("secret")
+	now := time.Unix(100_000, 0)
+	key := func(string, string) (any, error) { return secret, nil }
+
+	tests := []struct {
+		name    string
+		auth    JWTAuthenticator
+		claims  map[string]any
+		wantErr error
+	}{
+		{"no time claims", JWTAuthenticator{}, map[string]any{}, nil},
+		{"not expired", JWTAuthenticator{}, map[string]any{"exp": now.Unix() + 1}, nil},
+		{"expired", JWTAuthenticator{}, map[string]any{"exp": now.Unix()}, ErrAuthTokenExpired},
+		{"expired within the leeway", JWTAuthenticator{Leeway: time.Minute}, map[string]any{"exp": now.Unix() - 59}, nil},
+		{"expired beyond the leeway", JWTAuthenticator{Leeway: time.Minute}, map[string]any{"exp": now.Unix() - 60}, ErrAuthTokenExpired},
+		{"valid from now", JWTAuthenticator{}, map[string]any{"nbf": now.Unix()}, nil},
+		{"not valid yet", JWTAuthenticator{}, map[string]any{"nbf": now.Unix() + 1}, ErrAuthTokenExpired},
+		{"not valid yet within the leeway", JWTAuthenticator{Leeway: time.Minute}, map[string]any{"nbf": now.Unix() + 60}, nil},
+		{"not valid yet beyond the leeway", JWTAuthenticator{Leeway: time.Minute}, map[string]any{"nbf": now.Unix() + 61}, ErrAuthTokenExpired},
+		{"issuer", JWTAuthenticator{Issuer: "auth"}, map[string]any{"iss": "auth"}, nil},
+		{"other issuer", JWTAuthenticator{Issuer: "auth"}, map[string]any{"iss": "other"}, ErrAuthTokenInvalid},
+		{"no issuer", JWTAuthenticator{Issuer: "auth"}, map[string]any{}, ErrAuthTokenInvalid},
+		{"audience", JWTAuthenticator{Audience: "api"}, map[string]any{"aud": "api"}, nil},
+		{"audience in a list", JWTAuthenticator{Audience: "api"}, map[string]any{"aud": []string{"web", "api"}}, nil},
+		{"other audience", JWTAuthenticator{Audience: "api"}, map[string]any{"aud": []string{"web"}}, ErrAuthTokenInvalid},
+		{"no audience", JWTAuthenticator{Audience: "api"}, map[string]any{}, ErrAuthTokenInvalid},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			tc.auth.Key = key
+			_, err := tc.auth.validate(signJWT(t, JWTAlgorithmHS256, secret, tc.claims), now)
+			if !errors.Is(err, tc.wantErr) || (err != nil) != (tc.wantErr != nil) {
+				t.Fatalf("validate = %v, want %v", err, tc.wantErr)
+			}
+		})
+	}
+}
+
+// The token is looked up in the header, the query parameter and the subprotocol in that order.
+func TestJWTAuthenticatorTokenFromRequest(t *testing.T) {
+	all := JWTAuthenticator{Header: "X-Token", QueryParam: "token", Subprotocol: "jwt"}
+	tests := []struct {
+		name            string
+		auth            JWTAuthenticator
+		header          map[string]string
+		query           string
+		wantToken       string
+		wantSubprotocol string
+	}{
+		{
+			name:      "header first",
+			auth:      all,
+			header:    map[string]string{"X-Token": "Bearer header", "Sec-WebSocket-Protocol": "jwt, protocol"},
+			query:     "?token=query",
+			wantToken: "header",
+		},
+		{
+			name:      "query before the subprotocol",
+			auth:      all,
+			header:    map[string]string{"Sec-WebSocket-Protocol": "jwt, protocol"},
+			query:     "?token=query",
+			wantToken: "query",
+		},
+		{
+			name:            "subprotocol",
+			auth:            all,
+			header:          map[string]string{"Sec-WebSocket-Protocol": "chat, jwt, protocol"},
+			wantToken:       "protocol",
+			wantSubprotocol: "jwt",
+		},
+		{
+			name:   "header without the bearer prefix",
+			auth:   all,
+			header: map[string]string{"X-Token": "header"},
+		},
+		{
+			name:   "subprotocol without a token",
+			auth:   all,
+			header: map[string]string{"Sec-WebSocket-Protocol": "chat, jwt"},
+		},
+		{
+			name:      "Authorization by default",
+			header:    map[string]string{"Authorization": "Bearer default"},
+			wantToken: "default",
+		},
+		{
+			name:   "no Authorization once a source is set",
+			auth:   JWTAuthenticator{QueryParam: "token"},
+			header: map[string]string{"Authorization": "Bearer default"},
+		},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			r := httptest.NewRequest("GET", "/"+tc.query, nil)
+			for name, val := range tc.header {
+				r.Header.Set(name, val)
+			}
+
+			token, subprotocol := tc.auth.tokenFromRequest(r)
+			if token != tc.wantToken || subprotocol != tc.wantSubprotocol {
+				t.Fatalf("tokenFromRequest = %q, %q; want %q, %q", token, subprotocol, tc.wantToken, tc.wantSubprotocol)
+			}
+		})
+	}
+}
+
+// A refresh only extends the Session with a token of the same subject, the connection is closed once the Session expires.
+func TestSessionRefresh(t *testing.T) {
+	secret := []byte("secret")
+	clock := NewFakeClock(time.Unix(100_000, 0))
+	auth := &JWTAuthenticator{
+		Key:     func(string, string) (any, error) { return secret, nil },
+		Refresh: JSONRefresh("refresh"),
+		Clock:   clock,
+	}
+	token := func(sub string, ttl time.Duration) string {
+		return signJWT(t, JWTAlgorithmHS256, secret, map[string]any{"sub": sub, "exp": clock.Now().Add(ttl).Unix()})
+	}
+	refresh := func(client *websocket.Conn, token string) {
+		payload, _ := json.Marshal(map[string]string{"type": "refresh", "token": token})
+		if err := client.WriteMessage(websocket.TextMessage, payload); err != nil {
+			t.Fatalf("write: %v", err)
+		}
+	}
+
+	r := httptest.NewRequest("GET", "/", nil)
+	r.Header.Set("Authorization", "Bearer "+token("alice", time.Minute))
+	session, err := auth.Authenticate(r)
+	if err != nil {
+		t.Fatalf("Authenticate: %v", err)
+	}
+	socket := newTestSocket()
+	conn, client := startTest(t, &Config{Clock: clock, GracePeriod: time.Minute, CloseFrames: DefaultCloseFrames()}, session.Socket(socket))
+	clock.BlockUntil(1)
+
+	refresh(client, token("bob", time.Hour))
+	refresh(client, token("alice", time.Hour))
+	want := clock.Now().Add(time.Hour).Truncate(time.Second)
+	for deadline := time.Now().Add(testTimeout); ; time.Sleep(time.Millisecond) {
+		if exp, _ := session.ExpiresAt(); exp.Equal(want) {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("the refresh of alice was not applied")
+		}
+	}
+	if sub := session.Claims().Subject(); sub != "alice" {
+		t.Fatalf("subject %q after the refresh of bob, want alice", sub)
+	}
+	select {
+	case payload := <-socket.messages:
+		t.Fatalf("refresh request %q handed over to the Socket", payload)
+	default:
+	}
+
+	read := readAll(client)
+	clock.Advance(time.Minute)
+	select {
+	case <-conn.Done():
+		t.Fatalf("closed at the expiry of the first token: %v", conn.Err())
+	case <-time.After(10 * time.Millisecond):
+	}
+
+	clock.Advance(time.Hour)
+	if err := waitClosed(t, conn); !errors.Is(err, ErrAuthTokenExpired) {
+		t.Fatalf("Err() = %v, want ErrAuthTokenExpired", err)
+	}
+	var closeErr *websocket.CloseError
+	if err := receive(t, read); !errors.As(err, &closeErr) || closeErr.Code != websocket.ClosePolicyViolation {
+		t.Fatalf("client read %v, want a close message with code %d", err, websocket.ClosePolicyViolation)
+	}
+}
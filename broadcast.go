@@ -0,0 +1,164 @@
+package websocket_manager
+
+import (
+	"context"
+	"errors"
+	"runtime"
+	"sync"
+	"sync/atomic"
+
+	"github.com/gorilla/websocket"
+)
+
+// broadcastChunkSize is the count of connections a broadcast worker takes at once.
+const broadcastChunkSize = 64
+
+// OverflowPolicy decides what happens to a connection whose send queue is full when a broadcast reaches it.
+type OverflowPolicy int
+
+const (
+	// OverflowDrop skips the connection, it misses the message but keeps running.
+	OverflowDrop OverflowPolicy = iota
+	// OverflowClose starts the close handshake of the connection with Broadcaster.OverflowCloseMessage.
+	// Conn.Err reports ErrSendQueueOverflow alongside the outcome of the close handshake.
+	OverflowClose
+)
+
+// Broadcaster fans a message out to many connections in parallel, without ever waiting on a single slow connection.
+// Messages are queued with Conn.TrySend, the OverflowPolicy applies to the connections whose send queue is full.
+// With the default Config.SendQueueSize of 0 there is no queue, TrySend only succeeds while the writer of the connection is idle,
+// so under load almost every message overflows. Set a SendQueueSize matching the bursts the connections must absorb.
+// The same Broadcaster can be used for concurrent broadcasts.
+type Broadcaster struct {
+	// Workers How many goroutines queue the message of a broadcast. If 0, runtime.GOMAXPROCS is used.
+	Workers int
+	// Overflow What to do with the connections whose send queue is full.
+	Overflow OverflowPolicy
+	// OverflowCloseMessage The close message sent to the connections closed by OverflowClose.
+	// If nil, a close message with gorilla/websocket.CloseTryAgainLater is used.
+	OverflowCloseMessage Message
+}
+
+// BroadcastResult counts what happened to the connections of a broadcast.
+type BroadcastResult struct {
+	// Queued How many connections accepted the message in their send queue.
+	Queued int
+	// Dropped How many connections missed the message because their send queue was full.
+	Dropped int
+	// Closed How many connections were closed because their send queue was full, each connection is closed by a single broadcast.
+	Closed int
+	// Unavailable How many connections were already closing or closed.
+	Unavailable int
+}
+
+// Broadcast queues msg to every connection of conns.
+// msg is shared by all of them, messages created by TextMessage or BinaryMessage are prepared once regardless of the count of connections.
+// If ctx is done, the connections that were not reached yet are left out of the result.
+// Returns ctx.Err() if ctx is done before every connection is reached.
+func (b *Broadcaster) Broadcast(ctx context.Context, msg Message, conns []*Conn) (BroadcastResult, error) {
+	workers := b.workers()
+	if chunks := (len(conns) + broadcastChunkSize - 1) / broadcastChunkSize; chunks < workers {
+		workers = chunks
+	}
+
+	var (
+		next    atomic.Int64
+		total   broadcastCounters
+		wg      sync.WaitGroup
+		ctxDone = ctx.Done()
+	)
+	for range workers {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			var counters broadcastCounters
+			defer total.add(&counters)
+
+			for {
+				select {
+				case <-ctxDone:
+					return
+				default:
+				}
+
+				end := int(next.Add(broadcastChunkSize))
+				start := end - broadcastChunkSize
+				if start >= len(conns) {
+					return
+				}
+				for _, conn := range conns[start:min(end, len(conns))] {
+					b.send(conn, msg, &counters)
+				}
+			}
+		}()
+	}
+	wg.Wait()
+
+	return total.result(), ctx.Err()
+}
+
+func (b *Broadcaster) send(conn *Conn, msg Message, counters *broadcastCounters) {
+	switch err := conn.TrySend(msg); {
+	case err == nil:
+		counters.queued++
+	case errors.Is(err, ErrConnectionClosed):
+		counters.unavailable++
+	default:
+		if b.Overflow == OverflowClose {
+			// The worker may be stuck writing to the connection, so the close request is queued without waiting for it.
+			// Only the first overflow closes the connection, the later broadcasts find it closing.
+			// A connection that already has a close request pending is closing for another reason.
+			if conn.w.overflowClosed.CompareAndSwap(false, true) && conn.tryCloseWithReason(b.overflowCloseMessage(), ErrSendQueueOverflow) {
+				counters.closed++
+			} else {
+				counters.unavailable++
+			}
+			return
+		}
+		counters.dropped++
+	}
+}
+
+func (b *Broadcaster) workers() int {
+	if b.Workers > 0 {
+		return b.Workers
+	}
+
+	return runtime.GOMAXPROCS(0)
+}
+
+func (b *Broadcaster) overflowCloseMessage() Message {
+	if b.OverflowCloseMessage != nil {
+		return b.OverflowCloseMessage
+	}
+
+	return CloseMessage(websocket.CloseTryAgainLater, "Too slow.")
+}
+
+type broadcastCounters struct {
+	mu          sync.Mutex
+	queued      int
+	dropped     int
+	closed      int
+	unavailable int
+}
+
+func (c *broadcastCounters) add(other *broadcastCounters) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.queued += other.queued
+	c.dropped += other.dropped
+	c.closed += other.closed
+	c.unavailable += other.unavailable
+}
+
+func (c *broadcastCounters) result() BroadcastResult {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return BroadcastResult{
+		Queued:      c.queued,
+		Dropped:     c.dropped,
+		Closed:      c.closed,
+		Unavailable: c.unavailable,
+	}
+}
@@ -0,0 +1,153 @@
+package websocket_manager
+
+import (
+	"context"
+	"runtime"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+// stall fills the connection toward a client that does not read, until its writer is stuck writing.
+func stall(t testing.TB, conn *Conn) {
+	t.Helper()
+
+	large := TextMessage(strings.Repeat("x", 1<<20))
+	go func() {
+		for conn.Send(large) == nil {
+		}
+	}()
+
+	deadline := time.Now().Add(testTimeout)
+	for busy := 0; busy < 50; {
+		if time.Now().After(deadline) {
+			t.Fatal("the writer did not stall")
+		}
+		if conn.TrySend(TextMessage("probe")) == nil {
+			busy = 0
+		} else {
+			busy++
+		}
+		time.Sleep(2 * time.Millisecond)
+	}
+}
+
+func TestBroadcasterOverflow(t *testing.T) {
+	const broadcasts = 200
+
+	tests := []struct {
+		name   string
+		policy OverflowPolicy
+		want   BroadcastResult
+	}{
+		{"drop", OverflowDrop, BroadcastResult{Dropped: broadcasts}},
+		{"close", OverflowClose, BroadcastResult{Closed: 1, Unavailable: broadcasts - 1}},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			conn, _ := startTest(t, &Config{GracePeriod: time.Second}, newTestSocket())
+			stall(t, conn)
+
+			b := &Broadcaster{Overflow: tc.policy}
+			goroutines := runtime.NumGoroutine()
+			var got BroadcastResult
+			for range broadcasts {
+				result, err := b.Broadcast(context.Background(), TextMessage("news"), []*Conn{conn})
+				if err != nil {
+					t.Fatalf("Broadcast: %v", err)
+				}
+				got.Queued += result.Queued
+				got.Dropped += result.Dropped
+				got.Closed += result.Closed
+				got.Unavailable += result.Unavailable
+			}
+
+			if got != tc.want {
+				t.Fatalf("results add up to %+v, want %+v", got, tc.want)
+			}
+			if leaked := runtime.NumGoroutine() - goroutines; leaked > 0 {
+				t.Fatalf("%d goroutines left behind by the broadcasts", leaked)
+			}
+		})
+	}
+}
+
+// A stalled connection that already has a close request pending is not counted as closed by the broadcast.
+func TestBroadcasterOverflowWhileClosing(t *testing.T) {
+	conn, _ := startTest(t, &Config{GracePeriod: time.Second}, newTestSocket())
+	stall(t, conn)
+	if !conn.tryCloseWithReason(CloseMessage(websocket.CloseGoingAway, ""), nil) {
+		t.Fatal("the close request was not queued")
+	}
+
+	result, err := (&Broadcaster{Overflow: OverflowClose}).Broadcast(context.Background(), TextMessage("news"), []*Conn{conn})
+	if err != nil {
+		t.Fatalf("Broadcast: %v", err)
+	}
+	if want := (BroadcastResult{Unavailable: 1}); result != want {
+		t.Fatalf("Broadcast = %+v, want %+v", result, want)
+	}
+}
+
+func TestBroadcasterQueues(t *testing.T) {
+	const count = 100
+
+	conns := make([]*Conn, count)
+	reads := make([]<-chan error, count)
+	for i := range conns {
+		conn, client := startTest(t, &Config{GracePeriod: time.Second, SendQueueSize: 4}, newTestSocket())
+		conns[i] = conn
+		reads[i] = readAll(client)
+	}
+
+	result, err := (&Broadcaster{Workers: 4}).Broadcast(context.Background(), TextMessage("news"), conns)
+	if err != nil {
+		t.Fatalf("Broadcast: %v", err)
+	}
+	if result != (BroadcastResult{Queued: count}) {
+		t.Fatalf("Broadcast = %+v, want every connection queued", result)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := (&Broadcaster{}).Broadcast(ctx, TextMessage("late"), conns); err != context.Canceled {
+		t.Fatalf("Broadcast with a done context = %v, want context.Canceled", err)
+	}
+}
+
+// BenchmarkBroadcasterOverflowClose broadcasts to a stalled connection with OverflowClose.
+func BenchmarkBroadcasterOverflowClose(b *testing.B) {
+	conn, _ := startTest(b, &Config{GracePeriod: time.Second}, newTestSocket())
+	stall(b, conn)
+
+	broadcaster := &Broadcaster{Workers: 1, Overflow: OverflowClose}
+	conns := []*Conn{conn}
+	msg := TextMessage("news")
+	b.ReportAllocs()
+	b.ResetTimer()
+	for range b.N {
+		_, _ = broadcaster.Broadcast(context.Background(), msg, conns)
+	}
+}
+
+// BenchmarkBroadcaster broadcasts to connections whose clients keep up.
+func BenchmarkBroadcaster(b *testing.B) {
+	const count = 256
+
+	conns := make([]*Conn, count)
+	for i := range conns {
+		conn, client := startTest(b, &Config{GracePeriod: time.Second, SendQueueSize: 64}, newTestSocket())
+		conns[i] = conn
+		readAll(client)
+	}
+
+	broadcaster := &Broadcaster{}
+	msg := TextMessage(strings.Repeat("x", 128))
+	b.ReportAllocs()
+	b.ResetTimer()
+	for range b.N {
+		_, _ = broadcaster.Broadcast(context.Background(), msg, conns)
+	}
+}
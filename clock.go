@@ -0,0 +1,94 @@
+package websocket_manager
+
+import (
+	"time"
+)
+
+// Clock is the source of time of the worker, for its tickers, timers, and the timestamps of its Stats.
+// Write timeouts are enforced by the network connection and keep using the real time.
+// See NewFakeClock to control it in tests.
+type Clock interface {
+	Now() time.Time
+	NewTimer(d time.Duration) Timer
+	NewTicker(d time.Duration) Ticker
+	// AfterFunc calls f in its own goroutine once d elapsed, unless the returned Timer is stopped before.
+	AfterFunc(d time.Duration, f func()) Timer
+}
+
+// Timer behaves like a time.Timer, no stale value is received from C after Stop or Reset returns.
+type Timer interface {
+	// C returns the channel the time is delivered on, it is nil for the timers of Clock.AfterFunc.
+	C() <-chan time.Time
+	Stop() bool
+	Reset(d time.Duration) bool
+}
+
+// Ticker behaves like a time.Ticker.
+type Ticker interface {
+	C() <-chan time.Time
+	Stop()
+	Reset(d time.Duration)
+}
+
+// RealClock returns the Clock of the real time, it is used when Config.Clock is nil.
+func RealClock() Clock {
+	return realClock{}
+}
+
+func (c *Config) clock() Clock {
+	if c.Clock == nil {
+		return realClock{}
+	}
+
+	return c.Clock
+}
+
+type realClock struct{}
+
+func (realClock) Now() time.Time {
+	return time.Now()
+}
+
+func (realClock) NewTimer(d time.Duration) Timer {
+	return realTimer{t: time.NewTimer(d)}
+}
+
+func (realClock) NewTicker(d time.Duration) Ticker {
+	return realTicker{t: time.NewTicker(d)}
+}
+
+func (realClock) AfterFunc(d time.Duration, f func()) Timer {
+	return realTimer{t: time.AfterFunc(d, f)}
+}
+
+type realTimer struct {
+	t *time.Timer
+}
+
+func (t realTimer) C() <-chan time.Time {
+	return t.t.C
+}
+
+func (t realTimer) Stop() bool {
+	return t.t.Stop()
+}
+
+func (t realTimer) Reset(d time.Duration) bool {
+	return t.t.Reset(d)
+}
+
+type realTicker struct {
+	t *time.Ticker
+}
+
+func (t realTicker) C() <-chan time.Time {
+	return t.t.C
+}
+
+func (t realTicker) Stop() {
+	t.t.Stop()
+}
+
+func (t realTicker) Reset(d time.Duration) {
+	t.t.Reset(d)
+}
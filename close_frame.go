@@ -0,0 +1,25 @@
+package websocket_manager
+
+import (
+	"github.com/gorilla/websocket"
+)
+
+// CloseFrame describes the close frame that is written to the client when the worker stops because of Err.
+// Check valid status codes at https://pkg.go.dev/github.com/gorilla/websocket#pkg-constants.
+type CloseFrame struct {
+	// Err is matched against the cause of the teardown using errors.Is.
+	Err  error
+	Text string
+	Code int
+}
+
+// DefaultCloseFrames returns a mapping suitable for Config.CloseFrames.
+// Protocol errors and read limit violations are not part of it, since gorilla/websocket already answers them with a close frame of its own.
+func DefaultCloseFrames() []CloseFrame {
+	return []CloseFrame{
+		{Err: ErrWriterChannelClosed, Code: websocket.CloseGoingAway, Text: "Going away."},
+		{Err: ErrPongTimeoutExceeded, Code: websocket.CloseGoingAway, Text: "Pong timeout exceeded."},
+		{Err: ErrHeartbeatTimeoutExceeded, Code: websocket.CloseGoingAway, Text: "Heartbeat timeout exceeded."},
+		{Err: ErrNetpollClosed, Code: websocket.CloseGoingAway, Text: "Going away."},
+	}
+}
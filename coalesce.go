@@ -0,0 +1,228 @@
+package websocket_manager
+
+import (
+	"encoding/binary"
+	"fmt"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+const (
+	defaultCoalescingMaxMessages = 64
+	defaultCoalescingMaxBytes    = 64 * 1024
+)
+
+// Coalescing configures the batching of messages that are ready to be written together into a single write to the network.
+// Only messages created by TextMessage, BinaryMessage and PingMessage are batched, the others are written on their own.
+// Batched frames are never compressed nor masked, therefore it must only be enabled on server side connections.
+type Coalescing struct {
+	// MaxMessages How many messages a batch holds at most. If 0, 64 is used.
+	MaxMessages int
+	// MaxBytes How many payload bytes a batch holds at most, larger messages are written on their own. If 0, 64KiB is used.
+	MaxBytes int
+	// MaxDelay How long to wait for more messages before writing a batch that is not full.
+	// If 0, only the messages that are already waiting get batched, which adds no latency.
+	MaxDelay time.Duration
+}
+
+func (c *Coalescing) maxMessages() int {
+	if c.MaxMessages == 0 {
+		return defaultCoalescingMaxMessages
+	}
+
+	return c.MaxMessages
+}
+
+func (c *Coalescing) maxBytes() int {
+	if c.MaxBytes == 0 {
+		return defaultCoalescingMaxBytes
+	}
+
+	return c.MaxBytes
+}
+
+// batch collects the frames of the messages to write in a single write, it is only used by the writer goroutine.
+type batch struct {
+	conf *Coalescing
+	// buf holds the frames, it is borrowed from the Buffer pool while the batch is not empty so that idle connections hold no buffer.
+	buf    []byte
+	pooled *Buffer
+	sizes  []int
+	// msgs are the batched messages, their deliveries are reported once the batch is flushed.
+	msgs  []Message
+	bytes int
+}
+
+func newBatch(conf *Coalescing) *batch {
+	if conf == nil {
+		conf = &Coalescing{}
+	}
+
+	return &batch{conf: conf}
+}
+
+// batchPayload returns the type and payload of msg if it can be batched.
+func batchPayload(msg Message) (int, []byte, bool) {
+	raw, ok := messageAs[interface{ payload() (int, []byte) }](msg)
+	if !ok {
+		return 0, nil, false
+	}
+
+	typ, data := raw.payload()
+	if typ != websocket.TextMessage && typ != websocket.BinaryMessage && typ != websocket.PingMessage {
+		return 0, nil, false
+	}
+	if typ == websocket.PingMessage && len(data) > maxControlPayload {
+		return 0, nil, false // Written on its own, the websocket.Conn rejects it.
+	}
+
+	return typ, data, true
+}
+
+func (b *batch) empty() bool {
+	return len(b.sizes) == 0
+}
+
+func (b *batch) full() bool {
+	return len(b.sizes) >= b.conf.maxMessages()
+}
+
+// fits reports whether a payload of size fits in the batch.
+func (b *batch) fits(size int) bool {
+	return !b.full() && b.bytes+size <= b.conf.maxBytes()
+}
+
+// add encodes an unmasked frame holding the whole payload of msg.
+func (b *batch) add(msg Message, typ int, payload []byte) {
+	if b.pooled == nil {
+		b.pooled = getBuffer()
+		b.buf = b.pooled.data[:0]
+	}
+	b.buf = append(b.buf, 0x80|byte(typ)) // FIN bit and opcode.
+	switch size := len(payload); {
+	case size < 126:
+		b.buf = append(b.buf, byte(size))
+	case size <= 0xffff:
+		b.buf = append(b.buf, 126)
+		b.buf = binary.BigEndian.AppendUint16(b.buf, uint16(size))
+	default:
+		b.buf = append(b.buf, 127)
+		b.buf = binary.BigEndian.AppendUint64(b.buf, uint64(size))
+	}
+	b.buf = append(b.buf, payload...)
+	b.sizes = append(b.sizes, len(payload))
+	b.msgs = append(b.msgs, msg)
+	b.bytes += len(payload)
+}
+
+// deliver reports the outcome of the write of the batch to the delivery callbacks of its messages.
+func (b *batch) deliver(err error) {
+	for _, msg := range b.msgs {
+		deliver(msg, err)
+	}
+}
+
+func (b *batch) reset() {
+	if b.pooled != nil {
+		b.pooled.data = b.buf
+		b.pooled.Release()
+		b.pooled, b.buf = nil, nil
+	}
+	b.sizes = b.sizes[:0]
+	clear(b.msgs)
+	b.msgs = b.msgs[:0]
+	b.bytes = 0
+}
+
+// writeBatch adds first to the pending batch along with the batchable messages that follow it in the outbox.
+// A full batch is written right away, the last one is written once nothing is left to add.
+// With a Coalescing.MaxDelay, a batch that is not full is kept for more messages until the delay counted from its first message is over,
+// the writer goes on meanwhile and writes it once its timer fires, see sendBatch.
+// It reports whether the writer should keep running.
+func (w *worker) writeBatch(s *writerState, first Message) bool {
+	for msg := first; msg != nil; msg = w.next(s) {
+		typ, payload, ok := batchPayload(msg)
+		if !ok {
+			return w.sendBatch(s) && w.write(msg)
+		}
+
+		if !w.batch.fits(len(payload)) {
+			if !w.sendBatch(s) {
+				return false
+			}
+			if !w.batch.fits(len(payload)) {
+				return w.write(msg)
+			}
+		}
+		w.batch.add(msg, typ, payload)
+		if w.batch.full() && !w.sendBatch(s) {
+			return false
+		}
+	}
+
+	if w.batch.empty() {
+		return true
+	}
+	maxDelay := s.conf.WriteCoalescing.MaxDelay
+	if maxDelay <= 0 {
+		return w.sendBatch(s)
+	}
+	if s.batchTimer == nil {
+		s.batchTimer = w.clock.NewTimer(maxDelay)
+		s.batchCh = s.batchTimer.C()
+	}
+
+	return true
+}
+
+// sendBatch stops the timer of the pending batch and writes it, it reports whether the writer should keep running.
+func (w *worker) sendBatch(s *writerState) bool {
+	w.stopBatchTimer(s)
+	return w.flushBatch()
+}
+
+func (w *worker) stopBatchTimer(s *writerState) {
+	if s.batchTimer != nil {
+		s.batchTimer.Stop()
+		s.batchTimer, s.batchCh = nil, nil
+	}
+}
+
+// flushBatch writes the pending batch, it reports whether the writer should keep running.
+func (w *worker) flushBatch() bool {
+	if w.batch.empty() {
+		return true
+	}
+	defer w.batch.reset()
+
+	// The batch bypasses the websocket.Conn, the write lock keeps it from following a close frame written by the reader, see writeClose.
+	w.writeLock <- struct{}{}
+	if w.closeSent || w.State() != StateOpen {
+		w.unlockWrites()
+		w.batch.deliver(ErrConnectionClosed)
+		return false
+	}
+
+	netConn := w.conn.NetConn()
+	if timeout := w.config().WriteTimeout; timeout > 0 {
+		_ = netConn.SetWriteDeadline(time.Now().Add(timeout))
+	} else {
+		_ = netConn.SetWriteDeadline(time.Time{})
+	}
+	_, err := netConn.Write(w.batch.buf)
+	w.unlockWrites()
+	if err != nil {
+		err = fmt.Errorf("%w: %w", ErrFailedToWrite, wrapWriteError(err))
+		w.batch.deliver(err)
+		w.Close(err, nil)
+		return false
+	}
+
+	for _, size := range w.batch.sizes {
+		w.stats.messageWritten(size)
+	}
+	w.batch.deliver(nil)
+
+	return true
+}
@@ -0,0 +1,235 @@
+package websocket_manager
+
+import (
+	"bufio"
+	"context"
+	"encoding/binary"
+	"errors"
+	"io"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+// readFrame reads a frame written by the server, which is never masked.
+func readFrame(r *bufio.Reader) (int, []byte, error) {
+	var header [2]byte
+	if _, err := io.ReadFull(r, header[:]); err != nil {
+		return 0, nil, err
+	}
+
+	size := uint64(header[1] & 0x7f)
+	switch size {
+	case 126:
+		var ext [2]byte
+		if _, err := io.ReadFull(r, ext[:]); err != nil {
+			return 0, nil, err
+		}
+		size = uint64(binary.BigEndian.Uint16(ext[:]))
+	case 127:
+		var ext [8]byte
+		if _, err := io.ReadFull(r, ext[:]); err != nil {
+			return 0, nil, err
+		}
+		size = binary.BigEndian.Uint64(ext[:])
+	}
+
+	payload := make([]byte, size)
+	_, err := io.ReadFull(r, payload)
+	return int(header[0] & 0x0f), payload, err
+}
+
+func TestCoalescingWritesInOrder(t *testing.T) {
+	tests := []struct {
+		name string
+		conf Coalescing
+	}{
+		{"defaults", Coalescing{}},
+		{"few messages", Coalescing{MaxMessages: 3}},
+		{"few bytes", Coalescing{MaxBytes: 10}},
+		{"delayed", Coalescing{MaxDelay: 5 * time.Millisecond}},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			conn, client := startTest(t, &Config{GracePeriod: time.Second, SendQueueSize: 32, WriteCoalescing: &tc.conf}, newTestSocket())
+
+			const count = 20
+			for i := range count {
+				msg := TextMessage(strings.Repeat("m", i))
+				if i%5 == 0 {
+					msg = BinaryMessage([]byte{byte(i)})
+				}
+				if err := conn.Send(msg); err != nil {
+					t.Fatalf("Send: %v", err)
+				}
+			}
+			for i := range count {
+				typ, payload, err := client.ReadMessage()
+				if err != nil {
+					t.Fatalf("read %d: %v", i, err)
+				}
+				if i%5 == 0 {
+					if typ != websocket.BinaryMessage || len(payload) != 1 || payload[0] != byte(i) {
+						t.Fatalf("message %d = %d %v, want binary [%d]", i, typ, payload, i)
+					}
+				} else if typ != websocket.TextMessage || len(payload) != i {
+					t.Fatalf("message %d = %d of %d bytes, want text of %d bytes", i, typ, len(payload), i)
+				}
+			}
+			if stats := conn.Stats(); stats.FramesWritten != count {
+				t.Fatalf("FramesWritten = %d, want %d", stats.FramesWritten, count)
+			}
+		})
+	}
+}
+
+// The batches are written straight to the network connection, none must follow the echo of the close message of the client.
+func TestCoalescingStopsAtCloseEcho(t *testing.T) {
+	for range 10 {
+		conn, client := startTest(t, &Config{GracePeriod: time.Second, SendQueueSize: 64, WriteCoalescing: &Coalescing{MaxMessages: 16}}, newTestSocket())
+		go func() {
+			for conn.Send(TextMessage(strings.Repeat("x", 100))) == nil {
+			}
+		}()
+
+		frames := bufio.NewReader(client.NetConn())
+		for range 50 {
+			if _, _, err := readFrame(frames); err != nil {
+				t.Fatalf("read: %v", err)
+			}
+		}
+		if err := client.WriteControl(websocket.CloseMessage, websocket.FormatCloseMessage(websocket.CloseNormalClosure, ""), time.Now().Add(testTimeout)); err != nil {
+			t.Fatalf("write close: %v", err)
+		}
+
+		closed := false
+		for {
+			opcode, _, err := readFrame(frames)
+			if err != nil {
+				break
+			}
+			if closed {
+				t.Fatalf("frame with opcode %d written after the close frame", opcode)
+			}
+			closed = opcode == websocket.CloseMessage
+		}
+		if !closed {
+			t.Fatal("the close frame was not echoed")
+		}
+		_ = waitClosed(t, conn)
+	}
+}
+
+func TestCoalescingRejectsLargePing(t *testing.T) {
+	conn, client := startTest(t, &Config{GracePeriod: time.Second, SendQueueSize: 8, WriteCoalescing: &Coalescing{}}, newTestSocket())
+	readAll(client)
+
+	if err := conn.SendAndWait(context.Background(), UnpreparedMessage(websocket.PingMessage, make([]byte, maxControlPayload+1))); !errors.Is(err, ErrFailedToWrite) {
+		t.Fatalf("SendAndWait of a ping of %d bytes = %v, want ErrFailedToWrite", maxControlPayload+1, err)
+	}
+	_ = waitClosed(t, conn)
+}
+
+// BenchmarkWriteCoalescing writes bursts of small messages, with and without coalescing.
+func BenchmarkWriteCoalescing(b *testing.B) {
+	const burst = 32
+
+	for _, tc := range []struct {
+		name string
+		conf *Coalescing
+	}{
+		{"off", nil},
+		{"on", &Coalescing{}},
+	} {
+		b.Run(tc.name, func(b *testing.B) {
+			conn, client := startTest(b, &Config{GracePeriod: time.Second, SendQueueSize: burst, WriteCoalescing: tc.conf}, newTestSocket())
+			frames := bufio.NewReaderSize(client.NetConn(), 64*1024)
+			go func() {
+				for {
+					if _, _, err := readFrame(frames); err != nil {
+						return
+					}
+				}
+			}()
+
+			msg := TextMessage(strings.Repeat("x", 64))
+			b.ReportAllocs()
+			b.ResetTimer()
+			for range b.N {
+				for range burst - 1 {
+					_ = conn.Send(msg)
+				}
+				_ = conn.SendAndWait(context.Background(), msg)
+			}
+		})
+	}
+}
+
+// A batch that is not full waits for more messages up to Coalescing.MaxDelay, according to the Config.Clock.
+func TestCoalescingMaxDelay(t *testing.T) {
+	tests := []struct {
+		name string
+		sent int
+		// wait is whether the batch waits for the MaxDelay.
+		wait bool
+	}{
+		{"full batch", 3, false},
+		{"partial batch", 2, true},
+		{"full batch and partial batch", 5, true},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			clock := NewFakeClock(time.Unix(1000, 0))
+			conn, client := startTest(t, &Config{
+				Clock:           clock,
+				GracePeriod:     time.Second,
+				SendQueueSize:   8,
+				WriteCoalescing: &Coalescing{MaxMessages: 3, MaxDelay: time.Minute},
+			}, newTestSocket())
+			read := make(chan []byte, tc.sent)
+			go func() {
+				for {
+					_, payload, err := client.ReadMessage()
+					if err != nil {
+						return
+					}
+					read <- payload
+				}
+			}()
+
+			for i := range tc.sent {
+				if err := conn.Send(TextMessage(strconv.Itoa(i))); err != nil {
+					t.Fatalf("Send: %v", err)
+				}
+			}
+			ready := tc.sent
+			if tc.wait {
+				ready -= tc.sent % 3
+			}
+			for i := range ready {
+				if got := receive(t, read); string(got) != strconv.Itoa(i) {
+					t.Fatalf("read %q, want %d", got, i)
+				}
+			}
+			if !tc.wait {
+				return
+			}
+
+			select {
+			case payload := <-read:
+				t.Fatalf("%q read before the MaxDelay", payload)
+			case <-time.After(20 * time.Millisecond):
+			}
+			clock.BlockUntil(1)
+			clock.Advance(time.Minute)
+			for i := ready; i < tc.sent; i++ {
+				if got := receive(t, read); string(got) != strconv.Itoa(i) {
+					t.Fatalf("read %q, want %d", got, i)
+				}
+			}
+		})
+	}
+}
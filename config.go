@@ -1,9 +1,15 @@
 package websocket_manager
 
 import (
+	"errors"
+	"log/slog"
+	"math/rand/v2"
+	"slices"
 	"sync"
 	"sync/atomic"
 	"time"
+
+	"github.com/gorilla/websocket"
 )
 
 type Config struct {
@@ -14,6 +20,9 @@ type Config struct {
 	// PingFrequency How often to send ping messages to clients.
 	// If 0, no ping messages will be sent.
 	PingFrequency time.Duration
+	// PingJitter Up to how long to randomly bring the first ping of each connection forward, so that connections started together do not ping together.
+	// It must be less than the PingFrequency.
+	PingJitter time.Duration
 	// PongTimeout How long to wait for a pong message to be sent to a client before timing out.
 	// If 0, no pong messages will be sent.
 	PongTimeout time.Duration
@@ -21,34 +30,250 @@ type Config struct {
 	WriteTimeout time.Duration
 	// GracePeriod How long to wait for a client to acknowledge a close message before closing the connection.
 	GracePeriod time.Duration
+	// Heartbeat Sends application-level heartbeats and expects replies, alongside or instead of the ping and pong frames.
+	// If nil, no heartbeat is sent.
+	Heartbeat *Heartbeat
+	// IdleTimeout How long the connection may go without reading or writing a message before it is closed with gorilla/websocket.CloseGoingAway.
+	// Ping, pong and close frames do not count as activity, see IdleHandler to veto or extend the close.
+	// If 0, the connection never becomes idle.
+	IdleTimeout time.Duration
+	// InboundIdleTimeout How long the connection may go without reading a message, otherwise behaves like IdleTimeout.
+	InboundIdleTimeout time.Duration
+	// OutboundIdleTimeout How long the connection may go without writing a message, otherwise behaves like IdleTimeout.
+	OutboundIdleTimeout time.Duration
+	// MaxLifetime How long a connection may stay open before it is recycled by starting the close handshake with MaxLifetimeCloseMessage.
+	// If 0, connections are never recycled.
+	MaxLifetime time.Duration
+	// MaxLifetimeJitter Up to how long to randomly add to the MaxLifetime of each connection, so that connections started together are not recycled together.
+	MaxLifetimeJitter time.Duration
+	// MaxLifetimeCloseMessage will be sent to clients once their MaxLifetime elapses, it must be of type gorilla/websocket.CloseMessage
+	// and its code must be one that can be sent: 1000 to 1003, 1007 to 1014 or 3000 to 4999.
+	// If nil, a gorilla/websocket.CloseServiceRestart close message hinting the client to reconnect is sent.
+	MaxLifetimeCloseMessage Message
+	// ReadLimit The maximum size in bytes of a message read from the client, larger ones close the connection with gorilla/websocket.CloseMessageTooBig.
+	// If 0, messages are not limited.
+	ReadLimit int64
+	// SendQueueSize How many messages Conn.Send can queue before blocking.
+	// If 0, Conn.Send blocks until the worker picks up the message.
+	SendQueueSize int
+	// PriorityWeights How the high, normal and bulk priority lanes share the connection, see Priority.
+	PriorityWeights PriorityWeights
+	// PriorityLaneSize How many messages each priority lane holds ahead of writing them, so that more urgent ones can overtake them.
+	// If 0, 64 is used.
+	PriorityLaneSize int
+	// WriteCoalescing Batches messages that are ready to be written together into a single write, reducing syscalls under load.
+	// It must only be set on server side connections. If nil, every message is written on its own.
+	WriteCoalescing *Coalescing
+	// Logger Where the worker logs the lifecycle of the connection, its close cause and code, and its ping failures.
+	// The connection ID and the attributes of the LogAttrsProvider are added to every line, see Conn.Logger.
+	// It is picked up when the connection starts. If nil, nothing is logged.
+	Logger *slog.Logger
+	// Clock The source of time of the worker, for the pings, the pong, idle, lifetime and grace period timeouts, and the Stats.
+	// It is picked up when the connection starts, a Reload does not change it. If nil, the real time is used.
+	// See TimingWheel to schedule the timers of many connections on a shared wheel.
+	Clock Clock
+	// CloseFrames maps the errors that make the worker tear down the connection to the close frames sent to the client beforehand.
+	// The first entry whose Err matches the cause of the teardown is used.
+	// If nil, the connection is closed without sending a close frame. See DefaultCloseFrames.
+	CloseFrames []CloseFrame
 	mu          sync.Mutex
 	validated   atomic.Bool
+	// live holds the Config in effect for the connections started with this one, see Reload.
+	live     atomic.Pointer[configState]
+	reloadMu sync.Mutex
+}
+
+// Clone returns a copy of the exported fields of c, that can be modified and used on its own.
+// Messages are shared since they are immutable.
+func (c *Config) Clone() *Config {
+	clone := &Config{
+		PingMessage:             c.PingMessage,
+		PingFrequency:           c.PingFrequency,
+		PingJitter:              c.PingJitter,
+		PongTimeout:             c.PongTimeout,
+		WriteTimeout:            c.WriteTimeout,
+		GracePeriod:             c.GracePeriod,
+		IdleTimeout:             c.IdleTimeout,
+		InboundIdleTimeout:      c.InboundIdleTimeout,
+		OutboundIdleTimeout:     c.OutboundIdleTimeout,
+		MaxLifetime:             c.MaxLifetime,
+		MaxLifetimeJitter:       c.MaxLifetimeJitter,
+		MaxLifetimeCloseMessage: c.MaxLifetimeCloseMessage,
+		ReadLimit:               c.ReadLimit,
+		SendQueueSize:           c.SendQueueSize,
+		PriorityWeights:         c.PriorityWeights,
+		PriorityLaneSize:        c.PriorityLaneSize,
+		Logger:                  c.Logger,
+		Clock:                   c.Clock,
+		CloseFrames:             slices.Clone(c.CloseFrames),
+	}
+	if c.WriteCoalescing != nil {
+		coalescing := *c.WriteCoalescing
+		clone.WriteCoalescing = &coalescing
+	}
+	if c.Heartbeat != nil {
+		heartbeat := *c.Heartbeat
+		clone.Heartbeat = &heartbeat
+	}
+
+	return clone
 }
 
 func (c *Config) isPingPongConfigured() bool {
 	return c.PingMessage != nil && c.PingFrequency > 0 && c.PongTimeout > 0
 }
 
-func (c *Config) validate() error {
-	if c.validated.CompareAndSwap(false, true) {
-		c.mu.Lock()
-		defer c.mu.Unlock()
-		if c.GracePeriod <= 0 {
-			c.validErr = ErrConfigBadGracePeriod
-			return c.validErr
-		}
-		if c.PingMessage != nil || c.PingFrequency != 0 || c.PongTimeout != 0 {
-			if c.PingMessage == nil || c.PingFrequency == 0 || c.PongTimeout == 0 {
-				c.validErr = ErrConfigPartialPingConfiguration
-				return c.validErr
-			}
-
-			if c.PongTimeout <= c.PingFrequency+c.WriteTimeout {
-				c.validErr = ErrConfigBadPingFrequency
-				return c.validErr
-			}
+// firstPing returns how long a new connection waits for its first ping, the PingFrequency minus a random jitter.
+func (c *Config) firstPing() time.Duration {
+	if c.PingJitter <= 0 {
+		return c.PingFrequency
+	}
+
+	return c.PingFrequency - rand.N(c.PingJitter)
+}
+
+func (c *Config) priorityWeights() PriorityWeights {
+	if c.PriorityWeights == (PriorityWeights{}) {
+		return defaultPriorityWeights
+	}
+
+	return c.PriorityWeights
+}
+
+func (c *Config) priorityLaneSize() int {
+	if c.PriorityLaneSize == 0 {
+		return defaultPriorityLaneSize
+	}
+
+	return c.PriorityLaneSize
+}
+
+func (c *Config) closeFrameFor(cause error) (CloseFrame, bool) {
+	for _, frame := range c.CloseFrames {
+		if errors.Is(cause, frame.Err) {
+			return frame, true
+		}
+	}
+
+	return CloseFrame{}, false
+}
+
+// controlFrameDeadline returns the deadline for writing a control frame outside the writer loop.
+func (c *Config) controlFrameDeadline() time.Time {
+	if c.WriteTimeout > 0 {
+		return time.Now().Add(c.WriteTimeout)
+	}
+
+	return time.Now().Add(c.GracePeriod)
+}
+
+// ConfigError is a violation found by Config.Validate, Err is one of the ErrConfig errors.
+type ConfigError struct {
+	Err   error
+	Field string
+}
+
+func (e *ConfigError) Error() string {
+	return e.Field + ": " + e.Err.Error()
+}
+
+func (e *ConfigError) Unwrap() error {
+	return e.Err
+}
+
+// Validate reports every violation of the Config at once, each one as a *ConfigError naming the field at fault.
+// The errors are joined, use errors.Is to look for one of the ErrConfig errors described in Run.
+// Returns nil if the Config is valid.
+func (c *Config) Validate() error {
+	var errs []error
+	violation := func(field string, err error) {
+		errs = append(errs, &ConfigError{Field: field, Err: err})
+	}
+
+	if c.GracePeriod <= 0 {
+		violation("GracePeriod", ErrConfigBadGracePeriod)
+	}
+	if c.IdleTimeout < 0 {
+		violation("IdleTimeout", ErrConfigBadIdleTimeout)
+	}
+	if c.InboundIdleTimeout < 0 {
+		violation("InboundIdleTimeout", ErrConfigBadIdleTimeout)
+	}
+	if c.OutboundIdleTimeout < 0 {
+		violation("OutboundIdleTimeout", ErrConfigBadIdleTimeout)
+	}
+	if c.MaxLifetime < 0 {
+		violation("MaxLifetime", ErrConfigBadMaxLifetime)
+	}
+	if c.MaxLifetimeJitter < 0 {
+		violation("MaxLifetimeJitter", ErrConfigBadMaxLifetime)
+	}
+	if msg := c.MaxLifetimeCloseMessage; msg != nil && (msg.Type() != websocket.CloseMessage || !sendableCloseCode(closeCode(msg))) {
+		violation("MaxLifetimeCloseMessage", ErrConfigBadMaxLifetime)
+	}
+	if c.ReadLimit < 0 {
+		violation("ReadLimit", ErrConfigBadReadLimit)
+	}
+	if c.SendQueueSize < 0 {
+		violation("SendQueueSize", ErrConfigBadSendQueueSize)
+	}
+	if wc := c.WriteCoalescing; wc != nil {
+		if wc.MaxMessages < 0 {
+			violation("WriteCoalescing.MaxMessages", ErrConfigBadWriteCoalescing)
+		}
+		if wc.MaxBytes < 0 {
+			violation("WriteCoalescing.MaxBytes", ErrConfigBadWriteCoalescing)
+		}
+		if wc.MaxDelay < 0 {
+			violation("WriteCoalescing.MaxDelay", ErrConfigBadWriteCoalescing)
 		}
 	}
+	if c.PriorityLaneSize < 0 {
+		violation("PriorityLaneSize", ErrConfigBadPriorityLanes)
+	}
+	if w := c.PriorityWeights; w != (PriorityWeights{}) && (w.High <= 0 || w.Normal <= 0 || w.Bulk <= 0) {
+		violation("PriorityWeights", ErrConfigBadPriorityLanes)
+	}
+	if c.Heartbeat != nil {
+		c.Heartbeat.validate(c.WriteTimeout, violation)
+	}
+	if c.PingMessage != nil || c.PingFrequency != 0 || c.PongTimeout != 0 {
+		partial := false
+		if c.PingMessage == nil {
+			violation("PingMessage", ErrConfigPartialPingConfiguration)
+			partial = true
+		}
+		if c.PingFrequency == 0 {
+			violation("PingFrequency", ErrConfigPartialPingConfiguration)
+			partial = true
+		}
+		if c.PongTimeout == 0 {
+			violation("PongTimeout", ErrConfigPartialPingConfiguration)
+			partial = true
+		}
+		if !partial && c.PongTimeout <= c.PingFrequency+c.WriteTimeout {
+			violation("PongTimeout", ErrConfigBadPingFrequency)
+		}
+	}
+	if c.PingJitter < 0 || (c.PingJitter > 0 && c.PingJitter >= c.PingFrequency) {
+		violation("PingJitter", ErrConfigBadPingFrequency)
+	}
+
+	return errors.Join(errs...)
+}
+
+// validate caches the result of Validate, the Config must not be modified once it is used.
+func (c *Config) validate() error {
+	if c.validated.Load() {
+		return c.validErr
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if !c.validated.Load() {
+		c.validErr = c.Validate()
+		c.validated.Store(true)
+	}
 
 	return c.validErr
 }
@@ -0,0 +1,298 @@
+package websocket_manager
+
+import (
+	"bytes"
+	"encoding"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// maxControlPayload is the largest payload of a control frame.
+const maxControlPayload = 125
+
+// LoadConfig reads a Config from the JSON or YAML file at path, whose extension (.json, .yaml or .yml) decides the format.
+// The keys are the snake case names of the Config fields, e.g. ping_frequency, durations are strings like "3s" and ping_message is the payload as a string.
+// max_lifetime_close_message holds a code and a text, write_coalescing and priority_weights hold the snake case names of their fields,
+// and default_close_frames: true sets the CloseFrames to DefaultCloseFrames.
+// Environment variables named after the upper case keys prefixed by envPrefix and an underscore override the file,
+// e.g. WS_PING_FREQUENCY=3s or WS_WRITE_COALESCING_MAX_DELAY=1ms for the WS prefix.
+// If path is empty, the Config is read from the environment alone. If envPrefix is empty, the environment is ignored.
+// Returns ErrConfigDecode if the file or an environment variable cannot be read or decoded.
+// Returns every violation found by Config.Validate.
+func LoadConfig(path, envPrefix string) (*Config, error) {
+	spec := &configSpec{}
+	if path != "" {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return nil, fmt.Errorf("%w: %w", ErrConfigDecode, err)
+		}
+
+		switch ext := strings.ToLower(filepath.Ext(path)); ext {
+		case ".json":
+			err = spec.decodeJSON(bytes.NewReader(data))
+		case ".yaml", ".yml":
+			err = spec.decodeYAML(bytes.NewReader(data))
+		default:
+			err = fmt.Errorf("%w: unsupported file extension %q", ErrConfigDecode, ext)
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if envPrefix != "" {
+		if _, err := applyEnv(reflect.ValueOf(spec).Elem(), envPrefix, os.LookupEnv); err != nil {
+			return nil, err
+		}
+	}
+
+	return spec.config()
+}
+
+// DecodeConfigJSON reads a Config from JSON, see LoadConfig for the format.
+// Returns ErrConfigDecode if it cannot be decoded, or every violation found by Config.Validate.
+func DecodeConfigJSON(r io.Reader) (*Config, error) {
+	spec := &configSpec{}
+	if err := spec.decodeJSON(r); err != nil {
+		return nil, err
+	}
+
+	return spec.config()
+}
+
+// DecodeConfigYAML reads a Config from YAML, see LoadConfig for the format.
+// Returns ErrConfigDecode if it cannot be decoded, or every violation found by Config.Validate.
+func DecodeConfigYAML(r io.Reader) (*Config, error) {
+	spec := &configSpec{}
+	if err := spec.decodeYAML(r); err != nil {
+		return nil, err
+	}
+
+	return spec.config()
+}
+
+// configSpec is the serializable form of a Config.
+type configSpec struct {
+	PingMessage             *string              `json:"ping_message" yaml:"ping_message"`
+	MaxLifetimeCloseMessage *closeMessageSpec    `json:"max_lifetime_close_message" yaml:"max_lifetime_close_message"`
+	PriorityWeights         *priorityWeightsSpec `json:"priority_weights" yaml:"priority_weights"`
+	WriteCoalescing         *coalescingSpec      `json:"write_coalescing" yaml:"write_coalescing"`
+	Heartbeat               *heartbeatSpec       `json:"heartbeat" yaml:"heartbeat"`
+	PingFrequency           duration             `json:"ping_frequency" yaml:"ping_frequency"`
+	PingJitter              duration             `json:"ping_jitter" yaml:"ping_jitter"`
+	PongTimeout             duration             `json:"pong_timeout" yaml:"pong_timeout"`
+	WriteTimeout            duration             `json:"write_timeout" yaml:"write_timeout"`
+	GracePeriod             duration             `json:"grace_period" yaml:"grace_period"`
+	IdleTimeout             duration             `json:"idle_timeout" yaml:"idle_timeout"`
+	InboundIdleTimeout      duration             `json:"inbound_idle_timeout" yaml:"inbound_idle_timeout"`
+	OutboundIdleTimeout     duration             `json:"outbound_idle_timeout" yaml:"outbound_idle_timeout"`
+	MaxLifetime             duration             `json:"max_lifetime" yaml:"max_lifetime"`
+	MaxLifetimeJitter       duration             `json:"max_lifetime_jitter" yaml:"max_lifetime_jitter"`
+	ReadLimit               int64                `json:"read_limit" yaml:"read_limit"`
+	SendQueueSize           int                  `json:"send_queue_size" yaml:"send_queue_size"`
+	PriorityLaneSize        int                  `json:"priority_lane_size" yaml:"priority_lane_size"`
+	DefaultCloseFrames      bool                 `json:"default_close_frames" yaml:"default_close_frames"`
+}
+
+type closeMessageSpec struct {
+	Text string `json:"text" yaml:"text"`
+	Code int    `json:"code" yaml:"code"`
+}
+
+type priorityWeightsSpec struct {
+	High   int `json:"high" yaml:"high"`
+	Normal int `json:"normal" yaml:"normal"`
+	Bulk   int `json:"bulk" yaml:"bulk"`
+}
+
+type coalescingSpec struct {
+	MaxMessages int      `json:"max_messages" yaml:"max_messages"`
+	MaxBytes    int      `json:"max_bytes" yaml:"max_bytes"`
+	MaxDelay    duration `json:"max_delay" yaml:"max_delay"`
+}
+
+type heartbeatSpec struct {
+	Message   string   `json:"message" yaml:"message"`
+	Reply     string   `json:"reply" yaml:"reply"`
+	Frequency duration `json:"frequency" yaml:"frequency"`
+	Timeout   duration `json:"timeout" yaml:"timeout"`
+}
+
+// duration is a time.Duration written as a string like "3s".
+type duration time.Duration
+
+func (d *duration) UnmarshalText(text []byte) error {
+	parsed, err := time.ParseDuration(string(text))
+	if err != nil {
+		return err
+	}
+
+	*d = duration(parsed)
+	return nil
+}
+
+func (s *configSpec) decodeJSON(r io.Reader) error {
+	decoder := json.NewDecoder(r)
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(s); err != nil {
+		return fmt.Errorf("%w: %w", ErrConfigDecode, err)
+	}
+
+	return nil
+}
+
+func (s *configSpec) decodeYAML(r io.Reader) error {
+	decoder := yaml.NewDecoder(r)
+	decoder.KnownFields(true)
+	if err := decoder.Decode(s); err != nil && err != io.EOF { // An empty document leaves the defaults.
+		return fmt.Errorf("%w: %w", ErrConfigDecode, err)
+	}
+
+	return nil
+}
+
+// config builds the Config, it returns every violation found by Config.Validate.
+func (s *configSpec) config() (*Config, error) {
+	conf := &Config{
+		PingFrequency:       time.Duration(s.PingFrequency),
+		PingJitter:          time.Duration(s.PingJitter),
+		PongTimeout:         time.Duration(s.PongTimeout),
+		WriteTimeout:        time.Duration(s.WriteTimeout),
+		GracePeriod:         time.Duration(s.GracePeriod),
+		IdleTimeout:         time.Duration(s.IdleTimeout),
+		InboundIdleTimeout:  time.Duration(s.InboundIdleTimeout),
+		OutboundIdleTimeout: time.Duration(s.OutboundIdleTimeout),
+		MaxLifetime:         time.Duration(s.MaxLifetime),
+		MaxLifetimeJitter:   time.Duration(s.MaxLifetimeJitter),
+		ReadLimit:           s.ReadLimit,
+		SendQueueSize:       s.SendQueueSize,
+		PriorityLaneSize:    s.PriorityLaneSize,
+	}
+	var errs []error
+	if s.PingMessage != nil {
+		if len(*s.PingMessage) > maxControlPayload {
+			return nil, fmt.Errorf("%w: ping_message longer than %d bytes", ErrConfigDecode, maxControlPayload)
+		}
+		conf.PingMessage = PingMessage([]byte(*s.PingMessage))
+	}
+	if m := s.MaxLifetimeCloseMessage; m != nil {
+		if len(m.Text)+2 > maxControlPayload {
+			return nil, fmt.Errorf("%w: max_lifetime_close_message text longer than %d bytes", ErrConfigDecode, maxControlPayload-2)
+		}
+		if sendableCloseCode(m.Code) {
+			conf.MaxLifetimeCloseMessage = CloseMessage(m.Code, m.Text)
+		} else { // A close message would truncate the code to 16 bits, it is reported along with the violations of Validate.
+			errs = append(errs, &ConfigError{Field: "MaxLifetimeCloseMessage", Err: ErrConfigBadMaxLifetime})
+		}
+	}
+	if w := s.PriorityWeights; w != nil {
+		conf.PriorityWeights = PriorityWeights{High: w.High, Normal: w.Normal, Bulk: w.Bulk}
+	}
+	if c := s.WriteCoalescing; c != nil {
+		conf.WriteCoalescing = &Coalescing{MaxMessages: c.MaxMessages, MaxBytes: c.MaxBytes, MaxDelay: time.Duration(c.MaxDelay)}
+	}
+	if h := s.Heartbeat; h != nil {
+		conf.Heartbeat = &Heartbeat{Frequency: time.Duration(h.Frequency), Timeout: time.Duration(h.Timeout)}
+		if h.Message != "" {
+			conf.Heartbeat.Message = TextMessage(h.Message)
+		}
+		if h.Reply != "" {
+			conf.Heartbeat.Reply = []byte(h.Reply)
+		}
+	}
+	if s.DefaultCloseFrames {
+		conf.CloseFrames = DefaultCloseFrames()
+	}
+
+	if err := conf.Validate(); err != nil {
+		errs = append(errs, err)
+	}
+	if len(errs) > 0 {
+		return nil, errors.Join(errs...)
+	}
+
+	return conf, nil
+}
+
+var textUnmarshalerType = reflect.TypeFor[encoding.TextUnmarshaler]()
+
+// applyEnv sets the fields of v from the environment variables named after their upper case json keys, it reports whether any was set.
+// Nested structs are named after their parent, e.g. WS_WRITE_COALESCING_MAX_DELAY.
+func applyEnv(v reflect.Value, prefix string, lookup func(string) (string, bool)) (bool, error) {
+	found := false
+	for i := range v.NumField() {
+		field, structField := v.Field(i), v.Type().Field(i)
+		key, _, _ := strings.Cut(structField.Tag.Get("json"), ",")
+		name := prefix + "_" + strings.ToUpper(key)
+
+		if structField.Type.Kind() == reflect.Pointer && structField.Type.Elem().Kind() == reflect.Struct {
+			nested := reflect.New(structField.Type.Elem())
+			if !field.IsNil() {
+				nested.Elem().Set(field.Elem())
+			}
+			nestedFound, err := applyEnv(nested.Elem(), name, lookup)
+			if err != nil {
+				return false, err
+			}
+			if nestedFound {
+				field.Set(nested)
+				found = true
+			}
+			continue
+		}
+
+		raw, ok := lookup(name)
+		if !ok {
+			continue
+		}
+		if err := setEnvValue(field, raw); err != nil {
+			return false, fmt.Errorf("%w: %s: %w", ErrConfigDecode, name, err)
+		}
+		found = true
+	}
+
+	return found, nil
+}
+
+func setEnvValue(field reflect.Value, raw string) error {
+	if field.Addr().Type().Implements(textUnmarshalerType) {
+		return field.Addr().Interface().(encoding.TextUnmarshaler).UnmarshalText([]byte(raw))
+	}
+
+	switch field.Kind() {
+	case reflect.Pointer:
+		value := reflect.New(field.Type().Elem())
+		if err := setEnvValue(value.Elem(), raw); err != nil {
+			return err
+		}
+		field.Set(value)
+	case reflect.String:
+		field.SetString(raw)
+	case reflect.Int, reflect.Int64:
+		value, err := strconv.ParseInt(raw, 10, 64)
+		if err != nil {
+			return err
+		}
+		field.SetInt(value)
+	case reflect.Bool:
+		value, err := strconv.ParseBool(raw)
+		if err != nil {
+			return err
+		}
+		field.SetBool(value)
+	default:
+		return fmt.Errorf("unsupported kind %s", field.Kind())
+	}
+
+	return nil
+}
@@ -0,0 +1,275 @@
+package websocket_manager
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+)
+
+// configErrorFields returns the sorted fields of the ConfigErrors joined in err.
+func configErrorFields(err error) []string {
+	var fields []string
+	var walk func(err error)
+	walk = func(err error) {
+		switch err := err.(type) {
+		case *ConfigError:
+			fields = append(fields, err.Field)
+		case interface{ Unwrap() []error }:
+			for _, err := range err.Unwrap() {
+				walk(err)
+			}
+		}
+	}
+	walk(err)
+
+	slices.Sort(fields)
+	return fields
+}
+
+// The JSON and YAML forms decode into the same Config.
+func TestDecodeConfig(t *testing.T) {
+	const (
+		jsonConfig = `{
+			"grace_period": "2s",
+			"write_timeout": "1s",
+			"ping_message": "ping",
+			"ping_frequency": "3s",
+			"pong_timeout": "10s",
+			"read_limit": 1024,
+			"max_lifetime": "1h",
+			"max_lifetime_close_message": {"code": 4000, "text": "recycled"},
+			"priority_weights": {"high": 4, "normal": 2, "bulk": 1},
+			"write_coalescing": {"max_messages": 8, "max_delay": "1ms"},
+			"default_close_frames": true
+		}`
+		yamlConfig = `
+grace_period: 2s
+write_timeout: 1s
+ping_message: ping
+ping_frequency: 3s
+pong_timeout: 10s
+read_limit: 1024
+max_lifetime: 1h
+max_lifetime_close_message:
+  code: 4000
+  text: recycled
+priority_weights:
+  high: 4
+  normal: 2
+  bulk: 1
+write_coalescing:
+  max_messages: 8
+  max_delay: 1ms
+default_close_frames: true
+`
+	)
+
+	tests := []struct {
+		name   string
+		decode func() (*Config, error)
+	}{
+		{"JSON", func() (*Config, error) { return DecodeConfigJSON(strings.NewReader(jsonConfig)) }},
+		{"YAML", func() (*Config, error) { return DecodeConfigYAML(strings.NewReader(yamlConfig)) }},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			conf, err := tc.decode()
+			if err != nil {
+				t.Fatalf("decode: %v", err)
+			}
+
+			if conf.GracePeriod != 2*time.Second || conf.WriteTimeout != time.Second || conf.PingFrequency != 3*time.Second ||
+				conf.PongTimeout != 10*time.Second || conf.ReadLimit != 1024 || conf.MaxLifetime != time.Hour {
+				t.Fatalf("scalar fields not decoded: %+v", conf)
+			}
+			if _, payload := conf.PingMessage.(*message).payload(); string(payload) != "ping" {
+				t.Fatalf("PingMessage payload %q, want ping", payload)
+			}
+			if code := closeCode(conf.MaxLifetimeCloseMessage); code != 4000 {
+				t.Fatalf("MaxLifetimeCloseMessage code %d, want 4000", code)
+			}
+			if want := (PriorityWeights{High: 4, Normal: 2, Bulk: 1}); conf.PriorityWeights != want {
+				t.Fatalf("PriorityWeights %+v, want %+v", conf.PriorityWeights, want)
+			}
+			if want := (Coalescing{MaxMessages: 8, MaxDelay: time.Millisecond}); conf.WriteCoalescing == nil || *conf.WriteCoalescing != want {
+				t.Fatalf("WriteCoalescing %+v, want %+v", conf.WriteCoalescing, want)
+			}
+			if conf.CloseFrames == nil {
+				t.Fatal("default_close_frames did not set the CloseFrames")
+			}
+		})
+	}
+}
+
+func TestDecodeConfigErrors(t *testing.T) {
+	tests := []struct {
+		name string
+		json string
+		yaml string
+		// wantFields are the fields of the ConfigErrors, the error is ErrConfigDecode if there is none.
+		wantFields []string
+	}{
+		{
+			name: "unknown field",
+			json: `{"grace_period": "1s", "grace": "1s"}`,
+			yaml: "grace_period: 1s\ngrace: 1s\n",
+		},
+		{
+			name: "unknown nested field",
+			json: `{"grace_period": "1s", "write_coalescing": {"max_delay": "1ms", "delay": "1ms"}}`,
+			yaml: "grace_period: 1s\nwrite_coalescing:\n  max_delay: 1ms\n  delay: 1ms\n",
+		},
+		{
+			name: "malformed duration",
+			json: `{"grace_period": "soon"}`,
+			yaml: "grace_period: soon\n",
+		},
+		{
+			name: "ping message too long",
+			json: `{"grace_period": "1s", "ping_message": "` + strings.Repeat("p", maxControlPayload+1) + `"}`,
+			yaml: "grace_period: 1s\nping_message: " + strings.Repeat("p", maxControlPayload+1) + "\n",
+		},
+		{
+			name:       "every violation",
+			json:       `{"read_limit": -1, "send_queue_size": -1, "ping_frequency": "1s"}`,
+			yaml:       "read_limit: -1\nsend_queue_size: -1\nping_frequency: 1s\n",
+			wantFields: []string{"GracePeriod", "PingMessage", "PongTimeout", "ReadLimit", "SendQueueSize"},
+		},
+		{
+			name:       "close code out of range",
+			json:       `{"max_lifetime_close_message": {"code": 99999}}`,
+			yaml:       "max_lifetime_close_message:\n  code: 99999\n",
+			wantFields: []string{"GracePeriod", "MaxLifetimeCloseMessage"},
+		},
+	}
+	for _, tc := range tests {
+		for format, decode := range map[string]func() (*Config, error){
+			"JSON": func() (*Config, error) { return DecodeConfigJSON(strings.NewReader(tc.json)) },
+			"YAML": func() (*Config, error) { return DecodeConfigYAML(strings.NewReader(tc.yaml)) },
+		} {
+			t.Run(tc.name+" in "+format, func(t *testing.T) {
+				_, err := decode()
+				if tc.wantFields == nil {
+					if !errors.Is(err, ErrConfigDecode) {
+						t.Fatalf("decode = %v, want ErrConfigDecode", err)
+					}
+					return
+				}
+				if fields := configErrorFields(err); !slices.Equal(fields, tc.wantFields) {
+					t.Fatalf("decode = %v, want violations of %q", err, tc.wantFields)
+				}
+			})
+		}
+	}
+}
+
+// The environment overrides the file, and is read alone if there is no file.
+func TestLoadConfig(t *testing.T) {
+	dir := t.TempDir()
+	write := func(name, content string) string {
+		path := filepath.Join(dir, name)
+		if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+			t.Fatal(err)
+		}
+		return path
+	}
+	jsonPath := write("config.json", `{"grace_period": "2s", "read_limit": 1024, "write_coalescing": {"max_messages": 8}}`)
+	yamlPath := write("config.yml", "grace_period: 2s\nread_limit: 1024\nwrite_coalescing:\n  max_messages: 8\n")
+
+	tests := []struct {
+		name string
+		path string
+		env  map[string]string
+		want *Config
+		// wantErr is nil if the Config is loaded.
+		wantErr error
+	}{
+		{
+			name: "JSON",
+			path: jsonPath,
+			want: &Config{GracePeriod: 2 * time.Second, ReadLimit: 1024, WriteCoalescing: &Coalescing{MaxMessages: 8}},
+		},
+		{
+			name: "YAML",
+			path: yamlPath,
+			want: &Config{GracePeriod: 2 * time.Second, ReadLimit: 1024, WriteCoalescing: &Coalescing{MaxMessages: 8}},
+		},
+		{
+			name: "environment over the file",
+			path: jsonPath,
+			env:  map[string]string{"WS_READ_LIMIT": "10", "WS_WRITE_COALESCING_MAX_DELAY": "1ms"},
+			want: &Config{GracePeriod: 2 * time.Second, ReadLimit: 10, WriteCoalescing: &Coalescing{MaxMessages: 8, MaxDelay: time.Millisecond}},
+		},
+		{
+			name: "environment alone",
+			env:  map[string]string{"WS_GRACE_PERIOD": "3s", "WS_MAX_LIFETIME_CLOSE_MESSAGE_CODE": "4000"},
+			want: &Config{GracePeriod: 3 * time.Second, MaxLifetimeCloseMessage: CloseMessage(4000, "")},
+		},
+		{
+			name:    "malformed environment variable",
+			path:    jsonPath,
+			env:     map[string]string{"WS_READ_LIMIT": "many"},
+			wantErr: ErrConfigDecode,
+		},
+		{
+			name:    "unsupported extension",
+			path:    write("config.toml", ""),
+			wantErr: ErrConfigDecode,
+		},
+		{
+			name:    "missing file",
+			path:    filepath.Join(dir, "missing.json"),
+			wantErr: ErrConfigDecode,
+		},
+		{
+			name:    "invalid environment value",
+			path:    jsonPath,
+			env:     map[string]string{"WS_GRACE_PERIOD": "0s"},
+			wantErr: ErrConfigBadGracePeriod,
+		},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			for name, val := range tc.env {
+				t.Setenv(name, val)
+			}
+
+			conf, err := LoadConfig(tc.path, "WS")
+			if tc.wantErr != nil {
+				if !errors.Is(err, tc.wantErr) {
+					t.Fatalf("LoadConfig = %v, want %v", err, tc.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("LoadConfig: %v", err)
+			}
+
+			if conf.GracePeriod != tc.want.GracePeriod || conf.ReadLimit != tc.want.ReadLimit {
+				t.Fatalf("GracePeriod %v and ReadLimit %d, want %v and %d", conf.GracePeriod, conf.ReadLimit, tc.want.GracePeriod, tc.want.ReadLimit)
+			}
+			if (conf.WriteCoalescing == nil) != (tc.want.WriteCoalescing == nil) ||
+				conf.WriteCoalescing != nil && *conf.WriteCoalescing != *tc.want.WriteCoalescing {
+				t.Fatalf("WriteCoalescing %+v, want %+v", conf.WriteCoalescing, tc.want.WriteCoalescing)
+			}
+			if got, want := closeCode(conf.MaxLifetimeCloseMessage), closeCode(tc.want.MaxLifetimeCloseMessage); got != want {
+				t.Fatalf("MaxLifetimeCloseMessage code %d, want %d", got, want)
+			}
+		})
+	}
+
+	t.Run("environment ignored without a prefix", func(t *testing.T) {
+		t.Setenv("WS_READ_LIMIT", "10")
+		conf, err := LoadConfig(jsonPath, "")
+		if err != nil {
+			t.Fatalf("LoadConfig: %v", err)
+		}
+		if conf.ReadLimit != 1024 {
+			t.Fatalf("ReadLimit %d, want the 1024 of the file", conf.ReadLimit)
+		}
+	})
+}
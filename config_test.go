@@ -0,0 +1,86 @@
+package websocket_manager
+
+import (
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+// The first ping of each connection is brought forward by up to PingJitter, the next ones follow every PingFrequency.
+func TestPingJitter(t *testing.T) {
+	tests := []struct {
+		name   string
+		jitter time.Duration
+	}{
+		{"without jitter", 0},
+		{"with jitter", 30 * time.Second},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			conf := &Config{PingMessage: PingMessage(nil), PingFrequency: time.Minute, PingJitter: tc.jitter, PongTimeout: time.Hour}
+
+			seen := make(map[time.Duration]bool)
+			for range 1000 {
+				first := conf.firstPing()
+				if first > time.Minute || first <= time.Minute-max(tc.jitter, time.Nanosecond) {
+					t.Fatalf("firstPing() = %v, want within (%v, 1m]", first, time.Minute-tc.jitter)
+				}
+				seen[first] = true
+			}
+			if spread := len(seen) > 1; spread != (tc.jitter > 0) {
+				t.Fatalf("%d distinct first pings out of 1000, want spread %t", len(seen), tc.jitter > 0)
+			}
+
+			clock := NewFakeClock(time.Unix(1000, 0))
+			conf.Clock, conf.GracePeriod = clock, time.Second
+			_, client := startTest(t, conf, newTestSocket())
+			pings := make(chan string, 4)
+			client.SetPingHandler(func(payload string) error {
+				pings <- payload
+				return nil
+			})
+			_ = readAll(client)
+
+			clock.BlockUntil(2)
+			clock.Advance(time.Minute)
+			_ = receive(t, pings)
+			clock.Advance(time.Minute - time.Nanosecond)
+			select {
+			case <-pings:
+				t.Fatal("the second ping came before the PingFrequency")
+			case <-time.After(20 * time.Millisecond):
+			}
+			clock.Advance(time.Nanosecond)
+			_ = receive(t, pings)
+		})
+	}
+}
+
+func TestValidateMaxLifetimeCloseMessage(t *testing.T) {
+	tests := []struct {
+		name    string
+		msg     Message
+		wantErr bool
+	}{
+		{"default", nil, false},
+		{"normal closure", CloseMessage(websocket.CloseNormalClosure, ""), false},
+		{"service restart", CloseMessage(websocket.CloseServiceRestart, "restart"), false},
+		{"application code", CloseMessage(4999, ""), false},
+		{"no status", CloseMessage(websocket.CloseNoStatusReceived, ""), false},
+		{"reserved code", CloseMessage(websocket.CloseAbnormalClosure, ""), true},
+		{"TLS handshake code", CloseMessage(websocket.CloseTLSHandshake, ""), true},
+		{"unregistered code", CloseMessage(2000, ""), true},
+		{"code truncated to 16 bits", CloseMessage(99999, ""), true},
+		{"not a close message", TextMessage("bye"), true},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			err := (&Config{GracePeriod: time.Second, MaxLifetimeCloseMessage: tc.msg}).Validate()
+			if gotErr := slices.Equal(configErrorFields(err), []string{"MaxLifetimeCloseMessage"}); gotErr != tc.wantErr || !tc.wantErr && err != nil {
+				t.Fatalf("Validate = %v, want a violation of MaxLifetimeCloseMessage %t", err, tc.wantErr)
+			}
+		})
+	}
+}
@@ -0,0 +1,169 @@
+package websocket_manager
+
+import (
+	"context"
+	"crypto/rand"
+	"log/slog"
+)
+
+// Conn is a handle to a running connection.
+// It is safe for concurrent use and remains usable after the connection is closed.
+type Conn struct {
+	w *worker
+}
+
+// ID returns the unique identifier of the connection.
+func (c *Conn) ID() string {
+	return c.w.id
+}
+
+// Send queues a message to be written to the connection alongside the messages of the Socket.WriterChannel.
+// It blocks until the worker accepts the message or the queue of Config.SendQueueSize has room.
+// A Message with type gorilla/websocket.CloseMessage starts the close handshake.
+// Returns ErrConnectionClosed if the connection is closing or closed, since nothing writes the message afterward.
+func (c *Conn) Send(msg Message) error {
+	if c.w.State() != StateOpen {
+		return ErrConnectionClosed
+	}
+
+	select {
+	case c.w.sendCh <- msg:
+		c.w.wakeWriter()
+		return nil
+	case <-c.w.writerDone:
+		return ErrConnectionClosed
+	}
+}
+
+// TrySend queues a message like Send, without blocking.
+// Returns ErrSendQueueFull if the queue of Config.SendQueueSize has no room and the worker is busy.
+// Returns ErrConnectionClosed if the connection is closing or closed.
+func (c *Conn) TrySend(msg Message) error {
+	if c.w.State() != StateOpen {
+		return ErrConnectionClosed
+	}
+
+	select {
+	case c.w.sendCh <- msg:
+		c.w.wakeWriter()
+		return nil
+	default:
+		return ErrSendQueueFull
+	}
+}
+
+// SendAndWait queues a message like Send and waits until it is written to the connection.
+// Returns nil once the frame is flushed to the connection, which does not mean the client read it.
+// Returns the errors described in WithDeliveryCallback if the message cannot be written.
+// Returns ErrConnectionClosed if the connection is closed before the message is written, or before its outcome is known.
+// Returns the error of ctx if it is done first, in which case the message may still be written if it was queued.
+func (c *Conn) SendAndWait(ctx context.Context, msg Message) error {
+	if c.w.State() != StateOpen {
+		return ErrConnectionClosed
+	}
+
+	result := make(chan error, 1)
+	select {
+	case c.w.sendCh <- WithDeliveryCallback(msg, func(err error) { result <- err }):
+		c.w.wakeWriter()
+	case <-c.w.writerDone:
+		return ErrConnectionClosed
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+
+	select {
+	case err := <-result:
+		return err
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-c.w.writerDone:
+		select {
+		case err := <-result:
+			return err
+		default:
+			return ErrConnectionClosed
+		}
+	}
+}
+
+// Close starts the close handshake by sending a close message with the given status code and reason.
+// The close message skips the messages queued through Send and the Socket.WriterChannel.
+// Check valid status codes at https://pkg.go.dev/github.com/gorilla/websocket#pkg-constants.
+// Returns ErrConnectionClosed if the connection is already closing or closed.
+func (c *Conn) Close(code int, reason string) error {
+	return c.closeWithReason(CloseMessage(code, reason), nil)
+}
+
+// closeWithReason starts the close handshake with msg, reason is reported alongside its outcome by Err.
+func (c *Conn) closeWithReason(msg Message, reason error) error {
+	if c.w.State() != StateOpen {
+		return ErrConnectionClosed
+	}
+
+	select {
+	case c.w.closeReqCh <- closeRequest{msg: msg, reason: reason}:
+		c.w.wakeWriter()
+		return nil
+	case <-c.w.writerDone:
+		return ErrConnectionClosed
+	}
+}
+
+// tryCloseWithReason starts the close handshake like closeWithReason, without waiting for the writer.
+// It reports whether the close request was queued, which fails if the connection is closing or another close request is pending.
+func (c *Conn) tryCloseWithReason(msg Message, reason error) bool {
+	if c.w.State() != StateOpen {
+		return false
+	}
+
+	select {
+	case c.w.closeReqCh <- closeRequest{msg: msg, reason: reason}:
+		c.w.wakeWriter()
+		return true
+	default:
+		return false
+	}
+}
+
+// Done returns a channel that is closed once the connection is closed.
+func (c *Conn) Done() <-chan struct{} {
+	return c.w.done
+}
+
+// Err returns the reason the connection was closed, see Run for the possible errors.
+// Returns nil while the connection is running.
+func (c *Conn) Err() error {
+	select {
+	case <-c.w.done:
+		return c.w.err
+	default:
+		return nil
+	}
+}
+
+// State returns the current State of the connection.
+func (c *Conn) State() State {
+	return c.w.State()
+}
+
+// Config returns the Config the connection runs with, including the overrides of a ConfigOverrider and the reloads it picked up.
+// It must not be modified.
+func (c *Conn) Config() *Config {
+	return c.w.config()
+}
+
+// Logger returns the logger of the connection, the Config.Logger enriched with the connection ID and the attributes of the LogAttrsProvider.
+// It discards everything if the Config.Logger is nil.
+func (c *Conn) Logger() *slog.Logger {
+	return c.w.logger
+}
+
+// Stats returns a snapshot of the traffic of the connection.
+func (c *Conn) Stats() Stats {
+	return c.w.stats.snapshot(c.w.queueDepth())
+}
+
+func newConnectionID() string {
+	return rand.Text()
+}
@@ -0,0 +1,69 @@
+package websocket_manager
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+func TestConnSendRoundTrip(t *testing.T) {
+	conn, client := startTest(t, &Config{GracePeriod: time.Second}, newTestSocket())
+
+	if err := conn.Send(TextMessage("hello")); err != nil {
+		t.Fatalf("Send: %v", err)
+	}
+	if _, payload, err := client.ReadMessage(); err != nil || string(payload) != "hello" {
+		t.Fatalf("read %q, %v; want hello", payload, err)
+	}
+	if err := conn.SendAndWait(context.Background(), TextMessage("waited")); err != nil {
+		t.Fatalf("SendAndWait: %v", err)
+	}
+	if _, payload, err := client.ReadMessage(); err != nil || string(payload) != "waited" {
+		t.Fatalf("read %q, %v; want waited", payload, err)
+	}
+
+	if err := conn.Close(websocket.CloseNormalClosure, ""); err != nil {
+		t.Fatalf("Close: %v", err)
+	}
+	_ = receive(t, readAll(client))
+	if err := waitClosed(t, conn); !IsCleanClose(err) {
+		t.Fatalf("Err() = %v, want a clean close", err)
+	}
+}
+
+// The writer stops once the close message is sent, the calls made while waiting for the client must not wait for the GracePeriod.
+func TestConnCallsWhileClosing(t *testing.T) {
+	calls := []struct {
+		name string
+		call func(*Conn) error
+	}{
+		{"Send", func(c *Conn) error { return c.Send(TextMessage("late")) }},
+		{"TrySend", func(c *Conn) error { return c.TrySend(TextMessage("late")) }},
+		{"SendAndWait", func(c *Conn) error { return c.SendAndWait(context.Background(), TextMessage("late")) }},
+		{"Close", func(c *Conn) error { return c.Close(websocket.CloseNormalClosure, "again") }},
+	}
+	for _, queue := range []int{0, 8} {
+		for _, tc := range calls {
+			t.Run(tc.name, func(t *testing.T) {
+				conn, _ := startTest(t, &Config{GracePeriod: time.Minute, SendQueueSize: queue}, newTestSocket())
+				if err := conn.Close(websocket.CloseNormalClosure, ""); err != nil {
+					t.Fatalf("Close: %v", err)
+				}
+				for conn.State() == StateOpen {
+					time.Sleep(time.Millisecond)
+				}
+
+				began := time.Now()
+				if err := tc.call(conn); !errors.Is(err, ErrConnectionClosed) {
+					t.Fatalf("%s while closing = %v, want ErrConnectionClosed", tc.name, err)
+				}
+				if elapsed := time.Since(began); elapsed > time.Second {
+					t.Fatalf("%s while closing took %v", tc.name, elapsed)
+				}
+			})
+		}
+	}
+}
@@ -0,0 +1,21 @@
+package websocket_manager
+
+import "context"
+
+type contextKey int
+
+const (
+	sessionContextKey contextKey = iota
+	identityContextKey
+	connContextKey
+)
+
+func contextWithSession(ctx context.Context, session *Session) context.Context {
+	return context.WithValue(ctx, sessionContextKey, session)
+}
+
+// SessionFromContext returns the Session stored by JWTAuthenticator.Middleware, or nil if there is none.
+func SessionFromContext(ctx context.Context) *Session {
+	session, _ := ctx.Value(sessionContextKey).(*Session)
+	return session
+}
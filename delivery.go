@@ -0,0 +1,62 @@
+package websocket_manager
+
+import (
+	"sync"
+)
+
+// WithDeliveryCallback wraps msg so that done is called once msg is written to the connection, or once it cannot be.
+// done receives nil once the frame is flushed to the connection, which does not mean the client read it.
+// Otherwise done receives:
+// ErrFailedToWrite alongside the write error if writing msg fails, including ErrWriteTimeoutExceeded,
+// ErrMessageExpired if msg expired before it could be written, see WithExpiry,
+// ErrConnectionClosed if the connection is closed before msg is written.
+// done is called at most once, from the writer goroutine, and should finish quickly.
+// It is not called if msg never reaches the worker, e.g. Conn.Send returns an error or the connection is closed while msg waits in the Socket.WriterChannel.
+func WithDeliveryCallback(msg Message, done func(err error)) Message {
+	return &deliveryMessage{Message: msg, done: done}
+}
+
+type deliveryMessage struct {
+	Message
+	done func(err error)
+	once sync.Once
+}
+
+func (m *deliveryMessage) Unwrap() Message {
+	return m.Message
+}
+
+func (m *deliveryMessage) deliver(err error) {
+	m.once.Do(func() {
+		m.done(err)
+	})
+}
+
+// deliver reports the outcome of writing msg to its delivery callback, if it has one.
+func deliver(msg Message, err error) {
+	if delivery, ok := messageAs[interface{ deliver(error) }](msg); ok {
+		delivery.deliver(err)
+	}
+}
+
+// abandonQueued fails the delivery of the messages left in the batch, the outbox and the send queue once the writer stops.
+func (w *worker) abandonQueued(s *writerState) {
+	w.batch.deliver(ErrConnectionClosed)
+	w.batch.reset()
+
+	for msg := s.out.pop(); msg != nil; msg = s.out.pop() {
+		deliver(msg, ErrConnectionClosed)
+	}
+
+	for s.sendCh != nil {
+		select {
+		case msg, ok := <-s.sendCh:
+			if !ok {
+				return
+			}
+			deliver(msg, ErrConnectionClosed)
+		default:
+			return
+		}
+	}
+}
@@ -0,0 +1,93 @@
+package websocket_manager
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+// failingMessage is a Message whose writes wait for release, then fail with err if it is not nil.
+type failingMessage struct {
+	release chan struct{}
+	err     error
+}
+
+func (m failingMessage) Write(*websocket.Conn, time.Duration) error {
+	if m.release != nil {
+		<-m.release
+	}
+
+	return m.err
+}
+
+func (m failingMessage) Type() int {
+	return websocket.TextMessage
+}
+
+// closingTestSocket queues a message through its Conn, then closes it, before the writer starts.
+type closingTestSocket struct {
+	*testSocket
+	conn *Conn
+	msg  Message
+}
+
+func (s *closingTestSocket) SetConn(conn *Conn) {
+	s.conn = conn
+}
+
+func (s *closingTestSocket) OnConnect() {
+	_ = s.conn.Send(s.msg)
+	_ = s.conn.Close(websocket.CloseNormalClosure, "")
+}
+
+func TestDeliveryResults(t *testing.T) {
+	broken := errors.New("broken")
+
+	tests := []struct {
+		name string
+		run  func(t *testing.T, clock *FakeClock) error
+		want error
+	}{
+		{"written", func(t *testing.T, clock *FakeClock) error {
+			conn, client := startTest(t, &Config{Clock: clock, GracePeriod: time.Second}, newTestSocket())
+			_ = readAll(client)
+			return conn.SendAndWait(context.Background(), TextMessage("hello"))
+		}, nil},
+		{"write failed", func(t *testing.T, clock *FakeClock) error {
+			conn, _ := startTest(t, &Config{Clock: clock, GracePeriod: time.Second}, newTestSocket())
+			err := conn.SendAndWait(context.Background(), failingMessage{err: broken})
+			if closeErr := waitClosed(t, conn); !errors.Is(closeErr, broken) {
+				t.Fatalf("Err() = %v, want the write error", closeErr)
+			}
+			return err
+		}, ErrFailedToWrite},
+		{"expired", func(t *testing.T, clock *FakeClock) error {
+			conn, _ := startTest(t, &Config{Clock: clock, GracePeriod: time.Second}, newTestSocket())
+			return conn.SendAndWait(context.Background(), WithExpiry(TextMessage("stale"), clock.Now()))
+		}, ErrMessageExpired},
+		{"closed before written", func(t *testing.T, clock *FakeClock) error {
+			result := make(chan error, 1)
+			socket := &closingTestSocket{testSocket: newTestSocket(), msg: WithDeliveryCallback(TextMessage("late"), func(err error) { result <- err })}
+			_, _ = startTest(t, &Config{Clock: clock, GracePeriod: time.Second, SendQueueSize: 1}, socket)
+			return receive(t, result)
+		}, ErrConnectionClosed},
+		{"context done first", func(t *testing.T, clock *FakeClock) error {
+			conn, _ := startTest(t, &Config{Clock: clock, GracePeriod: time.Second}, newTestSocket())
+			release := make(chan struct{})
+			defer close(release)
+			ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+			defer cancel()
+			return conn.SendAndWait(ctx, failingMessage{release: release})
+		}, context.DeadlineExceeded},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			if err := tc.run(t, NewFakeClock(time.Unix(1000, 0))); !errors.Is(err, tc.want) {
+				t.Fatalf("delivered with %v, want %v", err, tc.want)
+			}
+		})
+	}
+}
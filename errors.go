@@ -9,18 +9,58 @@ var (
 	ErrConfigPartialPingConfiguration = errors.New("partial ping configuration")
 	ErrConfigBadPingFrequency         = errors.New("bad ping frequency")
 	ErrConfigBadGracePeriod           = errors.New("bad grace period")
+	ErrConfigBadSendQueueSize         = errors.New("bad send queue size")
+	ErrConfigBadReadLimit             = errors.New("bad read limit")
+	ErrConfigOverride                 = errors.New("bad config override")
+	ErrConfigBadIdleTimeout           = errors.New("bad idle timeout")
+	ErrConfigBadMaxLifetime           = errors.New("bad max lifetime")
+	ErrConfigBadPriorityLanes         = errors.New("bad priority lanes")
+	ErrConfigBadWriteCoalescing       = errors.New("bad write coalescing")
+	ErrConfigBadHeartbeat             = errors.New("bad heartbeat")
+	ErrConfigBadWriteTimeout          = errors.New("bad write timeout")
+	ErrConfigDecode                   = errors.New("failed to decode config")
 	ErrWriteTimeoutExceeded           = errors.New("write timeout exceeded")
 	ErrPongTimeoutExceeded            = errors.New("pong timeout exceeded")
+	ErrHeartbeatTimeoutExceeded       = errors.New("heartbeat timeout exceeded")
+	ErrIdleTimeoutExceeded            = errors.New("idle timeout exceeded")
+	ErrMaxLifetimeExceeded            = errors.New("max lifetime exceeded")
 	ErrWorkerAlreadyRun               = errors.New("worker has already run")
 	ErrWriterChannelClosed            = errors.New("writer channel closed")
 	ErrCloseMessageSent               = errors.New("close message sent")
 	ErrCloseMessageReceived           = errors.New("close message received")
+	ErrCloseHandshakeTimeout          = errors.New("close handshake timeout exceeded")
+	ErrCloseHandshakeFailed           = errors.New("close handshake failed")
 	ErrPingMessage                    = errors.New("failed to write ping message")
 	ErrFailedToWrite                  = errors.New("failed to write")
+	ErrStreamRead                     = errors.New("failed to read stream")
 	ErrConnectionClosed               = errors.New("connection closed")
+	ErrSendQueueFull                  = errors.New("send queue full")
+	ErrSendQueueOverflow              = errors.New("send queue overflow")
+	ErrMessageExpired                 = errors.New("message expired")
 	ErrFailedToRead                   = errors.New("failed to read")
+	ErrAuthTokenMissing               = errors.New("auth token missing")
+	ErrAuthTokenInvalid               = errors.New("auth token invalid")
+	ErrAuthTokenExpired               = errors.New("auth token expired")
+	ErrClientCertificateMissing       = errors.New("client certificate missing")
+	ErrClientIdentityUnmapped         = errors.New("client identity unmapped")
+	ErrFileTransferNotAttached        = errors.New("file transfer not attached to a connection")
+	ErrFileTransferInProgress         = errors.New("file transfer already in progress")
+	ErrFileTransferAborted            = errors.New("file transfer aborted")
+	ErrFileChecksumMismatch           = errors.New("file checksum mismatch")
+	ErrFileIDTooLong                  = errors.New("file id too long")
+	ErrFileIDInvalid                  = errors.New("file id invalid")
+	ErrFileNameInvalid                = errors.New("file name invalid")
+	ErrFileTooLarge                   = errors.New("file too large")
+	ErrTooManyIncomingFiles           = errors.New("too many incoming files")
+	ErrNetpollUnsupported             = errors.New("netpoll unsupported")
+	ErrNetpollClosed                  = errors.New("netpoll closed")
 )
 
+// IsCleanClose reports whether err, as returned by Run, is the result of a completed close handshake.
+func IsCleanClose(err error) bool {
+	return errors.Is(err, ErrCloseMessageSent) || errors.Is(err, ErrCloseMessageReceived)
+}
+
 func isConnectionClosedError(err error) bool {
 	return errors.Is(err, net.ErrClosed)
 }
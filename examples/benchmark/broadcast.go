@@ -0,0 +1,156 @@
+//go:build unix
+
+package main
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/gorilla/websocket"
+
+	"github.com/ktsivkov/websocket_manager"
+)
+
+// benchBroadcast broadcasts to conns in-memory connections, a share of which never drain, and reports how long the broadcasts take.
+func benchBroadcast(conns, broadcasts, size int, slow float64) error {
+	handles := make([]*websocket_manager.Conn, 0, conns)
+	netConns := make([]*memConn, 0, conns)
+	defer func() {
+		for _, c := range netConns {
+			_ = c.Close()
+		}
+		for _, h := range handles {
+			<-h.Done()
+		}
+	}()
+
+	slowEvery := 0
+	if slow > 0 {
+		slowEvery = int(1 / slow)
+	}
+	for i := range conns {
+		netConn := newMemConn()
+		netConns = append(netConns, netConn)
+		handle, err := startMemConn(netConn)
+		if err != nil {
+			return err
+		}
+		handles = append(handles, handle)
+		netConn.slow.Store(slowEvery > 0 && i%slowEvery == 0)
+	}
+
+	broadcaster := &websocket_manager.Broadcaster{Overflow: websocket_manager.OverflowDrop}
+	msg := websocket_manager.TextMessage(string(make([]byte, size)))
+	var (
+		total    websocket_manager.BroadcastResult
+		slowest  time.Duration
+		cpuStart = cpuTime()
+		start    = time.Now()
+	)
+	for range broadcasts {
+		began := time.Now()
+		res, err := broadcaster.Broadcast(context.Background(), msg, handles)
+		if err != nil {
+			return err
+		}
+		slowest = max(slowest, time.Since(began))
+		total.Queued += res.Queued
+		total.Dropped += res.Dropped
+	}
+	elapsed := time.Since(start)
+
+	fmt.Printf("broadcast %7d conns %10s/broadcast %10s slowest %10.0f msg/s %10s cpu %9d queued %7d dropped\n",
+		conns, elapsed/time.Duration(broadcasts), slowest, float64(total.Queued)/elapsed.Seconds(), cpuTime()-cpuStart, total.Queued, total.Dropped)
+
+	return nil
+}
+
+func startMemConn(netConn *memConn) (*websocket_manager.Conn, error) {
+	r, err := http.NewRequest(http.MethodGet, "http://localhost/", nil)
+	if err != nil {
+		return nil, err
+	}
+	r.Header.Set("Connection", "Upgrade")
+	r.Header.Set("Upgrade", "websocket")
+	r.Header.Set("Sec-Websocket-Version", "13")
+	r.Header.Set("Sec-Websocket-Key", "dGhlIHNhbXBsZSBub25jZQ==")
+
+	conn, err := (&websocket.Upgrader{}).Upgrade(&hijacker{conn: netConn}, r, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	return websocket_manager.Start(conn, websocket_manager.SocketCreatorFunc(func() (websocket_manager.Socket, error) {
+		return &socket{}, nil
+	}), &websocket_manager.Config{
+		GracePeriod:   time.Second,
+		SendQueueSize: 16,
+	})
+}
+
+// hijacker is an http.ResponseWriter that hands its connection over to the Upgrader.
+type hijacker struct {
+	conn   net.Conn
+	header http.Header
+}
+
+func (h *hijacker) Header() http.Header {
+	if h.header == nil {
+		h.header = make(http.Header)
+	}
+	return h.header
+}
+
+func (h *hijacker) Write(p []byte) (int, error) { return len(p), nil }
+func (h *hijacker) WriteHeader(int)             {}
+
+func (h *hijacker) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	return h.conn, bufio.NewReadWriter(bufio.NewReader(h.conn), bufio.NewWriter(h.conn)), nil
+}
+
+// memConn is an in-memory connection that discards what is written to it, or blocks the writes until it is closed if it is slow.
+type memConn struct {
+	closed chan struct{}
+	once   sync.Once
+	slow   atomic.Bool
+}
+
+func newMemConn() *memConn {
+	return &memConn{closed: make(chan struct{})}
+}
+
+func (c *memConn) Read([]byte) (int, error) {
+	<-c.closed
+	return 0, io.EOF
+}
+
+func (c *memConn) Write(p []byte) (int, error) {
+	if c.slow.Load() {
+		<-c.closed
+		return 0, net.ErrClosed
+	}
+	select {
+	case <-c.closed:
+		return 0, net.ErrClosed
+	default:
+		return len(p), nil
+	}
+}
+
+func (c *memConn) Close() error {
+	c.once.Do(func() { close(c.closed) })
+	return nil
+}
+
+func (c *memConn) LocalAddr() net.Addr              { return &net.TCPAddr{} }
+func (c *memConn) RemoteAddr() net.Addr             { return &net.TCPAddr{} }
+func (c *memConn) SetDeadline(time.Time) error      { return nil }
+func (c *memConn) SetReadDeadline(time.Time) error  { return nil }
+func (c *memConn) SetWriteDeadline(time.Time) error { return nil }
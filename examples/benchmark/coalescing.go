@@ -0,0 +1,127 @@
+//go:build unix
+
+package main
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/gorilla/websocket"
+
+	"github.com/ktsivkov/websocket_manager"
+)
+
+// benchCoalescing compares sending count small messages over a single connection with and without write coalescing.
+func benchCoalescing(count, size int) error {
+	payload := strings.Repeat("x", size)
+	runs := []struct {
+		coalescing *websocket_manager.Coalescing
+		name       string
+	}{
+		{name: "no coalescing"},
+		{name: "coalescing", coalescing: &websocket_manager.Coalescing{}},
+		{name: "coalescing 1ms", coalescing: &websocket_manager.Coalescing{MaxDelay: time.Millisecond}},
+	}
+	for _, run := range runs {
+		res, err := coalescingRun(run.coalescing, count, payload)
+		if err != nil {
+			return err
+		}
+		fmt.Printf("%-16s %10.0f msg/s %8.3f writes/msg %10s cpu\n", run.name, float64(count)/res.elapsed.Seconds(), float64(res.writes)/float64(count), res.cpu)
+	}
+
+	return nil
+}
+
+type result struct {
+	elapsed time.Duration
+	cpu     time.Duration
+	writes  int64
+}
+
+func coalescingRun(coalescing *websocket_manager.Coalescing, count int, payload string) (*result, error) {
+	var writes atomic.Int64
+	started := make(chan *websocket_manager.Conn, 1)
+	srv := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		conn, err := (&websocket.Upgrader{}).Upgrade(w, r, nil)
+		if err != nil {
+			return
+		}
+		handle, err := websocket_manager.Start(conn, websocket_manager.SocketCreatorFunc(func() (websocket_manager.Socket, error) {
+			return &socket{}, nil
+		}), &websocket_manager.Config{
+			GracePeriod:     time.Second,
+			SendQueueSize:   1024,
+			WriteCoalescing: coalescing,
+		})
+		if err != nil {
+			panic(err)
+		}
+		started <- handle
+	}))
+	srv.Listener = &countingListener{Listener: srv.Listener, writes: &writes}
+	srv.Start()
+	defer srv.Close()
+
+	client, _, err := websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(srv.URL, "http"), nil)
+	if err != nil {
+		return nil, err
+	}
+	defer client.Close()
+	handle := <-started
+
+	cpuBefore := cpuTime()
+	writesBefore := writes.Load()
+	start := time.Now()
+	go func() {
+		for range count {
+			if err := handle.Send(websocket_manager.TextMessage(payload)); err != nil {
+				return
+			}
+		}
+	}()
+	for range count {
+		if _, _, err := client.ReadMessage(); err != nil {
+			return nil, err
+		}
+	}
+	res := &result{
+		elapsed: time.Since(start),
+		cpu:     cpuTime() - cpuBefore,
+		writes:  writes.Load() - writesBefore,
+	}
+	_ = handle.Close(websocket.CloseNormalClosure, "")
+	<-handle.Done()
+
+	return res, nil
+}
+
+// countingListener counts the writes to the connections it accepts.
+type countingListener struct {
+	net.Listener
+	writes *atomic.Int64
+}
+
+func (l *countingListener) Accept() (net.Conn, error) {
+	conn, err := l.Listener.Accept()
+	if err != nil {
+		return nil, err
+	}
+
+	return &countingConn{Conn: conn, writes: l.writes}, nil
+}
+
+type countingConn struct {
+	net.Conn
+	writes *atomic.Int64
+}
+
+func (c *countingConn) Write(p []byte) (int, error) {
+	c.writes.Add(1)
+	return c.Conn.Write(p)
+}
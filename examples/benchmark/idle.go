@@ -0,0 +1,151 @@
+//go:build unix
+
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"runtime"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gorilla/websocket"
+
+	"github.com/ktsivkov/websocket_manager"
+)
+
+// benchIdle opens conns idle connections with the goroutine per connection engine and with the Netpoll one, and reports the goroutines and memory they hold.
+// Each engine runs with Sockets without a WriterChannel, and with Sockets with a WriterChannel and priority lanes.
+// The clients are raw TCP connections of the same process, their cost is the same for both engines.
+func benchIdle(conns int) error {
+	for _, netpoll := range []bool{false, true} {
+		for _, writer := range []bool{false, true} {
+			if err := idleRun(netpoll, writer, conns); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+// writerSocket is a socket with a WriterChannel and two priority lanes, which are never written to.
+// With Netpoll, each of its connections holds the goroutine relaying the channels to the writer.
+type writerSocket struct {
+	socket
+	ch, high, bulk chan websocket_manager.Message
+}
+
+func (s *writerSocket) WriterChannel() <-chan websocket_manager.Message { return s.ch }
+
+func (s *writerSocket) PriorityChannels() map[websocket_manager.Priority]<-chan websocket_manager.Message {
+	return map[websocket_manager.Priority]<-chan websocket_manager.Message{
+		websocket_manager.PriorityHigh: s.high,
+		websocket_manager.PriorityBulk: s.bulk,
+	}
+}
+
+func idleRun(netpoll, writer bool, conns int) error {
+	name, start := "goroutines", websocket_manager.Start
+	if netpoll {
+		poll, err := websocket_manager.NewNetpoll()
+		if err != nil {
+			return err
+		}
+		defer poll.Close()
+		name, start = "netpoll", poll.Start
+	}
+	newSocket := func() websocket_manager.Socket { return &socket{} }
+	if writer {
+		name += "+writer"
+		newSocket = func() websocket_manager.Socket {
+			return &writerSocket{
+				ch:   make(chan websocket_manager.Message),
+				high: make(chan websocket_manager.Message),
+				bulk: make(chan websocket_manager.Message),
+			}
+		}
+	}
+
+	started := make(chan *websocket_manager.Conn, conns)
+	// The read buffer of the websocket.Conn is unused by Netpoll and the write buffer is only borrowed while writing, see Netpoll.
+	upgrader := &websocket.Upgrader{WriteBufferPool: &sync.Pool{}, ReadBufferSize: 256}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		conn, err := upgrader.Upgrade(w, r, nil)
+		if err != nil {
+			return
+		}
+		handle, err := start(conn, websocket_manager.SocketCreatorFunc(func() (websocket_manager.Socket, error) {
+			return newSocket(), nil
+		}), &websocket_manager.Config{GracePeriod: time.Second, WriteTimeout: 10 * time.Second})
+		if err != nil {
+			panic(err)
+		}
+		started <- handle
+	}))
+	defer srv.Close()
+
+	var before, after runtime.MemStats
+	runtime.GC()
+	runtime.ReadMemStats(&before)
+	goroutines := runtime.NumGoroutine()
+
+	clients := make([]net.Conn, 0, conns)
+	handles := make([]*websocket_manager.Conn, 0, conns)
+	defer func() {
+		for _, c := range clients {
+			_ = c.Close()
+		}
+		for _, h := range handles {
+			<-h.Done()
+		}
+	}()
+	for range conns {
+		client, err := dialRaw(srv.Listener.Addr().String())
+		if err != nil {
+			return err
+		}
+		clients = append(clients, client)
+		handles = append(handles, <-started)
+	}
+
+	time.Sleep(100 * time.Millisecond) // Lets the server handlers return.
+	runtime.GC()
+	runtime.ReadMemStats(&after)
+	held := (after.HeapInuse + after.StackInuse) - (before.HeapInuse + before.StackInuse)
+	fmt.Printf("idle %-17s %7d conns %8.2f goroutines/conn %10.0f B/conn\n",
+		name, conns, float64(runtime.NumGoroutine()-goroutines)/float64(conns), float64(held)/float64(conns))
+
+	return nil
+}
+
+// dialRaw opens a websocket connection to addr without a websocket.Conn on the client side, so that the client holds no buffers.
+func dialRaw(addr string) (net.Conn, error) {
+	conn, err := net.Dial("tcp", addr)
+	if err != nil {
+		return nil, err
+	}
+
+	request := "GET / HTTP/1.1\r\nHost: " + addr + "\r\nConnection: Upgrade\r\nUpgrade: websocket\r\n" +
+		"Sec-WebSocket-Version: 13\r\nSec-WebSocket-Key: dGhlIHNhbXBsZSBub25jZQ==\r\n\r\n"
+	if _, err := conn.Write([]byte(request)); err != nil {
+		_ = conn.Close()
+		return nil, err
+	}
+
+	resp, err := http.ReadResponse(bufio.NewReader(conn), nil)
+	if err != nil {
+		_ = conn.Close()
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusSwitchingProtocols {
+		_ = conn.Close()
+		return nil, fmt.Errorf("unexpected handshake status %s", strings.TrimSpace(resp.Status))
+	}
+
+	return conn, nil
+}
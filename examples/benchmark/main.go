@@ -0,0 +1,70 @@
+//go:build unix
+
+// Benchmark measures the throughput and CPU time of write coalescing and broadcasting, the allocations of the pooled read and write paths, and the cost of idle connections with and without Netpoll.
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/ktsivkov/websocket_manager"
+)
+
+func main() {
+	bench := flag.String("bench", "coalescing,broadcast,pooling,idle", "comma separated benchmarks to run")
+	count := flag.Int("messages", 200000, "messages to send per coalescing and pooling run")
+	size := flag.Int("size", 64, "payload size of the messages")
+	conns := flag.String("conns", "10000,100000", "comma separated connection counts of the broadcast runs")
+	broadcasts := flag.Int("broadcasts", 200, "broadcasts per broadcast run")
+	slow := flag.Float64("slow", 0.01, "share of the broadcast connections that never drain")
+	idle := flag.Int("idle", 5000, "connections per idle run")
+	flag.Parse()
+
+	for _, name := range strings.Split(*bench, ",") {
+		var err error
+		switch name {
+		case "coalescing":
+			err = benchCoalescing(*count, *size)
+		case "pooling":
+			err = benchPooling(*count, *size)
+		case "idle":
+			err = benchIdle(*idle)
+		case "broadcast":
+			for _, field := range strings.Split(*conns, ",") {
+				n, convErr := strconv.Atoi(field)
+				if convErr != nil {
+					err = convErr
+					break
+				}
+				if err = benchBroadcast(n, *broadcasts, *size, *slow); err != nil {
+					break
+				}
+			}
+		default:
+			err = fmt.Errorf("unknown benchmark %q", name)
+		}
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+	}
+}
+
+// cpuTime returns the user and system CPU time used by the process so far.
+func cpuTime() time.Duration {
+	var usage syscall.Rusage
+	_ = syscall.Getrusage(syscall.RUSAGE_SELF, &usage)
+	return time.Duration(usage.Utime.Nano() + usage.Stime.Nano())
+}
+
+type socket struct{}
+
+func (s *socket) OnConnect()                                         {}
+func (s *socket) OnDisconnect(*websocket_manager.ClientCloseMessage) {}
+func (s *socket) OnMessage([]byte)                                   {}
+func (s *socket) WriterChannel() <-chan websocket_manager.Message    { return nil }
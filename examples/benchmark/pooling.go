@@ -0,0 +1,195 @@
+//go:build unix
+
+package main
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"runtime"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gorilla/websocket"
+
+	"github.com/ktsivkov/websocket_manager"
+)
+
+// benchPooling compares the allocations per message of the default and pooled read and write paths over a single connection.
+// The allocations of the client are included, they are the same for both paths.
+func benchPooling(count, size int) error {
+	payload := []byte(strings.Repeat("x", size))
+	for _, pooled := range []bool{false, true} {
+		name := "read"
+		if pooled {
+			name = "read pooled"
+		}
+		res, err := poolingReadRun(pooled, count, payload)
+		if err != nil {
+			return err
+		}
+		res.print(name, count)
+	}
+
+	for _, pooled := range []bool{false, true} {
+		name := "write"
+		if pooled {
+			name = "write pooled"
+		}
+		res, err := poolingWriteRun(pooled, count, payload)
+		if err != nil {
+			return err
+		}
+		res.print(name, count)
+	}
+
+	return nil
+}
+
+type allocResult struct {
+	elapsed time.Duration
+	mallocs uint64
+	bytes   uint64
+}
+
+func (r *allocResult) print(name string, count int) {
+	fmt.Printf("%-16s %10.0f msg/s %8.2f allocs/msg %10.1f B/msg\n", name, float64(count)/r.elapsed.Seconds(), float64(r.mallocs)/float64(count), float64(r.bytes)/float64(count))
+}
+
+// measure runs fn and reports its duration and the allocations of the process meanwhile.
+func measure(fn func() error) (*allocResult, error) {
+	var before, after runtime.MemStats
+	runtime.GC()
+	runtime.ReadMemStats(&before)
+	start := time.Now()
+	if err := fn(); err != nil {
+		return nil, err
+	}
+	elapsed := time.Since(start)
+	runtime.ReadMemStats(&after)
+
+	return &allocResult{elapsed: elapsed, mallocs: after.Mallocs - before.Mallocs, bytes: after.TotalAlloc - before.TotalAlloc}, nil
+}
+
+// countingSocket counts the messages it receives, through OnMessage or OnPooledMessage if pooled.
+type countingSocket struct {
+	socket
+	received *sync.WaitGroup
+}
+
+func (s *countingSocket) OnMessage([]byte) {
+	s.received.Done()
+}
+
+type pooledCountingSocket struct {
+	countingSocket
+}
+
+func (s *pooledCountingSocket) OnPooledMessage(buf *websocket_manager.Buffer) {
+	buf.Release()
+	s.received.Done()
+}
+
+func poolingReadRun(pooled bool, count int, payload []byte) (*allocResult, error) {
+	var received sync.WaitGroup
+	received.Add(count)
+	var sock websocket_manager.Socket = &countingSocket{received: &received}
+	if pooled {
+		sock = &pooledCountingSocket{countingSocket{received: &received}}
+	}
+
+	handle, client, closeServer, err := dialPooling(&websocket.Upgrader{}, sock)
+	if err != nil {
+		return nil, err
+	}
+	defer closeServer()
+	defer client.Close()
+
+	msg, err := websocket.NewPreparedMessage(websocket.BinaryMessage, payload)
+	if err != nil {
+		return nil, err
+	}
+	res, err := measure(func() error {
+		for range count {
+			if err := client.WritePreparedMessage(msg); err != nil {
+				return err
+			}
+		}
+		received.Wait()
+		return nil
+	})
+	_ = handle.Close(websocket.CloseNormalClosure, "")
+
+	return res, err
+}
+
+func poolingWriteRun(pooled bool, count int, payload []byte) (*allocResult, error) {
+	upgrader := &websocket.Upgrader{}
+	if pooled {
+		upgrader.WriteBufferPool = &sync.Pool{}
+	}
+	handle, client, closeServer, err := dialPooling(upgrader, &socket{})
+	if err != nil {
+		return nil, err
+	}
+	defer closeServer()
+	defer client.Close()
+
+	res, err := measure(func() error {
+		go func() {
+			for range count {
+				var msg websocket_manager.Message
+				if pooled {
+					msg = websocket_manager.UnpreparedMessage(websocket.BinaryMessage, payload)
+				} else {
+					msg = websocket_manager.BinaryMessage(payload)
+				}
+				if err := handle.Send(msg); err != nil {
+					return
+				}
+			}
+		}()
+		for range count {
+			_, r, err := client.NextReader()
+			if err != nil {
+				return err
+			}
+			_, _ = io.Copy(io.Discard, r)
+		}
+		return nil
+	})
+	_ = handle.Close(websocket.CloseNormalClosure, "")
+
+	return res, err
+}
+
+// dialPooling starts a connection running sock and returns its handle, the client side and a function that stops the server.
+func dialPooling(upgrader *websocket.Upgrader, sock websocket_manager.Socket) (*websocket_manager.Conn, *websocket.Conn, func(), error) {
+	started := make(chan *websocket_manager.Conn, 1)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		conn, err := upgrader.Upgrade(w, r, nil)
+		if err != nil {
+			return
+		}
+		handle, err := websocket_manager.Start(conn, websocket_manager.SocketCreatorFunc(func() (websocket_manager.Socket, error) {
+			return sock, nil
+		}), &websocket_manager.Config{
+			GracePeriod:   time.Second,
+			SendQueueSize: 1024,
+		})
+		if err != nil {
+			panic(err)
+		}
+		started <- handle
+	}))
+
+	client, _, err := websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(srv.URL, "http"), nil)
+	if err != nil {
+		srv.Close()
+		return nil, nil, nil, err
+	}
+
+	return <-started, client, srv.Close, nil
+}
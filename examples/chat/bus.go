@@ -17,6 +17,7 @@ var (
 )
 
 type Bus struct {
+	broadcaster *websocket_manager.Broadcaster
 	clients     *sync.Map
 	wg          *sync.WaitGroup
 	activeCount *atomic.Uint64
@@ -24,6 +25,7 @@ type Bus struct {
 
 func NewBus() *Bus {
 	return &Bus{
+		broadcaster: &websocket_manager.Broadcaster{Overflow: websocket_manager.OverflowDrop},
 		clients:     &sync.Map{},
 		wg:          &sync.WaitGroup{},
 		activeCount: &atomic.Uint64{},
@@ -39,15 +41,19 @@ func (b *Bus) Notify(target string, msg websocket_manager.Message) error {
 	return nil
 }
 
-func (b *Bus) NotifyAll(msg websocket_manager.Message, filtered ...string) {
+func (b *Bus) NotifyAll(msg websocket_manager.Message, filtered ...string) websocket_manager.BroadcastResult {
+	conns := make([]*websocket_manager.Conn, 0)
 	b.clients.Range(func(key, value interface{}) bool {
 		if slices.Contains(filtered, key.(string)) {
 			return true
 		}
 
-		value.(*Client).SendMessage(msg)
+		conns = append(conns, value.(*Client).Conn())
 		return true
 	})
+
+	res, _ := b.broadcaster.Broadcast(context.Background(), msg, conns)
+	return res
 }
 
 func (b *Bus) Subscribe(client *Client) error {
@@ -23,12 +23,27 @@ func NewClient(ctx context.Context, logger *slog.Logger, username string, bus *B
 
 type Client struct {
 	ctx          context.Context
+	conn         *websocket_manager.Conn
 	logger       *slog.Logger
 	bus          *Bus
 	writeChannel chan websocket_manager.Message
 	username     string
 }
 
+func (c *Client) SetConn(conn *websocket_manager.Conn) {
+	c.conn = conn
+	c.ctx = websocket_manager.ContextWithConn(c.ctx, conn)
+	c.logger = conn.Logger()
+}
+
+func (c *Client) LogAttrs() []slog.Attr {
+	return []slog.Attr{slog.String("username", c.username)}
+}
+
+func (c *Client) Conn() *websocket_manager.Conn {
+	return c.conn
+}
+
 func (c *Client) OnConnect() {
 	if err := c.bus.Subscribe(c); err != nil {
 		if errors.Is(err, ErrUsernameTaken) {
@@ -47,25 +62,17 @@ func (c *Client) OnConnect() {
 		return
 	}
 
-	c.logger.InfoContext(c.ctx, "client connected")
-
 	go c.sendListOfActiveClients()
 	go c.notifyAllForConnection()
 }
 
 func (c *Client) OnDisconnect(msg *websocket_manager.ClientCloseMessage) {
-	if msg != nil {
-		c.logger.InfoContext(c.ctx, "closing websocket connection upon a client request", "code", msg.Code, "text", msg.Text)
-	}
-
 	defer close(c.writeChannel)
 
 	if err := c.bus.Unsubscribe(c); err != nil {
 		c.logger.ErrorContext(c.ctx, "failed to unsubscribe", "error", err)
 	}
 
-	c.logger.InfoContext(c.ctx, "client disconnected")
-
 	go c.notifyAllForDisconnection()
 }
 
@@ -95,7 +102,9 @@ func (c *Client) OnMessage(payload []byte) {
 
 	switch req.To {
 	case "":
-		c.bus.NotifyAll(msg)
+		if res := c.bus.NotifyAll(msg); res.Dropped > 0 {
+			c.logger.WarnContext(c.ctx, "message dropped for slow clients", "dropped", res.Dropped, "queued", res.Queued)
+		}
 	default:
 		err := c.bus.Notify(req.To, msg)
 		if err != nil {
@@ -53,13 +53,16 @@ func main() {
 
 		go func() {
 			err := websocket_manager.Run(conn, websocket_manager.SocketCreatorFunc(func() (websocket_manager.Socket, error) {
-				return NewClient(context.WithValue(ctx, "username", username), logger, username, bus), nil
+				return NewClient(ctx, logger, username, bus), nil
 			}), &websocket_manager.Config{
 				PingMessage:   websocket_manager.PingMessage(nil),
 				PingFrequency: 3 * time.Second,
 				PongTimeout:   7 * time.Second,
 				WriteTimeout:  3 * time.Second,
 				GracePeriod:   5 * time.Second,
+				SendQueueSize: 64,
+				Logger:        logger,
+				CloseFrames:   websocket_manager.DefaultCloseFrames(),
 			})
 			if err != nil {
 				logger.ErrorContext(ctx, "websocket connection failed", "error", err)
@@ -0,0 +1,66 @@
+package websocket_manager
+
+import (
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+// ExpiryHandler can optionally be implemented by a Socket to observe the messages dropped because they expired before they could be written.
+type ExpiryHandler interface {
+	// OnExpired will be called from the writer goroutine with the dropped message, as it was sent.
+	// It should finish quickly since the writer waits for it.
+	OnExpired(msg Message)
+}
+
+// WithExpiry wraps msg so that it is dropped instead of written if it is still queued at expiresAt, according to the Config.Clock.
+// Use it for messages that are worthless once stale, e.g. price ticks or typing indicators, so that slow clients catch up on fresh data.
+// Close messages never expire.
+func WithExpiry(msg Message, expiresAt time.Time) Message {
+	return &expiringMessage{Message: msg, expiresAt: expiresAt}
+}
+
+// WithTTL wraps msg so that it is dropped instead of written if it is still queued ttl after now.
+// It measures ttl against the real time, use WithExpiry along with the Config.Clock otherwise.
+func WithTTL(msg Message, ttl time.Duration) Message {
+	return WithExpiry(msg, time.Now().Add(ttl))
+}
+
+type expiringMessage struct {
+	Message
+	expiresAt time.Time
+}
+
+func (m *expiringMessage) Unwrap() Message {
+	return m.Message
+}
+
+func (m *expiringMessage) ExpiresAt() time.Time {
+	return m.expiresAt
+}
+
+// next pops the next message to write from the outbox, dropping the expired ones, or returns nil if the outbox is empty.
+func (w *worker) next(s *writerState) Message {
+	for {
+		msg := s.out.pop()
+		if msg == nil || !w.expired(msg) {
+			return msg
+		}
+	}
+}
+
+// expired reports whether msg expired, in which case it is counted and reported to the ExpiryHandler.
+func (w *worker) expired(msg Message) bool {
+	expiring, ok := messageAs[interface{ ExpiresAt() time.Time }](msg)
+	if !ok || msg.Type() == websocket.CloseMessage || w.clock.Now().Before(expiring.ExpiresAt()) {
+		return false
+	}
+
+	w.stats.messageExpired()
+	deliver(msg, ErrMessageExpired)
+	if handler, ok := socketAs[ExpiryHandler](w.socket); ok {
+		handler.OnExpired(msg)
+	}
+
+	return true
+}
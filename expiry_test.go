@@ -0,0 +1,89 @@
+package websocket_manager
+
+import (
+	"errors"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+// expiryTestSocket queues its messages before the writer starts, then moves its clock forward.
+type expiryTestSocket struct {
+	*testSocket
+	clock   *FakeClock
+	queue   []Message
+	expired chan Message
+}
+
+func (s *expiryTestSocket) OnConnect() {
+	for _, msg := range s.queue {
+		s.writer <- msg
+	}
+	s.clock.Advance(time.Minute)
+}
+
+func (s *expiryTestSocket) OnExpired(msg Message) {
+	s.expired <- msg
+}
+
+func TestMessageExpiry(t *testing.T) {
+	start := time.Unix(1000, 0)
+	tests := []struct {
+		name string
+		msg  Message
+		// wantErr is the delivery result of the message, the messages delivered with nil are written.
+		wantErr error
+	}{
+		{"stale", WithExpiry(TextMessage("stale"), start.Add(30*time.Second)), ErrMessageExpired},
+		{"fresh", WithExpiry(TextMessage("fresh"), start.Add(90*time.Second)), nil},
+		{"at its expiry", WithExpiry(TextMessage("at its expiry"), start.Add(time.Minute)), ErrMessageExpired},
+		{"without expiry", TextMessage("without expiry"), nil},
+		{"close", WithExpiry(CloseMessage(4000, "bye"), start), nil},
+	}
+
+	clock := NewFakeClock(start)
+	results := make([]chan error, len(tests))
+	inner := newTestSocket()
+	inner.writer = make(chan Message, len(tests))
+	socket := &expiryTestSocket{testSocket: inner, clock: clock, expired: make(chan Message, len(tests))}
+	for i, tc := range tests {
+		results[i] = make(chan error, 1)
+		socket.queue = append(socket.queue, WithDeliveryCallback(tc.msg, func(err error) { results[i] <- err }))
+	}
+	conn, client := startTest(t, &Config{Clock: clock, GracePeriod: time.Second}, socket)
+
+	var written []string
+	for {
+		_, payload, err := client.ReadMessage()
+		if err != nil {
+			// Close messages never expire.
+			if !websocket.IsCloseError(err, 4000) {
+				t.Fatalf("read: %v, want the close message", err)
+			}
+			break
+		}
+		written = append(written, string(payload))
+	}
+	if want := []string{"fresh", "without expiry"}; !slices.Equal(written, want) {
+		t.Fatalf("written %q, want %q", written, want)
+	}
+
+	for i, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			if err := receive(t, results[i]); !errors.Is(err, tc.wantErr) {
+				t.Fatalf("delivered with %v, want %v", err, tc.wantErr)
+			}
+		})
+	}
+	for _, want := range []Message{socket.queue[0], socket.queue[2]} {
+		if got := receive(t, socket.expired); got != want {
+			t.Fatalf("OnExpired(%v), want the message as sent %v", got, want)
+		}
+	}
+	_ = waitClosed(t, conn)
+	if stats := conn.Stats(); stats.MessagesExpired != 2 {
+		t.Fatalf("MessagesExpired = %d, want 2", stats.MessagesExpired)
+	}
+}
@@ -0,0 +1,204 @@
+package websocket_manager
+
+import (
+	"sync"
+	"time"
+)
+
+// FakeClock is a Clock whose time only moves when Advance is called, it lets tests trigger pings, pong timeouts,
+// grace period expiries and idle closes without waiting.
+// It is safe for concurrent use.
+type FakeClock struct {
+	now     time.Time
+	waiters []*fakeWaiter
+	// changed is closed and replaced every time a timer or ticker is started or stopped, see BlockUntil.
+	changed chan struct{}
+	mu      sync.Mutex
+}
+
+// NewFakeClock creates a FakeClock that starts at now.
+func NewFakeClock(now time.Time) *FakeClock {
+	return &FakeClock{now: now, changed: make(chan struct{})}
+}
+
+func (c *FakeClock) Now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.now
+}
+
+func (c *FakeClock) NewTimer(d time.Duration) Timer {
+	return c.start(&fakeWaiter{clock: c, ch: make(chan time.Time, 1)}, d)
+}
+
+func (c *FakeClock) NewTicker(d time.Duration) Ticker {
+	if d <= 0 {
+		panic("non-positive interval for FakeClock.NewTicker")
+	}
+
+	return fakeTicker{w: c.start(&fakeWaiter{clock: c, ch: make(chan time.Time, 1), period: d}, d)}
+}
+
+func (c *FakeClock) AfterFunc(d time.Duration, f func()) Timer {
+	return c.start(&fakeWaiter{clock: c, fn: f}, d)
+}
+
+// Advance moves the time forward by d, firing the timers and tickers that are due along the way in order.
+// A ticker fires at most once per Advance if its channel is not drained in between, like a time.Ticker that falls behind.
+func (c *FakeClock) Advance(d time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	until := c.now.Add(d)
+	for {
+		next := c.nextDue(until)
+		if next == nil {
+			break
+		}
+
+		c.now = next.at
+		next.fire()
+	}
+	c.now = until
+}
+
+// Waiters returns the count of active timers and tickers.
+func (c *FakeClock) Waiters() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return len(c.waiters)
+}
+
+// BlockUntil waits until at least n timers and tickers are active, e.g. until a connection set up its timers before calling Advance.
+func (c *FakeClock) BlockUntil(n int) {
+	for {
+		c.mu.Lock()
+		count, changed := len(c.waiters), c.changed
+		c.mu.Unlock()
+		if count >= n {
+			return
+		}
+		<-changed
+	}
+}
+
+func (c *FakeClock) start(w *fakeWaiter, d time.Duration) *fakeWaiter {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	w.at = c.now.Add(d)
+	c.add(w)
+	return w
+}
+
+// nextDue returns the active waiter that is due first, not later than until.
+func (c *FakeClock) nextDue(until time.Time) *fakeWaiter {
+	var next *fakeWaiter
+	for _, w := range c.waiters {
+		if !w.at.After(until) && (next == nil || w.at.Before(next.at)) {
+			next = w
+		}
+	}
+
+	return next
+}
+
+func (c *FakeClock) add(w *fakeWaiter) {
+	c.waiters = append(c.waiters, w)
+	c.notify()
+}
+
+// remove reports whether w was active.
+func (c *FakeClock) remove(w *fakeWaiter) bool {
+	for i, waiter := range c.waiters {
+		if waiter == w {
+			c.waiters = append(c.waiters[:i], c.waiters[i+1:]...)
+			c.notify()
+			return true
+		}
+	}
+
+	return false
+}
+
+func (c *FakeClock) notify() {
+	close(c.changed)
+	c.changed = make(chan struct{})
+}
+
+// fakeWaiter is a timer, a ticker if it has a period, or the timer of an AfterFunc if it has a fn.
+type fakeWaiter struct {
+	clock  *FakeClock
+	at     time.Time
+	ch     chan time.Time
+	fn     func()
+	period time.Duration
+}
+
+// fire is called with the clock locked once the waiter is due.
+func (w *fakeWaiter) fire() {
+	at := w.at
+	if w.period > 0 {
+		w.at = w.at.Add(w.period)
+	} else {
+		w.clock.remove(w)
+	}
+
+	if w.fn != nil {
+		go w.fn()
+		return
+	}
+	select {
+	case w.ch <- at:
+	default:
+	}
+}
+
+func (w *fakeWaiter) C() <-chan time.Time {
+	return w.ch
+}
+
+func (w *fakeWaiter) Stop() bool {
+	w.clock.mu.Lock()
+	defer w.clock.mu.Unlock()
+	w.drain()
+	return w.clock.remove(w)
+}
+
+// Reset of a ticker also changes its period, like time.Ticker.Reset.
+func (w *fakeWaiter) Reset(d time.Duration) bool {
+	w.clock.mu.Lock()
+	defer w.clock.mu.Unlock()
+	w.drain()
+	active := w.clock.remove(w)
+	if w.period > 0 {
+		w.period = d
+	}
+	w.at = w.clock.now.Add(d)
+	w.clock.add(w)
+	return active
+}
+
+type fakeTicker struct {
+	w *fakeWaiter
+}
+
+func (t fakeTicker) C() <-chan time.Time {
+	return t.w.C()
+}
+
+func (t fakeTicker) Stop() {
+	t.w.Stop()
+}
+
+func (t fakeTicker) Reset(d time.Duration) {
+	if d <= 0 {
+		panic("non-positive interval for Ticker.Reset")
+	}
+	t.w.Reset(d)
+}
+
+func (w *fakeWaiter) drain() {
+	select {
+	case <-w.ch:
+	default:
+	}
+}
@@ -0,0 +1,149 @@
+package websocket_manager
+
+import (
+	"testing"
+	"time"
+)
+
+// fired reports whether a value is ready on ch, without waiting.
+func fired(ch <-chan time.Time) bool {
+	select {
+	case <-ch:
+		return true
+	default:
+		return false
+	}
+}
+
+func TestFakeClockTimers(t *testing.T) {
+	start := time.Unix(1000, 0)
+
+	tests := []struct {
+		name string
+		run  func(t *testing.T, clock *FakeClock)
+	}{
+		{"timer fires once due", func(t *testing.T, clock *FakeClock) {
+			timer := clock.NewTimer(time.Minute)
+			clock.Advance(time.Minute - time.Nanosecond)
+			if fired(timer.C()) {
+				t.Fatal("the timer fired early")
+			}
+			clock.Advance(time.Nanosecond)
+			if !fired(timer.C()) {
+				t.Fatal("the timer did not fire")
+			}
+			if clock.Waiters() != 0 {
+				t.Fatalf("Waiters() = %d after the timer fired, want 0", clock.Waiters())
+			}
+		}},
+		{"stopped timer does not fire", func(t *testing.T, clock *FakeClock) {
+			timer := clock.NewTimer(time.Minute)
+			if !timer.Stop() {
+				t.Fatal("Stop of an active timer = false")
+			}
+			clock.Advance(time.Hour)
+			if fired(timer.C()) {
+				t.Fatal("the stopped timer fired")
+			}
+			if timer.Stop() {
+				t.Fatal("Stop of a stopped timer = true")
+			}
+		}},
+		{"reset drops the stale value", func(t *testing.T, clock *FakeClock) {
+			timer := clock.NewTimer(time.Minute)
+			clock.Advance(time.Minute)
+			if timer.Reset(time.Minute) {
+				t.Fatal("Reset of a fired timer = true")
+			}
+			if fired(timer.C()) {
+				t.Fatal("a stale value was received after Reset")
+			}
+			clock.Advance(time.Minute)
+			if !fired(timer.C()) {
+				t.Fatal("the reset timer did not fire")
+			}
+		}},
+		{"ticker fires every period", func(t *testing.T, clock *FakeClock) {
+			ticker := clock.NewTicker(time.Minute)
+			defer ticker.Stop()
+			for i := range 3 {
+				clock.Advance(time.Minute)
+				select {
+				case at := <-ticker.C():
+					if want := start.Add(time.Duration(i+1) * time.Minute); !at.Equal(want) {
+						t.Fatalf("tick %d at %v, want %v", i, at, want)
+					}
+				default:
+					t.Fatalf("tick %d missing", i)
+				}
+			}
+		}},
+		{"ticker falls behind", func(t *testing.T, clock *FakeClock) {
+			ticker := clock.NewTicker(time.Minute)
+			defer ticker.Stop()
+			clock.Advance(5 * time.Minute)
+			if !fired(ticker.C()) || fired(ticker.C()) {
+				t.Fatal("an undrained ticker did not deliver a single tick")
+			}
+		}},
+		{"ticker reset changes the period", func(t *testing.T, clock *FakeClock) {
+			ticker := clock.NewTicker(time.Minute)
+			defer ticker.Stop()
+			ticker.Reset(time.Hour)
+			clock.Advance(time.Minute)
+			if fired(ticker.C()) {
+				t.Fatal("the ticker fired at its previous period")
+			}
+			clock.Advance(time.Hour - time.Minute)
+			if !fired(ticker.C()) {
+				t.Fatal("the ticker did not fire at its new period")
+			}
+		}},
+		{"AfterFunc", func(t *testing.T, clock *FakeClock) {
+			called := make(chan time.Time, 1)
+			clock.AfterFunc(time.Minute, func() { called <- clock.Now() })
+			stopped := clock.AfterFunc(time.Minute, func() { t.Error("a stopped AfterFunc was called") })
+			stopped.Stop()
+			clock.Advance(time.Hour)
+			if at := receive(t, called); !at.Equal(start.Add(time.Hour)) {
+				t.Fatalf("Now() = %v in the AfterFunc, want %v", at, start.Add(time.Hour))
+			}
+		}},
+		{"timers fire in order", func(t *testing.T, clock *FakeClock) {
+			order := make(chan int, 3)
+			for _, i := range []int{3, 1, 2} {
+				timer := clock.NewTimer(time.Duration(i) * time.Minute)
+				go func() {
+					<-timer.C()
+					order <- i
+				}()
+			}
+			for i := 1; i <= 3; i++ {
+				clock.Advance(time.Minute)
+				if got := receive(t, order); got != i {
+					t.Fatalf("timer %d fired, want %d", got, i)
+				}
+			}
+		}},
+		{"BlockUntil", func(t *testing.T, clock *FakeClock) {
+			blocked := make(chan struct{})
+			go func() {
+				clock.BlockUntil(2)
+				close(blocked)
+			}()
+			clock.NewTimer(time.Minute)
+			select {
+			case <-blocked:
+				t.Fatal("BlockUntil(2) returned with a single timer")
+			case <-time.After(10 * time.Millisecond):
+			}
+			clock.NewTicker(time.Minute)
+			_ = receive(t, blocked)
+		}},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			tc.run(t, NewFakeClock(start))
+		})
+	}
+}
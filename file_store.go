@@ -0,0 +1,183 @@
+package websocket_manager
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// NewDirFileStore creates a FileStore that keeps partial files in a directory of dir per FileOffer.Owner, and commits them to dir under their offered name.
+// A partial file is only opened by one connection at a time, offers of a file that is already open fail with ErrFileTransferInProgress.
+// Committing a file never replaces another file, it fails if the name is taken or ends with the .part or .checkpoint extensions of the partial files.
+// File IDs may only contain ASCII letters, digits, '-', '_' and '.', and must not start with a '.'.
+func NewDirFileStore(dir string) FileStore {
+	return &dirFileStore{dir: dir, open: make(map[string]struct{})}
+}
+
+type dirFileStore struct {
+	dir string
+	// open holds the paths of the partial files in use.
+	open map[string]struct{}
+	mu   sync.Mutex
+}
+
+func (s *dirFileStore) Open(offer FileOffer) (FilePart, int64, error) {
+	if !isSafeFileID(offer.ID) {
+		return nil, 0, fmt.Errorf("%w: %q", ErrFileIDInvalid, offer.ID)
+	}
+
+	// The Owner is hashed, so that any Owner makes a safe directory name.
+	owner := sha256.Sum256([]byte(offer.Owner))
+	dir := filepath.Join(s.dir, ".partial", hex.EncodeToString(owner[:16]))
+	path := filepath.Join(dir, offer.ID+".part")
+	if !s.lock(path) {
+		return nil, 0, fmt.Errorf("%w: %s", ErrFileTransferInProgress, offer.ID)
+	}
+
+	part, received, err := s.openPart(dir, path, offer.ID)
+	if err != nil {
+		s.unlock(path)
+		return nil, 0, err
+	}
+
+	return part, received, nil
+}
+
+func (s *dirFileStore) openPart(dir, path, id string) (*dirFilePart, int64, error) {
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		return nil, 0, err
+	}
+
+	f, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE, 0o600)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	info, err := f.Stat()
+	if err != nil {
+		_ = f.Close()
+		return nil, 0, err
+	}
+
+	part := &dirFilePart{File: f, checkpointPath: filepath.Join(dir, id+".checkpoint"), store: s}
+	checkpoint, err := os.ReadFile(part.checkpointPath)
+	if errors.Is(err, fs.ErrNotExist) {
+		return part, 0, nil
+	}
+	if err != nil {
+		_ = f.Close()
+		return nil, 0, err
+	}
+
+	received, err := strconv.ParseInt(strings.TrimSpace(string(checkpoint)), 10, 64)
+	if err != nil || received < 0 {
+		return part, 0, nil // A corrupted checkpoint restarts the transfer.
+	}
+
+	return part, min(received, info.Size()), nil
+}
+
+// lock reports false if the partial file at path is already in use.
+func (s *dirFileStore) lock(path string) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.open[path]; ok {
+		return false
+	}
+
+	s.open[path] = struct{}{}
+	return true
+}
+
+func (s *dirFileStore) unlock(path string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.open, path)
+}
+
+// Commit keeps the partial file if it fails, until it is discarded.
+func (s *dirFileStore) Commit(offer FileOffer, part FilePart) error {
+	p := part.(*dirFilePart)
+	if err := p.File.Close(); err != nil && !errors.Is(err, os.ErrClosed) {
+		return err
+	}
+
+	name := filepath.Base(offer.Name)
+	if name == "." || name == ".." || name == string(filepath.Separator) {
+		name = offer.ID
+	}
+	if strings.HasSuffix(name, ".part") || strings.HasSuffix(name, ".checkpoint") {
+		return fmt.Errorf("%w: %q", ErrFileNameInvalid, offer.Name)
+	}
+	// Unlike a rename, the link fails if the name is taken, so that the files of other transfers are never replaced.
+	if err := os.Link(p.Name(), filepath.Join(s.dir, name)); err != nil {
+		return err
+	}
+	defer p.release()
+	if err := os.Remove(p.Name()); err != nil {
+		return err
+	}
+
+	return removeIfExists(p.checkpointPath)
+}
+
+func (s *dirFileStore) Discard(_ FileOffer, part FilePart) error {
+	p := part.(*dirFilePart)
+	_ = p.File.Close()
+	defer p.release()
+	if err := removeIfExists(p.Name()); err != nil {
+		return err
+	}
+
+	return removeIfExists(p.checkpointPath)
+}
+
+type dirFilePart struct {
+	*os.File
+	checkpointPath string
+	store          *dirFileStore
+	released       sync.Once
+}
+
+func (p *dirFilePart) Checkpoint(n int64) error {
+	return os.WriteFile(p.checkpointPath, []byte(strconv.FormatInt(n, 10)), 0o600)
+}
+
+// Close keeps the partial file for the transfer to resume, and lets it be opened again.
+func (p *dirFilePart) Close() error {
+	defer p.release()
+	return p.File.Close()
+}
+
+func (p *dirFilePart) release() {
+	p.released.Do(func() { p.store.unlock(p.Name()) })
+}
+
+func isSafeFileID(id string) bool {
+	if id == "" || id[0] == '.' {
+		return false
+	}
+
+	for _, r := range id {
+		if (r < 'a' || r > 'z') && (r < 'A' || r > 'Z') && (r < '0' || r > '9') && r != '-' && r != '_' && r != '.' {
+			return false
+		}
+	}
+
+	return true
+}
+
+func removeIfExists(path string) error {
+	if err := os.Remove(path); err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return err
+	}
+
+	return nil
+}
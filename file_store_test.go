@@ -0,0 +1,126 @@
+package websocket_manager
+
+import (
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestDirFileStoreCommit(t *testing.T) {
+	tests := []struct {
+		name    string
+		offered string
+		// committed is the name the file is committed under, if it is.
+		committed string
+		wantErr   error
+	}{
+		{"offered name", "report.txt", "report.txt", nil},
+		{"directories are stripped", "../../report.txt", "report.txt", nil},
+		{"no name", "", "upload", nil},
+		{"partial file name", "other.part", "", ErrFileNameInvalid},
+		{"checkpoint name", "other.checkpoint", "", ErrFileNameInvalid},
+		{"taken name", "taken.txt", "", fs.ErrExist},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			dir := t.TempDir()
+			if err := os.WriteFile(filepath.Join(dir, "taken.txt"), []byte("kept"), 0o600); err != nil {
+				t.Fatal(err)
+			}
+
+			store := NewDirFileStore(dir)
+			offer := FileOffer{ID: "upload", Name: tc.offered, Size: 4}
+			part, _, err := store.Open(offer)
+			if err != nil {
+				t.Fatalf("Open: %v", err)
+			}
+			if _, err := part.WriteAt([]byte("data"), 0); err != nil {
+				t.Fatalf("WriteAt: %v", err)
+			}
+			if err := part.Checkpoint(4); err != nil {
+				t.Fatalf("Checkpoint: %v", err)
+			}
+
+			err = store.Commit(offer, part)
+			if tc.wantErr != nil {
+				if !errors.Is(err, tc.wantErr) {
+					t.Fatalf("Commit = %v, want %v", err, tc.wantErr)
+				}
+				if content, _ := os.ReadFile(filepath.Join(dir, "taken.txt")); string(content) != "kept" {
+					t.Fatalf("the taken file holds %q, want it kept", content)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Commit: %v", err)
+			}
+			if content, _ := os.ReadFile(filepath.Join(dir, tc.committed)); string(content) != "data" {
+				t.Fatalf("%s holds %q, want data", tc.committed, content)
+			}
+			if leftovers, _ := filepath.Glob(filepath.Join(dir, ".partial", "*", "upload.*")); len(leftovers) != 0 {
+				t.Fatalf("%v left behind", leftovers)
+			}
+		})
+	}
+}
+
+func TestDirFileStoreResume(t *testing.T) {
+	store := NewDirFileStore(t.TempDir())
+	offer := FileOffer{ID: "upload", Name: "report.txt", Size: 8}
+
+	part, received, err := store.Open(offer)
+	if err != nil || received != 0 {
+		t.Fatalf("Open = %d, %v; want 0", received, err)
+	}
+	_, _ = part.WriteAt([]byte("half"), 0)
+	if err := part.Checkpoint(4); err != nil {
+		t.Fatalf("Checkpoint: %v", err)
+	}
+	_ = part.Close()
+
+	part, received, err = store.Open(offer)
+	if err != nil || received != 4 {
+		t.Fatalf("Open after a checkpoint = %d, %v; want 4", received, err)
+	}
+	_ = part.Close()
+
+	if _, _, err := store.Open(FileOffer{ID: "../escape"}); !errors.Is(err, ErrFileIDInvalid) {
+		t.Fatalf("Open of an unsafe ID = %v, want ErrFileIDInvalid", err)
+	}
+}
+
+// A partial file is kept per owner, and is only open once at a time.
+func TestDirFileStoreOwners(t *testing.T) {
+	store := NewDirFileStore(t.TempDir())
+	alice := FileOffer{ID: "upload", Name: "report.txt", Size: 8, Owner: "alice"}
+
+	part, _, err := store.Open(alice)
+	if err != nil {
+		t.Fatalf("Open: %v", err)
+	}
+	_, _ = part.WriteAt([]byte("half"), 0)
+	if err := part.Checkpoint(4); err != nil {
+		t.Fatalf("Checkpoint: %v", err)
+	}
+
+	if _, _, err := store.Open(alice); !errors.Is(err, ErrFileTransferInProgress) {
+		t.Fatalf("Open of an open file = %v, want ErrFileTransferInProgress", err)
+	}
+
+	bob := alice
+	bob.Owner = "bob"
+	other, received, err := store.Open(bob)
+	if err != nil || received != 0 {
+		t.Fatalf("Open of another owner = %d, %v; want 0", received, err)
+	}
+	_ = other.Close()
+
+	_ = part.Close()
+	part, received, err = store.Open(alice)
+	if err != nil || received != 4 {
+		t.Fatalf("Open after Close = %d, %v; want 4", received, err)
+	}
+	_ = part.Close()
+}
@@ -0,0 +1,579 @@
+package websocket_manager
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"sync"
+)
+
+const (
+	defaultFileChunkSize   = 64 * 1024
+	defaultFileWindow      = 8
+	defaultFileMaxSize     = 1 << 30
+	defaultFileMaxIncoming = 4
+)
+
+// fileFrameMagic prefixes every binary message of the file transfer protocol, so that they can be told apart from the messages of the Socket.
+var fileFrameMagic = []byte("WMFT")
+
+// Kinds of file transfer frames, the chunk frame carries raw data while the others carry a JSON body.
+const (
+	fileFrameOffer byte = iota + 1
+	fileFrameAccept
+	fileFrameChunk
+	fileFrameAck
+	fileFrameComplete
+	fileFrameAbort
+)
+
+// FileOffer describes a file announced by the sender.
+type FileOffer struct {
+	// ID identifies the transfer across reconnects, offering the same ID again resumes it.
+	ID   string `json:"id"`
+	Name string `json:"name"`
+	// SHA256 is the hex encoded SHA-256 checksum of the content.
+	SHA256 string `json:"sha256"`
+	Size   int64  `json:"size"`
+	// Owner is the FileTransfer.Owner of the receiver, it is set by the receiver and never sent.
+	// Stores keep the files of different owners apart, so that an offer only resumes the transfers of its owner.
+	Owner string `json:"-"`
+}
+
+// FilePart is the storage of a file being received.
+type FilePart interface {
+	io.ReaderAt
+	io.WriterAt
+	// Checkpoint records that the first n bytes of the file were received, transfers resume from the last checkpoint.
+	Checkpoint(n int64) error
+	Close() error
+}
+
+// FileStore persists incoming files so that interrupted transfers can resume, see NewDirFileStore.
+type FileStore interface {
+	// Open returns the storage of the offered file and its last checkpoint, the file is identified by the ID and the Owner of the offer.
+	// It should fail while the same file is open, so that two connections never write it at once.
+	Open(offer FileOffer) (FilePart, int64, error)
+	// Commit is called once the file was fully received and its checksum verified, part is not used afterward unless Commit fails.
+	Commit(offer FileOffer, part FilePart) error
+	// Discard is called if the file fails its checksum or its Commit fails, so that the transfer starts over when offered again.
+	Discard(offer FileOffer, part FilePart) error
+}
+
+// FileTransfer implements a file transfer protocol over binary messages in both directions.
+// The sender announces a file, streams it in chunks and the receiver acknowledges them; interrupted transfers resume from the last acknowledged offset when offered again.
+// A FileTransfer serves a single connection, it is plugged into it by wrapping its Socket with FileTransfer.Socket.
+// Chunks are written through the PriorityBulk lane so that they do not hold back the other messages of the connection.
+type FileTransfer struct {
+	// Store persists incoming files. If nil, incoming files are rejected.
+	Store FileStore
+	// Owner identifies the client in the Store, e.g. the subject of its Session, interrupted transfers only resume on a connection with the same Owner.
+	// If empty, a random Owner is used, so that transfers only resume on the same connection.
+	Owner string
+	// OnFile will be called once an incoming file is committed to the Store, or with the error that made it fail.
+	// It may be nil.
+	OnFile func(offer FileOffer, err error)
+	// ChunkSize How many bytes of the file every chunk carries. If 0, 64KiB chunks are used.
+	ChunkSize int
+	// Window How many chunks may be sent before they are acknowledged. If 0, 8 chunks are used.
+	Window int
+	// MaxSize How many bytes an incoming file may hold, larger offers are rejected with ErrFileTooLarge. If 0, 1GiB is used.
+	MaxSize int64
+	// MaxIncoming How many incoming files may be received at once, further offers are rejected with ErrTooManyIncomingFiles until one of them ends.
+	// If 0, 4 files are used.
+	MaxIncoming int
+
+	conn     *Conn
+	owner    string
+	incoming map[string]*incomingFile
+	outgoing map[string]*outgoingFile
+	mu       sync.Mutex
+}
+
+type incomingFile struct {
+	part     FilePart
+	pending  map[int64]int64
+	offer    FileOffer
+	received int64
+	mu       sync.Mutex
+}
+
+type outgoingFile struct {
+	// notify signals that acked changed, the first acknowledgement is the offset to resume from.
+	notify chan struct{}
+	// result receives nil once the receiver committed the file, or the reason it aborted.
+	result chan error
+	acked  int64
+	mu     sync.Mutex
+}
+
+func (o *outgoingFile) ack(offset int64) {
+	o.mu.Lock()
+	o.acked = max(o.acked, offset)
+	o.mu.Unlock()
+
+	select {
+	case o.notify <- struct{}{}:
+	default: // A notification is already pending.
+	}
+}
+
+func (o *outgoingFile) ackedOffset() int64 {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	return o.acked
+}
+
+type fileFrameBody struct {
+	ID     string `json:"id"`
+	Reason string `json:"reason,omitempty"`
+	Offset int64  `json:"offset"`
+}
+
+// Socket wraps socket so that the messages of the file transfer protocol are handled before reaching it.
+func (t *FileTransfer) Socket(socket Socket) Socket {
+	return &socketWrapper{
+		Socket: socket,
+		attach: t.attach,
+		filter: func(payload []byte, _ func([]byte)) bool { return t.handleFrame(payload) },
+		claims: func(head []byte) bool { return bytes.HasPrefix(head, fileFrameMagic) },
+		detach: func(*Conn) { t.detach() },
+	}
+}
+
+// SendFile sends size bytes read from r as a file named name, it blocks until the receiver commits the file.
+// If id is empty, the checksum of the content is used, so that sending the same content again resumes the transfer.
+// Returns ErrFileTransferAborted if the receiver rejects the file.
+// Returns ErrConnectionClosed if the connection closes before the transfer completes.
+// Returns the error of ctx if it is done before the transfer completes.
+func (t *FileTransfer) SendFile(ctx context.Context, id string, name string, r io.ReaderAt, size int64) error {
+	conn := t.getConn()
+	if conn == nil {
+		return ErrFileTransferNotAttached
+	}
+
+	hash := sha256.New()
+	if _, err := io.Copy(hash, io.NewSectionReader(r, 0, size)); err != nil {
+		return fmt.Errorf("%w: %w", ErrStreamRead, err)
+	}
+	offer := FileOffer{ID: id, Name: name, Size: size, SHA256: hex.EncodeToString(hash.Sum(nil))}
+	if offer.ID == "" {
+		offer.ID = offer.SHA256
+	}
+	if len(offer.ID) > 255 {
+		return fmt.Errorf("%w: %s", ErrFileIDTooLong, offer.ID)
+	}
+
+	out := &outgoingFile{notify: make(chan struct{}, 1), result: make(chan error, 1)}
+	t.mu.Lock()
+	if t.outgoing == nil {
+		t.outgoing = make(map[string]*outgoingFile)
+	}
+	if _, busy := t.outgoing[offer.ID]; busy {
+		t.mu.Unlock()
+		return fmt.Errorf("%w: %s", ErrFileTransferInProgress, offer.ID)
+	}
+	t.outgoing[offer.ID] = out
+	t.mu.Unlock()
+	defer func() {
+		t.mu.Lock()
+		delete(t.outgoing, offer.ID)
+		t.mu.Unlock()
+	}()
+
+	body, err := json.Marshal(offer)
+	if err != nil {
+		return err
+	}
+	if err := conn.Send(BinaryMessage(fileFrame(fileFrameOffer, body))); err != nil {
+		return err
+	}
+
+	var next, acked int64
+	select {
+	case <-out.notify:
+		acked = out.ackedOffset()
+		next = acked
+	case err := <-out.result:
+		return err
+	case <-conn.Done():
+		return ErrConnectionClosed
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+
+	chunk := make([]byte, t.chunkSize())
+	window := int64(t.window() * t.chunkSize())
+	for acked < size {
+		for next < size && next-acked < window {
+			n, err := r.ReadAt(chunk[:min(int64(len(chunk)), size-next)], next)
+			if err != nil && n == 0 {
+				return fmt.Errorf("%w: %w", ErrStreamRead, err)
+			}
+			if err := conn.Send(WithPriority(BinaryMessage(fileChunkFrame(offer.ID, next, chunk[:n])), PriorityBulk)); err != nil {
+				return err
+			}
+			next += int64(n)
+		}
+
+		select {
+		case <-out.notify:
+			acked = out.ackedOffset()
+		case err := <-out.result:
+			return err
+		case <-conn.Done():
+			return ErrConnectionClosed
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+
+	select {
+	case err := <-out.result:
+		return err
+	case <-conn.Done():
+		return ErrConnectionClosed
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func (t *FileTransfer) chunkSize() int {
+	if t.ChunkSize <= 0 {
+		return defaultFileChunkSize
+	}
+
+	return t.ChunkSize
+}
+
+func (t *FileTransfer) window() int {
+	if t.Window <= 0 {
+		return defaultFileWindow
+	}
+
+	return t.Window
+}
+
+func (t *FileTransfer) getConn() *Conn {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.conn
+}
+
+// handleFrame handles a message of the file transfer protocol, it reports false if payload is not one.
+func (t *FileTransfer) handleFrame(payload []byte) bool {
+	if len(payload) <= len(fileFrameMagic) || !bytes.HasPrefix(payload, fileFrameMagic) {
+		return false
+	}
+
+	kind, body := payload[len(fileFrameMagic)], payload[len(fileFrameMagic)+1:]
+	switch kind {
+	case fileFrameOffer:
+		var offer FileOffer
+		if err := json.Unmarshal(body, &offer); err != nil || offer.ID == "" || offer.Size < 0 {
+			return true
+		}
+		t.handleOffer(offer)
+	case fileFrameChunk:
+		id, offset, data, ok := parseFileChunkFrame(body)
+		if ok {
+			t.handleChunk(id, offset, data)
+		}
+	case fileFrameAccept, fileFrameAck:
+		var ack fileFrameBody
+		if err := json.Unmarshal(body, &ack); err == nil {
+			t.handleAck(ack)
+		}
+	case fileFrameComplete, fileFrameAbort:
+		var result fileFrameBody
+		if err := json.Unmarshal(body, &result); err == nil {
+			t.handleResult(kind, result)
+		}
+	}
+
+	return true
+}
+
+func (t *FileTransfer) handleOffer(offer FileOffer) {
+	if t.Store == nil {
+		t.sendControl(fileFrameAbort, fileFrameBody{ID: offer.ID, Reason: "files are not accepted"})
+		return
+	}
+
+	if offer.Size > t.maxSize() {
+		t.rejectOffer(offer, "file too large", ErrFileTooLarge)
+		return
+	}
+
+	t.mu.Lock()
+	offer.Owner = t.ownerLocked()
+	if t.incoming == nil {
+		t.incoming = make(map[string]*incomingFile)
+	}
+	if in, ok := t.incoming[offer.ID]; ok { // The sender restarted the transfer on the same connection.
+		t.mu.Unlock()
+		in.mu.Lock()
+		received := in.received
+		in.mu.Unlock()
+		t.sendControl(fileFrameAccept, fileFrameBody{ID: offer.ID, Offset: received})
+		return
+	}
+	if len(t.incoming) >= t.maxIncoming() {
+		t.mu.Unlock()
+		t.rejectOffer(offer, "too many files in progress", ErrTooManyIncomingFiles)
+		return
+	}
+
+	part, received, err := t.Store.Open(offer)
+	if err != nil {
+		t.mu.Unlock()
+		t.rejectOffer(offer, "cannot store file", err)
+		return
+	}
+	received = min(received, offer.Size)
+	in := &incomingFile{offer: offer, part: part, received: received, pending: make(map[int64]int64)}
+	t.incoming[offer.ID] = in
+	t.mu.Unlock()
+
+	t.sendControl(fileFrameAccept, fileFrameBody{ID: offer.ID, Offset: received})
+	if received == offer.Size {
+		t.finishIncoming(in)
+	}
+}
+
+func (t *FileTransfer) rejectOffer(offer FileOffer, reason string, err error) {
+	t.sendControl(fileFrameAbort, fileFrameBody{ID: offer.ID, Reason: reason})
+	t.notifyFile(offer, fmt.Errorf("%w: %w", ErrFileTransferAborted, err))
+}
+
+// ownerLocked returns the Owner of the incoming files, it must be called with the lock held.
+func (t *FileTransfer) ownerLocked() string {
+	if t.owner == "" {
+		t.owner = t.Owner
+		if t.owner == "" {
+			t.owner = newConnectionID()
+		}
+	}
+
+	return t.owner
+}
+
+func (t *FileTransfer) maxSize() int64 {
+	if t.MaxSize == 0 {
+		return defaultFileMaxSize
+	}
+
+	return t.MaxSize
+}
+
+func (t *FileTransfer) maxIncoming() int {
+	if t.MaxIncoming == 0 {
+		return defaultFileMaxIncoming
+	}
+
+	return t.MaxIncoming
+}
+
+func (t *FileTransfer) handleChunk(id string, offset int64, data []byte) {
+	t.mu.Lock()
+	in, ok := t.incoming[id]
+	t.mu.Unlock()
+	if !ok {
+		return
+	}
+
+	in.mu.Lock()
+	if offset < in.received || offset+int64(len(data)) > in.offer.Size { // Duplicate or out of bounds.
+		in.mu.Unlock()
+		return
+	}
+	if _, err := in.part.WriteAt(data, offset); err != nil {
+		in.mu.Unlock()
+		t.abortIncoming(in, "cannot store file", err)
+		return
+	}
+
+	// Chunks may be handled out of order, the received offset only advances over contiguous data.
+	in.pending[offset] = int64(len(data))
+	for length, ok := in.pending[in.received]; ok; length, ok = in.pending[in.received] {
+		delete(in.pending, in.received)
+		in.received += length
+	}
+	received := in.received
+	err := in.part.Checkpoint(received)
+	in.mu.Unlock()
+	if err != nil {
+		t.abortIncoming(in, "cannot store file", err)
+		return
+	}
+
+	t.sendControl(fileFrameAck, fileFrameBody{ID: id, Offset: received})
+	if received == in.offer.Size {
+		t.finishIncoming(in)
+	}
+}
+
+// finishIncoming verifies the checksum of a fully received file and commits it.
+func (t *FileTransfer) finishIncoming(in *incomingFile) {
+	if !t.removeIncoming(in) { // Another chunk already finished it.
+		return
+	}
+
+	hash := sha256.New()
+	if _, err := io.Copy(hash, io.NewSectionReader(in.part, 0, in.offer.Size)); err != nil {
+		_ = in.part.Close()
+		t.sendControl(fileFrameAbort, fileFrameBody{ID: in.offer.ID, Reason: "cannot read file"})
+		t.notifyFile(in.offer, fmt.Errorf("%w: %w", ErrFileTransferAborted, err))
+		return
+	}
+
+	if hex.EncodeToString(hash.Sum(nil)) != in.offer.SHA256 {
+		_ = t.Store.Discard(in.offer, in.part)
+		t.sendControl(fileFrameAbort, fileFrameBody{ID: in.offer.ID, Reason: "checksum mismatch"})
+		t.notifyFile(in.offer, ErrFileChecksumMismatch)
+		return
+	}
+
+	if err := t.Store.Commit(in.offer, in.part); err != nil {
+		_ = t.Store.Discard(in.offer, in.part)
+		t.sendControl(fileFrameAbort, fileFrameBody{ID: in.offer.ID, Reason: "cannot store file"})
+		t.notifyFile(in.offer, fmt.Errorf("%w: %w", ErrFileTransferAborted, err))
+		return
+	}
+
+	t.sendControl(fileFrameComplete, fileFrameBody{ID: in.offer.ID, Offset: in.offer.Size})
+	t.notifyFile(in.offer, nil)
+}
+
+func (t *FileTransfer) abortIncoming(in *incomingFile, reason string, err error) {
+	if !t.removeIncoming(in) {
+		return
+	}
+
+	_ = in.part.Close()
+	t.sendControl(fileFrameAbort, fileFrameBody{ID: in.offer.ID, Reason: reason})
+	t.notifyFile(in.offer, fmt.Errorf("%w: %w", ErrFileTransferAborted, err))
+}
+
+// removeIncoming stops tracking in, it reports false if it was not tracked anymore.
+func (t *FileTransfer) removeIncoming(in *incomingFile) bool {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.incoming[in.offer.ID] != in {
+		return false
+	}
+
+	delete(t.incoming, in.offer.ID)
+	return true
+}
+
+func (t *FileTransfer) handleAck(ack fileFrameBody) {
+	t.mu.Lock()
+	out, ok := t.outgoing[ack.ID]
+	t.mu.Unlock()
+	if !ok {
+		return
+	}
+
+	out.ack(ack.Offset)
+}
+
+func (t *FileTransfer) handleResult(kind byte, result fileFrameBody) {
+	t.mu.Lock()
+	out, ok := t.outgoing[result.ID]
+	t.mu.Unlock()
+	if !ok {
+		return
+	}
+
+	var err error
+	if kind == fileFrameAbort {
+		err = fmt.Errorf("%w: %s", ErrFileTransferAborted, result.Reason)
+	}
+
+	select {
+	case out.result <- err:
+	default:
+	}
+}
+
+// attach sends the outgoing files and their control frames through conn.
+func (t *FileTransfer) attach(conn *Conn) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.conn = conn
+}
+
+// detach releases the incoming files when the connection closes, they can be resumed on another connection.
+func (t *FileTransfer) detach() {
+	t.mu.Lock()
+	incoming := t.incoming
+	t.incoming = nil
+	t.mu.Unlock()
+
+	for _, in := range incoming {
+		_ = in.part.Close()
+		t.notifyFile(in.offer, ErrConnectionClosed)
+	}
+}
+
+func (t *FileTransfer) sendControl(kind byte, body fileFrameBody) {
+	conn := t.getConn()
+	if conn == nil {
+		return
+	}
+
+	data, err := json.Marshal(body)
+	if err != nil {
+		return
+	}
+
+	_ = conn.Send(WithPriority(BinaryMessage(fileFrame(kind, data)), PriorityHigh))
+}
+
+func (t *FileTransfer) notifyFile(offer FileOffer, err error) {
+	if t.OnFile != nil {
+		t.OnFile(offer, err)
+	}
+}
+
+func fileFrame(kind byte, body []byte) []byte {
+	frame := make([]byte, 0, len(fileFrameMagic)+1+len(body))
+	frame = append(frame, fileFrameMagic...)
+	frame = append(frame, kind)
+	return append(frame, body...)
+}
+
+// fileChunkFrame encodes a chunk as the length of the id (1 byte), the id, the offset (8 bytes big endian) and the data.
+func fileChunkFrame(id string, offset int64, data []byte) []byte {
+	body := make([]byte, 0, 1+len(id)+8+len(data))
+	body = append(body, byte(len(id)))
+	body = append(body, id...)
+	body = binary.BigEndian.AppendUint64(body, uint64(offset))
+	body = append(body, data...)
+	return fileFrame(fileFrameChunk, body)
+}
+
+func parseFileChunkFrame(body []byte) (string, int64, []byte, bool) {
+	if len(body) < 1 {
+		return "", 0, nil, false
+	}
+
+	idLen := int(body[0])
+	if len(body) < 1+idLen+8 {
+		return "", 0, nil, false
+	}
+
+	id := string(body[1 : 1+idLen])
+	offset := int64(binary.BigEndian.Uint64(body[1+idLen : 1+idLen+8]))
+	if offset < 0 {
+		return "", 0, nil, false
+	}
+
+	return id, offset, body[1+idLen+8:], true
+}
@@ -0,0 +1,210 @@
+package websocket_manager
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+// fileTransferClient speaks the file transfer protocol from the client side of a connection.
+type fileTransferClient struct {
+	t      *testing.T
+	client *websocket.Conn
+}
+
+func (c fileTransferClient) write(frame []byte) {
+	c.t.Helper()
+	if err := c.client.WriteMessage(websocket.BinaryMessage, frame); err != nil {
+		c.t.Fatalf("write: %v", err)
+	}
+}
+
+func (c fileTransferClient) offer(offer FileOffer) {
+	c.t.Helper()
+	body, _ := json.Marshal(offer)
+	c.write(fileFrame(fileFrameOffer, body))
+}
+
+// read returns the kind and body of the next frame of the server.
+func (c fileTransferClient) read() (byte, fileFrameBody) {
+	c.t.Helper()
+	_ = c.client.SetReadDeadline(time.Now().Add(testTimeout))
+	_, payload, err := c.client.ReadMessage()
+	if err != nil {
+		c.t.Fatalf("read: %v", err)
+	}
+	if !bytes.HasPrefix(payload, fileFrameMagic) {
+		c.t.Fatalf("unexpected message %q", payload)
+	}
+
+	var body fileFrameBody
+	if err := json.Unmarshal(payload[len(fileFrameMagic)+1:], &body); err != nil {
+		c.t.Fatalf("frame body: %v", err)
+	}
+	return payload[len(fileFrameMagic)], body
+}
+
+func startFileTransfer(t *testing.T, transfer *FileTransfer) fileTransferClient {
+	_, client := startTest(t, &Config{GracePeriod: time.Second}, transfer.Socket(newTestSocket()))
+	return fileTransferClient{t: t, client: client}
+}
+
+func TestFileTransferReceive(t *testing.T) {
+	dir := t.TempDir()
+	results := make(chan error, 1)
+	client := startFileTransfer(t, &FileTransfer{Store: NewDirFileStore(dir), OnFile: func(_ FileOffer, err error) { results <- err }})
+
+	content := []byte("the content of the file")
+	sum := sha256.Sum256(content)
+	client.offer(FileOffer{ID: "upload", Name: "report.txt", SHA256: hex.EncodeToString(sum[:]), Size: int64(len(content))})
+	if kind, body := client.read(); kind != fileFrameAccept || body.Offset != 0 {
+		t.Fatalf("frame %d %+v, want an accept from 0", kind, body)
+	}
+
+	client.write(fileChunkFrame("upload", 0, content[:10]))
+	client.write(fileChunkFrame("upload", 10, content[10:]))
+	for kind, body := client.read(); kind != fileFrameComplete; kind, body = client.read() {
+		if kind != fileFrameAck {
+			t.Fatalf("frame %d %+v, want acknowledgements until the completion", kind, body)
+		}
+	}
+
+	if err := receive(t, results); err != nil {
+		t.Fatalf("OnFile: %v", err)
+	}
+	if got, _ := os.ReadFile(filepath.Join(dir, "report.txt")); !bytes.Equal(got, content) {
+		t.Fatalf("committed %q, want %q", got, content)
+	}
+}
+
+func TestFileTransferRejectsOffers(t *testing.T) {
+	tests := []struct {
+		name        string
+		maxSize     int64
+		maxIncoming int
+		offers      []FileOffer
+		want        error
+	}{
+		{"too large", 10, 0, []FileOffer{{ID: "big", Name: "big", Size: 11}}, ErrFileTooLarge},
+		{"default size", 0, 0, []FileOffer{{ID: "big", Name: "big", Size: defaultFileMaxSize + 1}}, ErrFileTooLarge},
+		{"too many", 0, 1, []FileOffer{{ID: "first", Name: "first", Size: 10}, {ID: "second", Name: "second", Size: 10}}, ErrTooManyIncomingFiles},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			results := make(chan error, len(tc.offers))
+			client := startFileTransfer(t, &FileTransfer{
+				Store:       NewDirFileStore(t.TempDir()),
+				OnFile:      func(_ FileOffer, err error) { results <- err },
+				MaxSize:     tc.maxSize,
+				MaxIncoming: tc.maxIncoming,
+			})
+
+			for i, offer := range tc.offers {
+				client.offer(offer)
+				kind, body := client.read()
+				if i < len(tc.offers)-1 {
+					if kind != fileFrameAccept {
+						t.Fatalf("frame %d %+v for offer %s, want an accept", kind, body, offer.ID)
+					}
+					continue
+				}
+				if kind != fileFrameAbort || body.ID != offer.ID {
+					t.Fatalf("frame %d %+v for offer %s, want an abort", kind, body, offer.ID)
+				}
+			}
+			if err := receive(t, results); !errors.Is(err, tc.want) || !errors.Is(err, ErrFileTransferAborted) {
+				t.Fatalf("OnFile = %v, want %v", err, tc.want)
+			}
+		})
+	}
+}
+
+// The transfers of different owners never share a partial file, and a file only receives the chunks of one connection at a time.
+func TestFileTransferOwners(t *testing.T) {
+	store := NewDirFileStore(t.TempDir())
+	content := []byte("the content of the file")
+	sum := sha256.Sum256(content)
+	offer := FileOffer{ID: "upload", Name: "report.txt", SHA256: hex.EncodeToString(sum[:]), Size: int64(len(content))}
+
+	alice := startFileTransfer(t, &FileTransfer{Store: store, Owner: "alice"})
+	alice.offer(offer)
+	if kind, body := alice.read(); kind != fileFrameAccept || body.Offset != 0 {
+		t.Fatalf("frame %d %+v, want an accept from 0", kind, body)
+	}
+	alice.write(fileChunkFrame("upload", 0, content[:10]))
+	if kind, body := alice.read(); kind != fileFrameAck || body.Offset != 10 {
+		t.Fatalf("frame %d %+v, want an ack of 10", kind, body)
+	}
+
+	tests := []struct {
+		name  string
+		owner string
+		// wantKind is the answer to the offer, wantOffset the offset of an accept.
+		wantKind   byte
+		wantOffset int64
+		wantErr    error
+	}{
+		{"same ID of another owner", "bob", fileFrameAccept, 0, nil},
+		{"same ID of the same owner while it is received", "alice", fileFrameAbort, 0, ErrFileTransferInProgress},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			results := make(chan error, 1)
+			client := startFileTransfer(t, &FileTransfer{Store: store, Owner: tc.owner, OnFile: func(_ FileOffer, err error) { results <- err }})
+			client.offer(offer)
+			kind, body := client.read()
+			if kind != tc.wantKind || body.Offset != tc.wantOffset {
+				t.Fatalf("frame %d %+v, want %d from %d", kind, body, tc.wantKind, tc.wantOffset)
+			}
+			if tc.wantErr != nil {
+				if err := receive(t, results); !errors.Is(err, tc.wantErr) {
+					t.Fatalf("OnFile = %v, want %v", err, tc.wantErr)
+				}
+			}
+		})
+	}
+}
+
+// A file that cannot be committed is discarded, offering it again starts the transfer over instead of failing the commit again.
+func TestFileTransferCommitFailure(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "taken.txt"), []byte("kept"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	results := make(chan error, 1)
+	client := startFileTransfer(t, &FileTransfer{Store: NewDirFileStore(dir), OnFile: func(_ FileOffer, err error) { results <- err }})
+
+	content := []byte("the content of the file")
+	sum := sha256.Sum256(content)
+	offer := FileOffer{ID: "upload", Name: "taken.txt", SHA256: hex.EncodeToString(sum[:]), Size: int64(len(content))}
+	client.offer(offer)
+	if kind, body := client.read(); kind != fileFrameAccept || body.Offset != 0 {
+		t.Fatalf("frame %d %+v, want an accept from 0", kind, body)
+	}
+	client.write(fileChunkFrame("upload", 0, content))
+	for kind, body := client.read(); kind != fileFrameAbort; kind, body = client.read() {
+		if kind != fileFrameAck {
+			t.Fatalf("frame %d %+v, want acknowledgements until the abort", kind, body)
+		}
+	}
+	if err := receive(t, results); !errors.Is(err, fs.ErrExist) {
+		t.Fatalf("OnFile = %v, want fs.ErrExist", err)
+	}
+
+	client.offer(offer)
+	if kind, body := client.read(); kind != fileFrameAccept || body.Offset != 0 {
+		t.Fatalf("frame %d %+v for the offer after the failed commit, want an accept from 0", kind, body)
+	}
+	if content, _ := os.ReadFile(filepath.Join(dir, "taken.txt")); string(content) != "kept" {
+		t.Fatalf("the taken file holds %q, want it kept", content)
+	}
+}
@@ -2,4 +2,7 @@ module github.com/ktsivkov/websocket_manager
 
 go 1.25
 
-require github.com/gorilla/websocket v1.5.3 // indirect
+require (
+	github.com/gorilla/websocket v1.5.3
+	gopkg.in/yaml.v3 v3.0.1
+)
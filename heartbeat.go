@@ -0,0 +1,112 @@
+package websocket_manager
+
+import (
+	"bytes"
+	"fmt"
+	"log/slog"
+	"time"
+)
+
+// maxHeartbeatReplySize is how much of a streamed message is buffered to tell whether it is a heartbeat reply.
+const maxHeartbeatReplySize = 4096
+
+// Heartbeat configures an application-level liveness check, for clients that cannot see ping and pong frames such as browsers,
+// or when proxies swallow control frames.
+// The worker writes Message every Frequency, and closes the connection with ErrHeartbeatTimeoutExceeded if no reply is read within Timeout.
+// Replies are filtered out before they reach Socket.OnMessage, StreamHandler.OnStream or PooledMessageHandler.OnPooledMessage.
+// Like ping and pong frames, heartbeats and their replies do not count as activity for the idle timeouts.
+type Heartbeat struct {
+	// Message The heartbeat message, e.g. TextMessage(`{"type":"heartbeat"}`).
+	Message Message
+	// Reply The exact payload of the replies of the client, it is ignored if IsReply is set.
+	Reply []byte
+	// IsReply reports whether a message of the client is a heartbeat reply.
+	// It is called from the reader goroutine. For StreamHandler, only messages up to 4KiB are checked.
+	IsReply func(payload []byte) bool
+	// Frequency How often to send the heartbeat message.
+	Frequency time.Duration
+	// Timeout How long to wait for a reply, it must be greater than Frequency + Config.WriteTimeout.
+	Timeout time.Duration
+}
+
+func (h *Heartbeat) isReply(payload []byte) bool {
+	if h.IsReply != nil {
+		return h.IsReply(payload)
+	}
+
+	return bytes.Equal(payload, h.Reply)
+}
+
+// validate reports the violations of the Heartbeat, whose writes are bounded by writeTimeout.
+func (h *Heartbeat) validate(writeTimeout time.Duration, violation func(field string, err error)) {
+	if h.Message == nil {
+		violation("Heartbeat.Message", ErrConfigBadHeartbeat)
+	}
+	if h.Reply == nil && h.IsReply == nil {
+		violation("Heartbeat.Reply", ErrConfigBadHeartbeat)
+	}
+	if h.Frequency <= 0 {
+		violation("Heartbeat.Frequency", ErrConfigBadHeartbeat)
+	}
+	if h.Timeout <= h.Frequency+writeTimeout {
+		violation("Heartbeat.Timeout", ErrConfigBadHeartbeat)
+	}
+}
+
+// startHeartbeat starts the heartbeat ticker and the reply timer, the Heartbeat.Timeout counts from now on.
+func (w *worker) startHeartbeat(s *writerState) {
+	w.lastHeartbeatReply.Store(w.clock.Now().UnixNano())
+	s.heartbeatTicker = w.clock.NewTicker(s.conf.Heartbeat.Frequency)
+	s.heartbeatCh = s.heartbeatTicker.C()
+	s.heartbeatTimer = w.clock.NewTimer(s.conf.Heartbeat.Timeout)
+	s.heartbeatReplyCh = s.heartbeatTimer.C()
+}
+
+// stopHeartbeat stops the heartbeat ticker and the reply timer.
+func (w *worker) stopHeartbeat(s *writerState) {
+	s.heartbeatTicker.Stop()
+	s.heartbeatTimer.Stop()
+	s.heartbeatTicker, s.heartbeatCh, s.heartbeatTimer, s.heartbeatReplyCh = nil, nil, nil, nil
+}
+
+// writeHeartbeat writes the heartbeat message, it reports whether the writer should keep running.
+func (w *worker) writeHeartbeat(conf *Config) bool {
+	if w.State() != StateOpen {
+		return false
+	}
+	if err := conf.Heartbeat.Message.Write(w.conn, conf.WriteTimeout); err != nil {
+		w.logger.Warn("failed to write heartbeat", slog.Any("error", err))
+		w.Close(fmt.Errorf("%w: %w", ErrFailedToWrite, err), nil)
+		return false
+	}
+	w.stats.written(messageSize(conf.Heartbeat.Message))
+
+	return true
+}
+
+// heartbeatRemaining returns how long is left before the Heartbeat.Timeout is exceeded.
+func (w *worker) heartbeatRemaining(conf *Config) time.Duration {
+	return conf.Heartbeat.Timeout - w.clock.Now().Sub(time.Unix(0, w.lastHeartbeatReply.Load()))
+}
+
+// checkHeartbeat closes the connection if no reply was read within the Heartbeat.Timeout, it reports whether the writer should keep running.
+func (w *worker) checkHeartbeat(s *writerState) bool {
+	if remaining := w.heartbeatRemaining(s.conf); remaining > 0 {
+		s.heartbeatTimer.Reset(remaining)
+		return true
+	}
+
+	w.Close(ErrHeartbeatTimeoutExceeded, nil)
+	return false
+}
+
+// isHeartbeatReply records the message if it is a heartbeat reply and reports whether it is one, it is called from the reader goroutine.
+func (w *worker) isHeartbeatReply(payload []byte) bool {
+	heartbeat := w.config().Heartbeat
+	if heartbeat == nil || !heartbeat.isReply(payload) {
+		return false
+	}
+
+	w.lastHeartbeatReply.Store(w.stats.read(len(payload)))
+	return true
+}
@@ -0,0 +1,74 @@
+package websocket_manager
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+func TestHeartbeat(t *testing.T) {
+	tests := []struct {
+		name      string
+		heartbeat Heartbeat
+		// reply is what the client answers to every heartbeat, or nil if it does not answer.
+		reply []byte
+	}{
+		{"replied", Heartbeat{Reply: []byte("pong")}, []byte("pong")},
+		{"replied through IsReply", Heartbeat{IsReply: func(payload []byte) bool { return bytes.HasPrefix(payload, []byte("pong")) }}, []byte("pong 1")},
+		{"not replied", Heartbeat{Reply: []byte("pong")}, nil},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			clock := NewFakeClock(time.Unix(1000, 0))
+			heartbeat := tc.heartbeat
+			heartbeat.Message, heartbeat.Frequency, heartbeat.Timeout = TextMessage("ping"), time.Minute, 90*time.Second
+			socket := newTestSocket()
+			conn, client := startTest(t, &Config{Clock: clock, GracePeriod: time.Second, Heartbeat: &heartbeat, CloseFrames: DefaultCloseFrames()}, socket)
+
+			clock.BlockUntil(2)
+			for i := range 3 {
+				clock.Advance(time.Minute)
+				if _, payload, err := client.ReadMessage(); err != nil || string(payload) != "ping" {
+					t.Fatalf("read %q, %v; want the heartbeat", payload, err)
+				}
+				if tc.reply == nil {
+					break
+				}
+
+				if err := client.WriteMessage(websocket.TextMessage, tc.reply); err != nil {
+					t.Fatalf("write: %v", err)
+				}
+				for deadline := time.Now().Add(testTimeout); conn.Stats().FramesRead != uint64(i+1); time.Sleep(time.Millisecond) {
+					if time.Now().After(deadline) {
+						t.Fatal("the reply was not read")
+					}
+				}
+			}
+
+			if tc.reply != nil {
+				// The replies keep the connection open and do not reach the Socket.
+				if conn.State() != StateOpen {
+					t.Fatalf("State() = %s, want open: %v", conn.State(), conn.Err())
+				}
+				select {
+				case payload := <-socket.messages:
+					t.Fatalf("the reply %q reached OnMessage", payload)
+				default:
+				}
+				return
+			}
+
+			read := readAll(client)
+			clock.Advance(30 * time.Second)
+			if err := waitClosed(t, conn); !errors.Is(err, ErrHeartbeatTimeoutExceeded) {
+				t.Fatalf("Err() = %v, want ErrHeartbeatTimeoutExceeded", err)
+			}
+			if err := receive(t, read); !websocket.IsCloseError(err, websocket.CloseGoingAway) {
+				t.Fatalf("the client read %v, want a close message with code %d", err, websocket.CloseGoingAway)
+			}
+		})
+	}
+}
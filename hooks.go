@@ -0,0 +1,56 @@
+package websocket_manager
+
+import (
+	"errors"
+	"net"
+
+	"github.com/gorilla/websocket"
+)
+
+// PingHandler can optionally be implemented by a Socket to observe the pings of the client and choose the payload of the pong replies.
+type PingHandler interface {
+	// OnPing will be called from the reader goroutine for every ping, it returns the payload of the pong reply, e.g. payload itself to echo it.
+	// The reply must not exceed 125 bytes.
+	OnPing(payload []byte) []byte
+}
+
+// PongHandler can optionally be implemented by a Socket to observe the pongs of the client.
+type PongHandler interface {
+	// OnPong will be called from the reader goroutine for every pong.
+	OnPong(payload []byte)
+}
+
+// ErrorHandler can optionally be implemented by a Socket to observe the error that tears its connection down.
+type ErrorHandler interface {
+	// OnError will be called before OnDisconnect with the error the connection is closed with, see Run for the possible errors.
+	// It is not called if the close handshake was completed.
+	OnError(err error)
+}
+
+// CloseHandler can optionally be implemented by a Socket to inspect the close frame of the client.
+type CloseHandler interface {
+	// OnClose will be called from the reader goroutine with the code and text of the close frame of the client, before it is echoed.
+	OnClose(code int, text string)
+}
+
+// handlePing replies to a ping with a pong, its payload is chosen by the PingHandler if any, it is called from the reader goroutine.
+func (w *worker) handlePing(appData string) error {
+	w.stats.read(len(appData))
+	reply := []byte(appData)
+	if handler, ok := socketAs[PingHandler](w.socket); ok {
+		reply = handler.OnPing(reply)
+	}
+
+	err := w.conn.WriteControl(websocket.PongMessage, reply, w.config().controlFrameDeadline())
+	var netErr net.Error
+	switch {
+	case err == nil:
+		w.stats.written(len(reply))
+	case errors.Is(err, websocket.ErrCloseSent), errors.As(err, &netErr) && netErr.Timeout():
+		// Like the default ping handler, a pong that cannot be written does not fail the read.
+	default:
+		return err
+	}
+
+	return nil
+}
@@ -0,0 +1,178 @@
+package websocket_manager
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+// hookTestSocket records the hooks it receives in events, in order.
+type hookTestSocket struct {
+	*testSocket
+	events chan string
+}
+
+func newHookTestSocket() hookTestSocket {
+	return hookTestSocket{testSocket: newTestSocket(), events: make(chan string, 8)}
+}
+
+// teardown returns the next event that is not an OnClose.
+func (s hookTestSocket) teardown(t testing.TB) string {
+	t.Helper()
+	for {
+		if event := receive(t, s.events); !strings.HasPrefix(event, "OnClose ") {
+			return event
+		}
+	}
+}
+
+func (s hookTestSocket) OnError(err error) {
+	s.events <- fmt.Sprintf("OnError %v", err)
+}
+
+func (s hookTestSocket) OnClose(code int, text string) {
+	s.events <- fmt.Sprintf("OnClose %d %s", code, text)
+}
+
+func (s hookTestSocket) OnDisconnect(msg *ClientCloseMessage) {
+	s.events <- "OnDisconnect"
+	s.testSocket.OnDisconnect(msg)
+}
+
+// pingTestSocket replies to the pings with the payload of reply.
+type pingTestSocket struct {
+	*testSocket
+	reply func(payload []byte) []byte
+}
+
+func (s pingTestSocket) OnPing(payload []byte) []byte {
+	return s.reply(payload)
+}
+
+// The pong replies echo the ping unless the PingHandler chooses another payload.
+func TestPingHandler(t *testing.T) {
+	tests := []struct {
+		name   string
+		socket Socket
+		want   string
+	}{
+		{"echo by default", newTestSocket(), "hello"},
+		{"custom reply", pingTestSocket{newTestSocket(), func(payload []byte) []byte { return append([]byte("re:"), payload...) }}, "re:hello"},
+		{"empty reply", pingTestSocket{newTestSocket(), func([]byte) []byte { return nil }}, ""},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			conn, client := startTest(t, &Config{GracePeriod: time.Second}, tc.socket)
+			pongs := make(chan string, 1)
+			client.SetPongHandler(func(payload string) error {
+				pongs <- payload
+				return nil
+			})
+			_ = readAll(client)
+
+			if err := client.WriteControl(websocket.PingMessage, []byte("hello"), time.Now().Add(testTimeout)); err != nil {
+				t.Fatalf("ping: %v", err)
+			}
+			if got := receive(t, pongs); got != tc.want {
+				t.Fatalf("pong %q, want %q", got, tc.want)
+			}
+			if stats := conn.Stats(); stats.BytesWritten < uint64(len(tc.want)) {
+				t.Fatalf("BytesWritten = %d, want the %d bytes of the pong counted", stats.BytesWritten, len(tc.want))
+			}
+		})
+	}
+}
+
+// OnError reports the cause of the teardown before OnDisconnect, unless the close handshake was completed.
+func TestErrorHandler(t *testing.T) {
+	tests := []struct {
+		name  string
+		close func(conn *Conn, client *websocket.Conn)
+		// wantErr is the error OnError receives, nil if it is not called.
+		wantErr error
+	}{
+		{
+			name: "closed by the client",
+			close: func(_ *Conn, client *websocket.Conn) {
+				_ = client.WriteMessage(websocket.CloseMessage, websocket.FormatCloseMessage(websocket.CloseNormalClosure, ""))
+				_ = readAll(client)
+			},
+		},
+		{
+			name: "closed by Conn.Close",
+			close: func(conn *Conn, client *websocket.Conn) {
+				_ = readAll(client)
+				_ = conn.Close(websocket.CloseNormalClosure, "")
+			},
+		},
+		{
+			name:    "close handshake timeout",
+			close:   func(conn *Conn, _ *websocket.Conn) { _ = conn.Close(websocket.CloseNormalClosure, "") },
+			wantErr: ErrCloseHandshakeTimeout,
+		},
+		{
+			name:    "connection dropped",
+			close:   func(_ *Conn, client *websocket.Conn) { _ = client.UnderlyingConn().Close() },
+			wantErr: ErrFailedToRead,
+		},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			socket := newHookTestSocket()
+			conn, client := startTest(t, &Config{GracePeriod: 50 * time.Millisecond, CloseFrames: DefaultCloseFrames()}, socket)
+
+			tc.close(conn, client)
+			err := waitClosed(t, conn)
+			if tc.wantErr != nil && !errors.Is(err, tc.wantErr) {
+				t.Fatalf("Err() = %v, want %v", err, tc.wantErr)
+			}
+
+			event := socket.teardown(t)
+			if tc.wantErr == nil {
+				if event != "OnDisconnect" {
+					t.Fatalf("%s after a clean close, want OnDisconnect alone", event)
+				}
+				return
+			}
+			if !strings.HasPrefix(event, "OnError ") || !strings.Contains(event, tc.wantErr.Error()) {
+				t.Fatalf("%s, want OnError with %v", event, tc.wantErr)
+			}
+			if event := socket.teardown(t); event != "OnDisconnect" {
+				t.Fatalf("%s after OnError, want OnDisconnect", event)
+			}
+		})
+	}
+}
+
+// OnClose receives the close frame of the client before it is echoed.
+func TestCloseHandler(t *testing.T) {
+	socket := newHookTestSocket()
+	conn, client := startTest(t, &Config{GracePeriod: time.Second}, socket)
+	read := readAll(client)
+
+	if err := client.WriteMessage(websocket.CloseMessage, websocket.FormatCloseMessage(4001, "bye")); err != nil {
+		t.Fatalf("write: %v", err)
+	}
+	if err := receive(t, read); !websocket.IsCloseError(err, 4001) {
+		t.Fatalf("the client read %v, want the echo of its close code 4001", err)
+	}
+	select {
+	case event := <-socket.events:
+		if event != "OnClose 4001 bye" {
+			t.Fatalf("%s, want OnClose 4001 bye", event)
+		}
+	default:
+		t.Fatal("the close frame was echoed before OnClose")
+	}
+
+	if err := waitClosed(t, conn); !errors.Is(err, ErrCloseMessageReceived) {
+		t.Fatalf("Err() = %v, want ErrCloseMessageReceived", err)
+	}
+	if event := receive(t, socket.events); event != "OnDisconnect" {
+		t.Fatalf("%s after a clean close, want OnDisconnect", event)
+	}
+}
@@ -0,0 +1,144 @@
+package websocket_manager
+
+import (
+	"context"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"net/http"
+	"slices"
+	"strings"
+)
+
+// Identity is the identity of a client, established from its verified certificate chain.
+type Identity struct {
+	// Name identifies the client, e.g. the subject common name, a URI SAN or a SPIFFE ID.
+	// Registries key connections by it.
+	Name string
+	// Chain is the verified certificate chain of the client, leaf first.
+	Chain []*x509.Certificate
+}
+
+// IdentityMapper maps a verified certificate chain to an Identity.
+// It must return an error if the chain does not correspond to any identity.
+type IdentityMapper interface {
+	MapIdentity(chain []*x509.Certificate) (*Identity, error)
+}
+
+type IdentityMapperFunc func(chain []*x509.Certificate) (*Identity, error)
+
+func (f IdentityMapperFunc) MapIdentity(chain []*x509.Certificate) (*Identity, error) {
+	return f(chain)
+}
+
+// leafCertificate returns the leaf certificate of chain, the mappers reject an empty chain.
+func leafCertificate(chain []*x509.Certificate) (*x509.Certificate, error) {
+	if len(chain) == 0 || chain[0] == nil {
+		return nil, errors.New("empty certificate chain")
+	}
+
+	return chain[0], nil
+}
+
+// CommonNameMapper maps a chain to the subject common name of its leaf certificate.
+func CommonNameMapper() IdentityMapper {
+	return IdentityMapperFunc(func(chain []*x509.Certificate) (*Identity, error) {
+		leaf, err := leafCertificate(chain)
+		if err != nil {
+			return nil, err
+		}
+		if cn := leaf.Subject.CommonName; cn != "" {
+			return &Identity{Name: cn, Chain: chain}, nil
+		}
+
+		return nil, errors.New("certificate has no common name")
+	})
+}
+
+// URISANMapper maps a chain to the first URI SAN of its leaf certificate that has one of the given schemes.
+// If no scheme is given, the first URI SAN is used.
+func URISANMapper(schemes ...string) IdentityMapper {
+	return IdentityMapperFunc(func(chain []*x509.Certificate) (*Identity, error) {
+		leaf, err := leafCertificate(chain)
+		if err != nil {
+			return nil, err
+		}
+		for _, uri := range leaf.URIs {
+			if len(schemes) == 0 || slices.Contains(schemes, uri.Scheme) {
+				return &Identity{Name: uri.String(), Chain: chain}, nil
+			}
+		}
+
+		return nil, errors.New("certificate has no matching URI SAN")
+	})
+}
+
+// SPIFFEMapper maps a chain to the SPIFFE ID of its leaf certificate, see https://github.com/spiffe/spiffe/blob/main/standards/X509-SVID.md.
+// If trust domains are given, the SPIFFE ID must belong to one of them.
+func SPIFFEMapper(trustDomains ...string) IdentityMapper {
+	return IdentityMapperFunc(func(chain []*x509.Certificate) (*Identity, error) {
+		leaf, err := leafCertificate(chain)
+		if err != nil {
+			return nil, err
+		}
+		if len(leaf.URIs) != 1 || leaf.URIs[0].Scheme != "spiffe" {
+			return nil, errors.New("certificate must have exactly one spiffe URI SAN")
+		}
+
+		id := leaf.URIs[0]
+		if id.Host == "" || strings.Trim(id.Path, "/") == "" || id.User != nil || id.RawQuery != "" || id.Fragment != "" {
+			return nil, fmt.Errorf("malformed SPIFFE ID %q", id)
+		}
+		if len(trustDomains) > 0 && !slices.Contains(trustDomains, id.Host) {
+			return nil, fmt.Errorf("trust domain %q not allowed", id.Host)
+		}
+
+		return &Identity{Name: id.String(), Chain: chain}, nil
+	})
+}
+
+// ClientIdentity maps the verified certificate chain of the request to an Identity, it must be called before the connection is upgraded.
+// The chain is only available if the tls.Config of the server verifies client certificates, e.g. with tls.RequireAndVerifyClientCert.
+// Returns ErrClientCertificateMissing if the request carries no verified client certificate.
+// Returns ErrClientIdentityUnmapped if the mapper rejects the chain.
+func ClientIdentity(r *http.Request, mapper IdentityMapper) (*Identity, error) {
+	if r.TLS == nil || len(r.TLS.VerifiedChains) == 0 || len(r.TLS.VerifiedChains[0]) == 0 {
+		return nil, ErrClientCertificateMissing
+	}
+
+	identity, err := mapper.MapIdentity(r.TLS.VerifiedChains[0])
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrClientIdentityUnmapped, err)
+	}
+
+	return identity, nil
+}
+
+// RequireClientIdentity rejects requests that fail ClientIdentity before they reach next, and stores the Identity of the others in their context.
+// Requests without a certificate get http.StatusUnauthorized, requests with an unmapped certificate get http.StatusForbidden.
+// Use IdentityFromContext to retrieve it.
+func RequireClientIdentity(mapper IdentityMapper, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		identity, err := ClientIdentity(r, mapper)
+		if err != nil {
+			status := http.StatusForbidden
+			if errors.Is(err, ErrClientCertificateMissing) {
+				status = http.StatusUnauthorized
+			}
+			http.Error(w, http.StatusText(status), status)
+			return
+		}
+
+		next.ServeHTTP(w, r.WithContext(contextWithIdentity(r.Context(), identity)))
+	})
+}
+
+func contextWithIdentity(ctx context.Context, identity *Identity) context.Context {
+	return context.WithValue(ctx, identityContextKey, identity)
+}
+
+// IdentityFromContext returns the Identity stored by RequireClientIdentity, or nil if there is none.
+func IdentityFromContext(ctx context.Context) *Identity {
+	identity, _ := ctx.Value(identityContextKey).(*Identity)
+	return identity
+}
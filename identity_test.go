@@ -0,0 +1,129 @@
+package websocket_manager
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+)
+
+// testChain returns a chain whose leaf certificate has the common name cn and the URI SANs uris.
+func testChain(t testing.TB, cn string, uris ...string) []*x509.Certificate {
+	t.Helper()
+
+	leaf := &x509.Certificate{Subject: pkix.Name{CommonName: cn}}
+	for _, raw := range uris {
+		uri, err := url.Parse(raw)
+		if err != nil {
+			t.Fatal(err)
+		}
+		leaf.URIs = append(leaf.URIs, uri)
+	}
+
+	return []*x509.Certificate{leaf, {Subject: pkix.Name{CommonName: "ca"}}}
+}
+
+func TestIdentityMappers(t *testing.T) {
+	tests := []struct {
+		name   string
+		mapper IdentityMapper
+		chain  []*x509.Certificate
+		// wantName is the Name of the Identity, empty if the chain is rejected.
+		wantName string
+	}{
+		{"common name", CommonNameMapper(), testChain(t, "alice"), "alice"},
+		{"no common name", CommonNameMapper(), testChain(t, "", "spiffe://example.org/alice"), ""},
+		{"common name of an empty chain", CommonNameMapper(), nil, ""},
+		{"first URI SAN", URISANMapper(), testChain(t, "alice", "https://example.org/alice", "urn:alice"), "https://example.org/alice"},
+		{"URI SAN of a scheme", URISANMapper("urn"), testChain(t, "alice", "https://example.org/alice", "urn:alice"), "urn:alice"},
+		{"no URI SAN of the scheme", URISANMapper("urn"), testChain(t, "alice", "https://example.org/alice"), ""},
+		{"no URI SAN", URISANMapper(), testChain(t, "alice"), ""},
+		{"URI SAN of an empty chain", URISANMapper(), []*x509.Certificate{}, ""},
+		{"SPIFFE ID", SPIFFEMapper(), testChain(t, "", "spiffe://example.org/workload/alice"), "spiffe://example.org/workload/alice"},
+		{"SPIFFE ID of a trust domain", SPIFFEMapper("other.org", "example.org"), testChain(t, "", "spiffe://example.org/alice"), "spiffe://example.org/alice"},
+		{"SPIFFE ID of another trust domain", SPIFFEMapper("other.org"), testChain(t, "", "spiffe://example.org/alice"), ""},
+		{"SPIFFE ID without a path", SPIFFEMapper(), testChain(t, "", "spiffe://example.org/"), ""},
+		{"SPIFFE ID without a trust domain", SPIFFEMapper(), testChain(t, "", "spiffe:///alice"), ""},
+		{"SPIFFE ID with a user", SPIFFEMapper(), testChain(t, "", "spiffe://user@example.org/alice"), ""},
+		{"SPIFFE ID with a query", SPIFFEMapper(), testChain(t, "", "spiffe://example.org/alice?admin=1"), ""},
+		{"SPIFFE ID with a fragment", SPIFFEMapper(), testChain(t, "", "spiffe://example.org/alice#admin"), ""},
+		{"two SPIFFE IDs", SPIFFEMapper(), testChain(t, "", "spiffe://example.org/alice", "spiffe://example.org/bob"), ""},
+		{"not a SPIFFE ID", SPIFFEMapper(), testChain(t, "", "https://example.org/alice"), ""},
+		{"SPIFFE ID of an empty chain", SPIFFEMapper(), nil, ""},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			identity, err := tc.mapper.MapIdentity(tc.chain)
+			if tc.wantName == "" {
+				if err == nil {
+					t.Fatalf("MapIdentity = %q, want an error", identity.Name)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("MapIdentity: %v", err)
+			}
+			if identity.Name != tc.wantName || len(identity.Chain) != len(tc.chain) {
+				t.Fatalf("MapIdentity = %q with %d certificates, want %q with %d", identity.Name, len(identity.Chain), tc.wantName, len(tc.chain))
+			}
+		})
+	}
+}
+
+// RequireClientIdentity answers http.StatusUnauthorized without a verified certificate and http.StatusForbidden if it is not mapped.
+func TestRequireClientIdentity(t *testing.T) {
+	tests := []struct {
+		name       string
+		tls        *tls.ConnectionState
+		wantStatus int
+		// wantName is the Name of the Identity next receives.
+		wantName string
+	}{
+		{"plain HTTP", nil, http.StatusUnauthorized, ""},
+		{"no verified chain", &tls.ConnectionState{}, http.StatusUnauthorized, ""},
+		{"empty verified chain", &tls.ConnectionState{VerifiedChains: [][]*x509.Certificate{{}}}, http.StatusUnauthorized, ""},
+		{"unmapped certificate", &tls.ConnectionState{VerifiedChains: [][]*x509.Certificate{testChain(t, "")}}, http.StatusForbidden, ""},
+		{"mapped certificate", &tls.ConnectionState{VerifiedChains: [][]*x509.Certificate{testChain(t, "alice")}}, http.StatusOK, "alice"},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			var got *Identity
+			handler := RequireClientIdentity(CommonNameMapper(), http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				got = IdentityFromContext(r.Context())
+			}))
+			r := httptest.NewRequest("GET", "/", nil)
+			r.TLS = tc.tls
+			w := httptest.NewRecorder()
+
+			handler.ServeHTTP(w, r)
+			if w.Code != tc.wantStatus {
+				t.Fatalf("status %d, want %d", w.Code, tc.wantStatus)
+			}
+			if tc.wantName == "" {
+				if got != nil {
+					t.Fatalf("next received the Identity %q of a rejected request", got.Name)
+				}
+				return
+			}
+			if got == nil || got.Name != tc.wantName {
+				t.Fatalf("next received %+v, want the Identity %q", got, tc.wantName)
+			}
+		})
+	}
+}
+
+func TestClientIdentityErrors(t *testing.T) {
+	r := httptest.NewRequest("GET", "/", nil)
+	if _, err := ClientIdentity(r, CommonNameMapper()); !errors.Is(err, ErrClientCertificateMissing) {
+		t.Fatalf("ClientIdentity = %v, want ErrClientCertificateMissing", err)
+	}
+
+	r.TLS = &tls.ConnectionState{VerifiedChains: [][]*x509.Certificate{testChain(t, "alice")}}
+	if _, err := ClientIdentity(r, URISANMapper()); !errors.Is(err, ErrClientIdentityUnmapped) {
+		t.Fatalf("ClientIdentity = %v, want ErrClientIdentityUnmapped", err)
+	}
+}
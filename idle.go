@@ -0,0 +1,112 @@
+package websocket_manager
+
+import (
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+// IdleDirection tells which of the idle timeouts of the Config was exceeded.
+type IdleDirection int
+
+const (
+	// IdleAny no message was read or written within Config.IdleTimeout.
+	IdleAny IdleDirection = iota
+	// IdleInbound no message was read within Config.InboundIdleTimeout.
+	IdleInbound
+	// IdleOutbound no message was written within Config.OutboundIdleTimeout.
+	IdleOutbound
+)
+
+func (d IdleDirection) String() string {
+	switch d {
+	case IdleAny:
+		return "any"
+	case IdleInbound:
+		return "inbound"
+	case IdleOutbound:
+		return "outbound"
+	default:
+		return "unknown"
+	}
+}
+
+// IdleHandler can optionally be implemented by a Socket to veto or extend an idle close.
+type IdleHandler interface {
+	// OnIdle will be called when the connection exceeds the idle timeout of the given direction.
+	// Returning 0 lets the worker close the connection, a positive duration postpones the idle checks by that long.
+	// It should finish quickly since it blocks the writer.
+	OnIdle(direction IdleDirection) time.Duration
+}
+
+// idleCloseMessage is sent to the client when the connection is closed for being idle.
+var idleCloseMessage = CloseMessage(websocket.CloseGoingAway, "Idle timeout exceeded.")
+
+// idleTracker decides when the connection exceeds one of the idle timeouts of the Config, it is only used by the writer goroutine.
+type idleTracker struct {
+	stats *stats
+	conf  *Config
+	// extendedUntil is the time until which an IdleHandler postponed the idle checks.
+	extendedUntil time.Time
+}
+
+func (c *Config) isIdleTimeoutConfigured() bool {
+	return c.IdleTimeout > 0 || c.InboundIdleTimeout > 0 || c.OutboundIdleTimeout > 0
+}
+
+// deadlines returns the time at which each configured direction becomes idle.
+func (t *idleTracker) deadlines() map[IdleDirection]time.Time {
+	lastRead := time.Unix(0, t.stats.lastMessageRead.Load())
+	lastWritten := time.Unix(0, t.stats.lastMessageWritten.Load())
+	deadlines := make(map[IdleDirection]time.Time, 3)
+	if t.conf.IdleTimeout > 0 {
+		last := lastRead
+		if lastWritten.After(last) {
+			last = lastWritten
+		}
+		deadlines[IdleAny] = t.postponed(last.Add(t.conf.IdleTimeout))
+	}
+	if t.conf.InboundIdleTimeout > 0 {
+		deadlines[IdleInbound] = t.postponed(lastRead.Add(t.conf.InboundIdleTimeout))
+	}
+	if t.conf.OutboundIdleTimeout > 0 {
+		deadlines[IdleOutbound] = t.postponed(lastWritten.Add(t.conf.OutboundIdleTimeout))
+	}
+
+	return deadlines
+}
+
+func (t *idleTracker) postponed(deadline time.Time) time.Time {
+	if t.extendedUntil.After(deadline) {
+		return t.extendedUntil
+	}
+
+	return deadline
+}
+
+// next returns how long to wait before checking again, and the direction that is idle if any.
+func (t *idleTracker) next(now time.Time) (time.Duration, IdleDirection, bool) {
+	var wait time.Duration
+	first := true
+	deadlines := t.deadlines()
+	for _, direction := range []IdleDirection{IdleAny, IdleInbound, IdleOutbound} {
+		deadline, ok := deadlines[direction]
+		if !ok {
+			continue
+		}
+		if !deadline.After(now) {
+			return 0, direction, true
+		}
+		if remaining := deadline.Sub(now); first || remaining < wait {
+			wait = remaining
+			first = false
+		}
+	}
+
+	return wait, 0, false
+}
+
+// extend postpones the idle checks by d.
+func (t *idleTracker) extend(now time.Time, d time.Duration) {
+	t.extendedUntil = now.Add(d)
+}
@@ -0,0 +1,182 @@
+package websocket_manager
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/ed25519"
+	"crypto/hmac"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"math"
+	"strings"
+	"time"
+)
+
+// Supported JWT signing algorithms.
+const (
+	JWTAlgorithmHS256 = "HS256"
+	JWTAlgorithmRS256 = "RS256"
+	JWTAlgorithmEdDSA = "EdDSA"
+)
+
+// Claims are the claims of a verified JWT.
+type Claims map[string]any
+
+// Subject returns the "sub" claim, or an empty string if it is not set.
+func (c Claims) Subject() string {
+	sub, _ := c["sub"].(string)
+	return sub
+}
+
+// ExpiresAt returns the "exp" claim, reports false if it is not set.
+// The claims of a verified JWT never hold a malformed "exp" claim, the token is rejected.
+func (c Claims) ExpiresAt() (time.Time, bool) {
+	exp, ok, _ := c.time("exp")
+	return exp, ok
+}
+
+// NotBefore returns the "nbf" claim, reports false if it is not set.
+// The claims of a verified JWT never hold a malformed "nbf" claim, the token is rejected.
+func (c Claims) NotBefore() (time.Time, bool) {
+	nbf, ok, _ := c.time("nbf")
+	return nbf, ok
+}
+
+// Issuer returns the "iss" claim, or an empty string if it is not set.
+func (c Claims) Issuer() string {
+	iss, _ := c["iss"].(string)
+	return iss
+}
+
+// HasAudience reports whether the "aud" claim, either a string or an array of strings, contains aud.
+func (c Claims) HasAudience(aud string) bool {
+	switch val := c["aud"].(type) {
+	case string:
+		return val == aud
+	case []any:
+		for _, item := range val {
+			if item == aud {
+				return true
+			}
+		}
+	}
+
+	return false
+}
+
+// time returns the NumericDate claim name, reports false if it is not set.
+// Returns ErrAuthTokenInvalid if it is set but is not a number of seconds that a time.Time can hold.
+func (c Claims) time(name string) (time.Time, bool, error) {
+	val, ok := c[name]
+	if !ok {
+		return time.Time{}, false, nil
+	}
+
+	num, ok := val.(json.Number)
+	if !ok {
+		return time.Time{}, false, fmt.Errorf("%w: %q claim is not a number", ErrAuthTokenInvalid, name)
+	}
+	seconds, err := num.Float64()
+	if err != nil || math.IsNaN(seconds) || math.Abs(seconds) >= math.MaxInt64 {
+		return time.Time{}, false, fmt.Errorf("%w: %q claim is out of range", ErrAuthTokenInvalid, name)
+	}
+
+	whole, frac := math.Modf(seconds)
+	return time.Unix(int64(whole), int64(frac*float64(time.Second))), true, nil
+}
+
+type jwtHeader struct {
+	Alg string `json:"alg"`
+	Kid string `json:"kid"`
+}
+
+// parseJWT verifies the signature of a compact serialized JWT and returns its claims.
+// The time based claims are only checked to be well formed.
+func parseJWT(token string, keyFunc func(alg, kid string) (any, error)) (Claims, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return nil, fmt.Errorf("%w: malformed token", ErrAuthTokenInvalid)
+	}
+
+	var header jwtHeader
+	if err := decodeJWTSegment(parts[0], &header); err != nil {
+		return nil, fmt.Errorf("%w: malformed header: %w", ErrAuthTokenInvalid, err)
+	}
+
+	signature, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return nil, fmt.Errorf("%w: malformed signature: %w", ErrAuthTokenInvalid, err)
+	}
+
+	key, err := keyFunc(header.Alg, header.Kid)
+	if err != nil {
+		return nil, fmt.Errorf("%w: no key for alg=%s kid=%s: %w", ErrAuthTokenInvalid, header.Alg, header.Kid, err)
+	}
+
+	if err := verifyJWTSignature(header.Alg, key, []byte(parts[0]+"."+parts[1]), signature); err != nil {
+		return nil, err
+	}
+
+	var claims Claims
+	if err := decodeJWTSegment(parts[1], &claims); err != nil {
+		return nil, fmt.Errorf("%w: malformed claims: %w", ErrAuthTokenInvalid, err)
+	}
+	for _, name := range []string{"exp", "nbf"} {
+		if _, _, err := claims.time(name); err != nil {
+			return nil, err
+		}
+	}
+
+	return claims, nil
+}
+
+// verifyJWTSignature checks signature against the signing input, the type of key must match the alg.
+func verifyJWTSignature(alg string, key any, signingInput, signature []byte) error {
+	switch alg {
+	case JWTAlgorithmHS256:
+		secret, ok := key.([]byte)
+		if !ok {
+			return fmt.Errorf("%w: %s requires a []byte key, got %T", ErrAuthTokenInvalid, alg, key)
+		}
+		mac := hmac.New(sha256.New, secret)
+		mac.Write(signingInput)
+		if !hmac.Equal(mac.Sum(nil), signature) {
+			return fmt.Errorf("%w: bad signature", ErrAuthTokenInvalid)
+		}
+	case JWTAlgorithmRS256:
+		pub, ok := key.(*rsa.PublicKey)
+		if !ok {
+			return fmt.Errorf("%w: %s requires an *rsa.PublicKey key, got %T", ErrAuthTokenInvalid, alg, key)
+		}
+		digest := sha256.Sum256(signingInput)
+		if err := rsa.VerifyPKCS1v15(pub, crypto.SHA256, digest[:], signature); err != nil {
+			return fmt.Errorf("%w: bad signature: %w", ErrAuthTokenInvalid, err)
+		}
+	case JWTAlgorithmEdDSA:
+		pub, ok := key.(ed25519.PublicKey)
+		if !ok {
+			return fmt.Errorf("%w: %s requires an ed25519.PublicKey key, got %T", ErrAuthTokenInvalid, alg, key)
+		}
+		if !ed25519.Verify(pub, signingInput, signature) {
+			return fmt.Errorf("%w: bad signature", ErrAuthTokenInvalid)
+		}
+	default:
+		return fmt.Errorf("%w: unsupported algorithm %q", ErrAuthTokenInvalid, alg)
+	}
+
+	return nil
+}
+
+func decodeJWTSegment(segment string, v any) error {
+	data, err := base64.RawURLEncoding.DecodeString(segment)
+	if err != nil {
+		return err
+	}
+
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+	return decoder.Decode(v)
+}
@@ -0,0 +1,146 @@
+package websocket_manager
+
+import (
+	"crypto"
+	"crypto/ed25519"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"strings"
+	"testing"
+)
+
+// signJWT returns a compact serialized JWT of claims signed with key, which must match alg.
+// An unsupported alg, e.g. "none", gets an empty signature.
+func signJWT(t testing.TB, alg string, key any, claims map[string]any) string {
+	t.Helper()
+
+	header, _ := json.Marshal(map[string]string{"alg": alg, "typ": "JWT"})
+	payload, err := json.Marshal(claims)
+	if err != nil {
+		t.Fatal(err)
+	}
+	input := base64.RawURLEncoding.EncodeToString(header) + "." + base64.RawURLEncoding.EncodeToString(payload)
+
+	var signature []byte
+	switch alg {
+	case JWTAlgorithmHS256:
+		mac := hmac.New(sha256.New, key.([]byte))
+		mac.Write([]byte(input))
+		signature = mac.Sum(nil)
+	case JWTAlgorithmRS256:
+		digest := sha256.Sum256([]byte(input))
+		signature, err = rsa.SignPKCS1v15(rand.Reader, key.(*rsa.PrivateKey), crypto.SHA256, digest[:])
+		if err != nil {
+			t.Fatal(err)
+		}
+	case JWTAlgorithmEdDSA:
+		signature = ed25519.Sign(key.(ed25519.PrivateKey), []byte(input))
+	}
+
+	return input + "." + base64.RawURLEncoding.EncodeToString(signature)
+}
+
+// testJWTKeys are the keys of every supported algorithm.
+type testJWTKeys struct {
+	secret     []byte
+	rsa        *rsa.PrivateKey
+	ed25519    ed25519.PrivateKey
+	ed25519Pub ed25519.PublicKey
+}
+
+func newTestJWTKeys(t testing.TB) testJWTKeys {
+	t.Helper()
+
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pub, priv, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return testJWTKeys{secret: []byte("secret"), rsa: rsaKey, ed25519: priv, ed25519Pub: pub}
+}
+
+// key is a JWTAuthenticator.Key returning the verifying key of alg.
+func (k testJWTKeys) key(alg, _ string) (any, error) {
+	switch alg {
+	case JWTAlgorithmHS256:
+		return k.secret, nil
+	case JWTAlgorithmRS256:
+		return &k.rsa.PublicKey, nil
+	case JWTAlgorithmEdDSA:
+		return k.ed25519Pub, nil
+	}
+
+	return nil, errors.New("unknown algorithm")
+}
+
+func TestParseJWT(t *testing.T) {
+	keys := newTestJWTKeys(t)
+	claims := map[string]any{"sub": "alice"}
+	tampered := func(token string) string {
+		parts := strings.Split(token, ".")
+		payload, _ := json.Marshal(map[string]any{"sub": "mallory"})
+		return parts[0] + "." + base64.RawURLEncoding.EncodeToString(payload) + "." + parts[2]
+	}
+
+	tests := []struct {
+		name  string
+		token string
+		key   func(alg, kid string) (any, error)
+		// wantErr is nil if the token is valid, its subject is then alice.
+		wantErr error
+	}{
+		{"HS256", signJWT(t, JWTAlgorithmHS256, keys.secret, claims), keys.key, nil},
+		{"RS256", signJWT(t, JWTAlgorithmRS256, keys.rsa, claims), keys.key, nil},
+		{"EdDSA", signJWT(t, JWTAlgorithmEdDSA, keys.ed25519, claims), keys.key, nil},
+		{"HS256 with another secret", signJWT(t, JWTAlgorithmHS256, []byte("other"), claims), keys.key, ErrAuthTokenInvalid},
+		{
+			name: "HS256 signed with the public key of RS256",
+			token: signJWT(t, JWTAlgorithmHS256, func() []byte {
+				b, _ := json.Marshal(keys.rsa.PublicKey)
+				return b
+			}(), claims),
+			key:     func(string, string) (any, error) { return &keys.rsa.PublicKey, nil },
+			wantErr: ErrAuthTokenInvalid,
+		},
+		{
+			name:    "EdDSA with the key of RS256",
+			token:   signJWT(t, JWTAlgorithmEdDSA, keys.ed25519, claims),
+			key:     func(string, string) (any, error) { return &keys.rsa.PublicKey, nil },
+			wantErr: ErrAuthTokenInvalid,
+		},
+		{"alg none", signJWT(t, "none", nil, claims), func(string, string) (any, error) { return nil, nil }, ErrAuthTokenInvalid},
+		{"tampered HS256 payload", tampered(signJWT(t, JWTAlgorithmHS256, keys.secret, claims)), keys.key, ErrAuthTokenInvalid},
+		{"tampered RS256 payload", tampered(signJWT(t, JWTAlgorithmRS256, keys.rsa, claims)), keys.key, ErrAuthTokenInvalid},
+		{"tampered EdDSA payload", tampered(signJWT(t, JWTAlgorithmEdDSA, keys.ed25519, claims)), keys.key, ErrAuthTokenInvalid},
+		{"not a JWT", "token", keys.key, ErrAuthTokenInvalid},
+		{"exp not a number", signJWT(t, JWTAlgorithmHS256, keys.secret, map[string]any{"sub": "alice", "exp": "tomorrow"}), keys.key, ErrAuthTokenInvalid},
+		{"nbf not a number", signJWT(t, JWTAlgorithmHS256, keys.secret, map[string]any{"sub": "alice", "nbf": true}), keys.key, ErrAuthTokenInvalid},
+		{"exp out of range", signJWT(t, JWTAlgorithmHS256, keys.secret, map[string]any{"sub": "alice", "exp": 1e300}), keys.key, ErrAuthTokenInvalid},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			claims, err := parseJWT(tc.token, tc.key)
+			if tc.wantErr != nil {
+				if !errors.Is(err, tc.wantErr) {
+					t.Fatalf("parseJWT = %v, want %v", err, tc.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("parseJWT: %v", err)
+			}
+			if claims.Subject() != "alice" {
+				t.Fatalf("subject %q, want alice", claims.Subject())
+			}
+		})
+	}
+}
@@ -0,0 +1,32 @@
+package websocket_manager
+
+import (
+	"math/rand/v2"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+// defaultMaxLifetimeCloseMessage hints the client to reconnect once Config.MaxLifetime elapses.
+var defaultMaxLifetimeCloseMessage = CloseMessage(websocket.CloseServiceRestart, "Reconnect.")
+
+func (c *Config) isMaxLifetimeConfigured() bool {
+	return c.MaxLifetime > 0
+}
+
+// lifetime returns the lifetime of a new connection, the MaxLifetime plus a random jitter.
+func (c *Config) lifetime() time.Duration {
+	if c.MaxLifetimeJitter <= 0 {
+		return c.MaxLifetime
+	}
+
+	return c.MaxLifetime + rand.N(c.MaxLifetimeJitter)
+}
+
+func (c *Config) maxLifetimeCloseMessage() Message {
+	if c.MaxLifetimeCloseMessage == nil {
+		return defaultMaxLifetimeCloseMessage
+	}
+
+	return c.MaxLifetimeCloseMessage
+}
@@ -0,0 +1,68 @@
+package websocket_manager
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+)
+
+// LogAttrsProvider can optionally be implemented by a SocketCreator or a Socket to add attributes to the log lines of the connection,
+// e.g. the user it belongs to. The attributes of the SocketCreator come first.
+type LogAttrsProvider interface {
+	LogAttrs() []slog.Attr
+}
+
+// connLogger returns the logger of a connection, enriched with its ID and the attributes of the SocketCreator and the Socket.
+func connLogger(conf *Config, id string, socketCreator SocketCreator, socket Socket) *slog.Logger {
+	if conf.Logger == nil {
+		return slog.New(slog.DiscardHandler)
+	}
+
+	attrs := []slog.Attr{slog.String("connection_id", id)}
+	if provider, ok := socketCreator.(LogAttrsProvider); ok {
+		attrs = append(attrs, provider.LogAttrs()...)
+	}
+	if provider, ok := socketAs[LogAttrsProvider](socket); ok {
+		attrs = append(attrs, provider.LogAttrs()...)
+	}
+
+	return slog.New(conf.Logger.Handler().WithAttrs(attrs))
+}
+
+// logClose logs why the connection was closed, at the warning level unless the close handshake was completed or the connection was closed by Conn.Close.
+func (w *worker) logClose(cause error, clientCloseMessage *ClientCloseMessage, closeCode int) {
+	attrs := []any{slog.Any("cause", cause)}
+	if closeCode != 0 {
+		attrs = append(attrs, slog.Int("close_code", closeCode))
+	}
+	if clientCloseMessage != nil {
+		attrs = append(attrs, slog.Int("client_close_code", clientCloseMessage.Code), slog.String("client_close_text", clientCloseMessage.Text))
+	}
+
+	level := slog.LevelWarn
+	if IsCleanClose(cause) || errors.Is(cause, ErrConnectionClosed) {
+		level = slog.LevelInfo
+	}
+	w.logger.Log(context.Background(), level, "websocket closed", attrs...)
+}
+
+// ContextWithConn returns a copy of ctx that carries conn, see LoggerFromContext.
+func ContextWithConn(ctx context.Context, conn *Conn) context.Context {
+	return context.WithValue(ctx, connContextKey, conn)
+}
+
+// ConnFromContext returns the Conn stored by ContextWithConn, or nil if there is none.
+func ConnFromContext(ctx context.Context) *Conn {
+	conn, _ := ctx.Value(connContextKey).(*Conn)
+	return conn
+}
+
+// LoggerFromContext returns the logger of the Conn stored by ContextWithConn, so that Socket code logs with the same attributes as the worker.
+// Returns slog.Default if ctx carries no Conn.
+func LoggerFromContext(ctx context.Context) *slog.Logger {
+	if conn := ConnFromContext(ctx); conn != nil {
+		return conn.Logger()
+	}
+
+	return slog.Default()
+}
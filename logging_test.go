@@ -0,0 +1,162 @@
+package websocket_manager
+
+import (
+	"context"
+	"log/slog"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+// logRecord is a log line captured by captureHandler, its attributes include the ones of the logger.
+type logRecord struct {
+	message string
+	attrs   map[string]string
+	keys    []string
+	level   slog.Level
+}
+
+// captureHandler is a slog.Handler that sends every line to records.
+type captureHandler struct {
+	records chan logRecord
+	attrs   []slog.Attr
+}
+
+func newCaptureHandler() *captureHandler {
+	return &captureHandler{records: make(chan logRecord, 64)}
+}
+
+func (h *captureHandler) Enabled(context.Context, slog.Level) bool {
+	return true
+}
+
+func (h *captureHandler) Handle(_ context.Context, r slog.Record) error {
+	record := logRecord{message: r.Message, attrs: make(map[string]string), level: r.Level}
+	add := func(attr slog.Attr) bool {
+		record.attrs[attr.Key] = attr.Value.String()
+		record.keys = append(record.keys, attr.Key)
+		return true
+	}
+	for _, attr := range h.attrs {
+		add(attr)
+	}
+	r.Attrs(add)
+
+	h.records <- record
+	return nil
+}
+
+func (h *captureHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	return &captureHandler{records: h.records, attrs: append(slices.Clip(h.attrs), attrs...)}
+}
+
+func (h *captureHandler) WithGroup(string) slog.Handler {
+	return h
+}
+
+// next returns the next captured line with message, skipping the others.
+func (h *captureHandler) next(t testing.TB, message string) logRecord {
+	t.Helper()
+	for {
+		if record := receive(t, h.records); record.message == message {
+			return record
+		}
+	}
+}
+
+type logAttrsCreator struct {
+	socket Socket
+}
+
+func (c logAttrsCreator) Create() (Socket, error) {
+	return c.socket, nil
+}
+
+func (c logAttrsCreator) LogAttrs() []slog.Attr {
+	return []slog.Attr{slog.String("region", "eu")}
+}
+
+type logAttrsSocket struct {
+	*testSocket
+}
+
+func (s logAttrsSocket) LogAttrs() []slog.Attr {
+	return []slog.Attr{slog.String("user", "alice")}
+}
+
+// The logger of a connection adds its ID and the attributes of the SocketCreator then the Socket, LoggerFromContext hands it over.
+func TestConnLogger(t *testing.T) {
+	handler := newCaptureHandler()
+	conf := &Config{GracePeriod: time.Second, Logger: slog.New(handler)}
+	conn, _ := startTestWith(t, nil, func(ws *websocket.Conn, _ SocketCreator) (*Conn, error) {
+		return Start(ws, logAttrsCreator{socket: logAttrsSocket{newTestSocket()}}, conf)
+	})
+
+	LoggerFromContext(ContextWithConn(context.Background(), conn)).Info("hello", slog.String("key", "value"))
+	record := handler.next(t, "hello")
+	if want := []string{"connection_id", "region", "user", "key"}; !slices.Equal(record.keys, want) {
+		t.Fatalf("attributes %q, want %q", record.keys, want)
+	}
+	if record.attrs["connection_id"] != conn.ID() || record.attrs["region"] != "eu" || record.attrs["user"] != "alice" {
+		t.Fatalf("attributes %v, want the connection %s of alice in eu", record.attrs, conn.ID())
+	}
+
+	if logger := LoggerFromContext(context.Background()); logger != slog.Default() {
+		t.Fatal("LoggerFromContext without a Conn does not return slog.Default")
+	}
+}
+
+// Connections closed by a completed handshake or by Conn.Close log at the info level, the other causes at the warning level.
+func TestLogCloseLevel(t *testing.T) {
+	tests := []struct {
+		name      string
+		close     func(conn *Conn, client *websocket.Conn)
+		wantLevel slog.Level
+		// wantCloseCode is the close_code attribute, empty if it is not logged.
+		wantCloseCode string
+	}{
+		{
+			name: "closed by Conn.Close",
+			close: func(conn *Conn, client *websocket.Conn) {
+				_ = readAll(client)
+				_ = conn.Close(websocket.CloseGoingAway, "bye")
+			},
+			wantLevel:     slog.LevelInfo,
+			wantCloseCode: "1001",
+		},
+		{
+			name: "closed by the client",
+			close: func(_ *Conn, client *websocket.Conn) {
+				_ = client.WriteMessage(websocket.CloseMessage, websocket.FormatCloseMessage(websocket.CloseNormalClosure, ""))
+				_ = readAll(client)
+			},
+			wantLevel: slog.LevelInfo,
+		},
+		{
+			name:      "connection dropped",
+			close:     func(_ *Conn, client *websocket.Conn) { _ = client.UnderlyingConn().Close() },
+			wantLevel: slog.LevelWarn,
+		},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			handler := newCaptureHandler()
+			conn, client := startTest(t, &Config{GracePeriod: time.Second, CloseFrames: DefaultCloseFrames(), Logger: slog.New(handler)}, newTestSocket())
+
+			tc.close(conn, client)
+			_ = waitClosed(t, conn)
+			record := handler.next(t, "websocket closed")
+			if record.level != tc.wantLevel {
+				t.Fatalf("logged at %s for %s, want %s", record.level, record.attrs["cause"], tc.wantLevel)
+			}
+			if record.attrs["close_code"] != tc.wantCloseCode {
+				t.Fatalf("close_code %q, want %q", record.attrs["close_code"], tc.wantCloseCode)
+			}
+			if record.attrs["connection_id"] != conn.ID() {
+				t.Fatalf("connection_id %q, want %s", record.attrs["connection_id"], conn.ID())
+			}
+		})
+	}
+}
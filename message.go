@@ -1,6 +1,7 @@
 package websocket_manager
 
 import (
+	"encoding/binary"
 	"errors"
 	"fmt"
 	"time"
@@ -17,14 +18,16 @@ type Message interface {
 }
 
 func TextMessage(payload string) Message {
-	msg, err := websocket.NewPreparedMessage(websocket.TextMessage, []byte(payload))
+	data := []byte(payload)
+	msg, err := websocket.NewPreparedMessage(websocket.TextMessage, data)
 	if err != nil {
 		panic(fmt.Errorf("failed to prepare text message: %w (%s)", err, payload))
 	}
 
 	return &message{
-		typ: websocket.TextMessage,
-		msg: msg,
+		typ:  websocket.TextMessage,
+		msg:  msg,
+		data: data,
 	}
 }
 
@@ -35,8 +38,9 @@ func BinaryMessage(payload []byte) Message {
 	}
 
 	return &message{
-		typ: websocket.BinaryMessage,
-		msg: msg,
+		typ:  websocket.BinaryMessage,
+		msg:  msg,
+		data: payload,
 	}
 }
 
@@ -47,8 +51,9 @@ func PingMessage(payload []byte) Message {
 	}
 
 	return &message{
-		typ: websocket.PingMessage,
-		msg: msg,
+		typ:  websocket.PingMessage,
+		msg:  msg,
+		data: payload,
 	}
 }
 
@@ -56,20 +61,24 @@ func PingMessage(payload []byte) Message {
 // Check valid status codes at https://pkg.go.dev/github.com/gorilla/websocket#pkg-constants.
 // Panics if it cannot prepare the message.
 func CloseMessage(status int, payload string) Message {
-	msg, err := websocket.NewPreparedMessage(websocket.CloseMessage, websocket.FormatCloseMessage(status, payload))
+	data := websocket.FormatCloseMessage(status, payload)
+	msg, err := websocket.NewPreparedMessage(websocket.CloseMessage, data)
 	if err != nil {
 		panic(fmt.Errorf("failed to prepare close message: %w (status=%d, payload=%s)", err, status, payload))
 	}
 
 	return &message{
-		typ: websocket.CloseMessage,
-		msg: msg,
+		typ:  websocket.CloseMessage,
+		msg:  msg,
+		data: data,
 	}
 }
 
 type message struct {
 	msg *websocket.PreparedMessage
-	typ int
+	// data is the payload, shared with the PreparedMessage.
+	data []byte
+	typ  int
 }
 
 func (m *message) Write(conn *websocket.Conn, timeout time.Duration) error {
@@ -77,22 +86,92 @@ func (m *message) Write(conn *websocket.Conn, timeout time.Duration) error {
 		_ = conn.SetWriteDeadline(time.Now().Add(timeout))
 	}
 	if err := conn.WritePreparedMessage(m.msg); err != nil {
-		if isConnectionClosedError(err) {
-			return fmt.Errorf("%w: %w", ErrConnectionClosed, err)
-		}
-		if isTimeoutExceededError(err) {
-			return fmt.Errorf("%w: %w", ErrWriteTimeoutExceeded, err)
-		}
-		return err
+		return wrapWriteError(err)
 	}
 
 	return nil
 }
 
+// wrapWriteError wraps errors of writing to the connection with ErrConnectionClosed or ErrWriteTimeoutExceeded when they apply.
+func wrapWriteError(err error) error {
+	if isConnectionClosedError(err) {
+		return fmt.Errorf("%w: %w", ErrConnectionClosed, err)
+	}
+	if isTimeoutExceededError(err) {
+		return fmt.Errorf("%w: %w", ErrWriteTimeoutExceeded, err)
+	}
+
+	return err
+}
+
 func (m *message) Type() int {
 	return m.typ
 }
 
+// Size returns the size of the payload.
+func (m *message) Size() int {
+	return len(m.data)
+}
+
+// payload returns the message type and payload, it allows the writer to encode the frame itself.
+func (m *message) payload() (int, []byte) {
+	return m.typ, m.data
+}
+
+// messageSize returns the payload size of msg if it implements a Size() int method, otherwise 0.
+func messageSize(msg Message) int {
+	if sized, ok := messageAs[interface{ Size() int }](msg); ok {
+		return sized.Size()
+	}
+
+	return 0
+}
+
+// messageAs finds the first Message in the chain of msg that implements T.
+// The chain consists of msg, followed by the Messages returned by repeatedly calling its Unwrap() Message method, if any.
+func messageAs[T any](msg Message) (T, bool) {
+	for msg != nil {
+		if target, ok := msg.(T); ok {
+			return target, true
+		}
+
+		wrapper, ok := msg.(interface{ Unwrap() Message })
+		if !ok {
+			break
+		}
+		msg = wrapper.Unwrap()
+	}
+
+	var zero T
+	return zero, false
+}
+
+// closeCode returns the status code of a close message, or 0 if it has none or it cannot be told.
+func closeCode(msg Message) int {
+	raw, ok := messageAs[interface{ payload() (int, []byte) }](msg)
+	if !ok {
+		return 0
+	}
+
+	typ, data := raw.payload()
+	if typ != websocket.CloseMessage || len(data) < 2 {
+		return 0
+	}
+
+	return int(binary.BigEndian.Uint16(data))
+}
+
+// sendableCloseCode reports whether code may be sent in a close message, 0 stands for a close message without a code.
+// The codes reserved for the endpoints (1004 to 1006 and 1015) and the ones outside the registered ranges cannot be sent.
+func sendableCloseCode(code int) bool {
+	switch {
+	case code == 0, code >= 1000 && code <= 1003, code >= 1007 && code <= 1014, code >= 3000 && code <= 4999:
+		return true
+	}
+
+	return false
+}
+
 type ClientCloseMessage struct {
 	Text string
 	Code int
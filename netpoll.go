@@ -0,0 +1,277 @@
+package websocket_manager
+
+import (
+	"runtime"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// eventWriter runs the writer of an event driven worker only when it is woken up, instead of keeping a goroutine waiting for work.
+// It is woken up by the messages and close requests queued through the Conn, by the messages relayed from the Socket channels, and by its timers.
+type eventWriter struct {
+	w *worker
+	s *writerState
+	// pending counts the wake ups that were not handled yet, the writer is scheduled while it is not zero.
+	pending atomic.Int32
+	// stopped is set once the writer stopped, it is only accessed by the running writer.
+	stopped bool
+}
+
+// newEventWriter makes w event driven, its timers wake the writer up when they fire.
+// The writer does not run until start is called, the wake ups received meanwhile are handled then.
+func newEventWriter(w *worker) *eventWriter {
+	e := &eventWriter{w: w}
+	e.pending.Store(1) // Held until start.
+	w.clock = wakingClock{Clock: w.clock, wake: e.wake}
+	w.wake = e.wake
+	return e
+}
+
+// start sets the writer up once the Socket is connected, and schedules it for the wake ups received so far.
+func (e *eventWriter) start() {
+	e.s = e.w.newWriterState()
+	e.relay()
+	writers.schedule(e)
+}
+
+func (e *eventWriter) wake() {
+	if e.pending.Add(1) == 1 {
+		writers.schedule(e)
+	}
+}
+
+// run writes whatever is ready for the wake ups received so far, and schedules the writer again if more were received meanwhile.
+// A single run is active at a time.
+func (e *eventWriter) run() {
+	n := e.pending.Load()
+	if !e.stopped && (e.w.State() == StateClosed || !e.w.pump(e.s)) {
+		e.stopped = true
+		e.w.stopWriter(e.s)
+	}
+	if e.pending.Add(-n) != 0 {
+		writers.schedule(e)
+	}
+}
+
+// relay forwards the messages of the WriterChannel and the priority lanes of the Socket to the writer through a single channel,
+// waking it up for each of them. It costs a goroutine per connection whose Socket has any of them, for as long as the connection is open.
+// Nothing wakes the writer up when a Socket sends on its own channels, so they cannot be read by the scheduled writer instead.
+// The messages of each channel keep their order, the lane messages keep the priority of their lane.
+func (e *eventWriter) relay() {
+	s := e.s
+	src, lanes := s.writerCh, s.lanes
+	if src == nil && lanes == [priorityCount]<-chan Message{} {
+		return
+	}
+
+	relayed := make(chan Message, 1)
+	s.writerCh, s.lanes = relayed, [priorityCount]<-chan Message{}
+	go func() {
+		for {
+			var msg Message
+			select {
+			case m, ok := <-src:
+				if !ok {
+					close(relayed) // Closes the connection like the WriterChannel would.
+					e.wake()
+					return
+				}
+				msg = m
+			case m, ok := <-lanes[PriorityControl]:
+				msg = laneMessage(&lanes[PriorityControl], m, ok, PriorityControl)
+			case m, ok := <-lanes[PriorityHigh]:
+				msg = laneMessage(&lanes[PriorityHigh], m, ok, PriorityHigh)
+			case m, ok := <-lanes[PriorityNormal]:
+				msg = laneMessage(&lanes[PriorityNormal], m, ok, PriorityNormal)
+			case m, ok := <-lanes[PriorityBulk]:
+				msg = laneMessage(&lanes[PriorityBulk], m, ok, PriorityBulk)
+			case <-e.w.writerDone:
+				return
+			}
+			if msg == nil {
+				continue
+			}
+
+			select {
+			case relayed <- msg:
+				e.wake()
+			case <-e.w.writerDone:
+				return
+			}
+		}
+	}()
+}
+
+// laneMessage returns a message received from the lane of priority, with that priority unless it has its own.
+// A closed lane is set to nil and no message is returned, like the writer does.
+func laneMessage(lane *<-chan Message, msg Message, ok bool, priority Priority) Message {
+	if !ok {
+		*lane = nil
+		return nil
+	}
+	if prioritized, ok := messageAs[interface{ Priority() Priority }](msg); ok && prioritized.Priority().valid() {
+		return msg
+	}
+
+	return WithPriority(msg, priority)
+}
+
+// writers is the writeScheduler shared by the event driven workers.
+var writers = &writeScheduler{}
+
+// writeScheduler runs the event driven writers that were woken up on at most runtime.GOMAXPROCS goroutines shared by all of them.
+// Its goroutines are started when writers are scheduled and exit once none is left, so that none is held while no writer is scheduled.
+// A writer holds one of them while it runs, including while a write waits on a slow client up to the Config.WriteTimeout.
+// A batch waiting for the Coalescing.MaxDelay holds none, its timer wakes the writer up.
+type writeScheduler struct {
+	queue   []*eventWriter
+	running int
+	mu      sync.Mutex
+}
+
+// schedule queues e to run, a writer scheduled again after running goes behind the writers already waiting.
+func (s *writeScheduler) schedule(e *eventWriter) {
+	s.mu.Lock()
+	s.queue = append(s.queue, e)
+	start := s.running < runtime.GOMAXPROCS(0)
+	if start {
+		s.running++
+	}
+	s.mu.Unlock()
+
+	if start {
+		go s.serve()
+	}
+}
+
+func (s *writeScheduler) serve() {
+	for {
+		s.mu.Lock()
+		if len(s.queue) == 0 {
+			s.running--
+			s.mu.Unlock()
+			return
+		}
+		e := s.queue[0]
+		s.queue[0] = nil
+		s.queue = s.queue[1:]
+		s.mu.Unlock()
+
+		e.run()
+	}
+}
+
+// wakingClock wraps the Clock of an event driven worker so that its timers and tickers wake the writer up when they fire.
+// They are built on Clock.AfterFunc, so no goroutine waits on them.
+type wakingClock struct {
+	Clock
+	wake func()
+}
+
+func (c wakingClock) NewTimer(d time.Duration) Timer {
+	t := &wakingTimer{clock: c, c: make(chan time.Time, 1)}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.arm(d)
+	return t
+}
+
+func (c wakingClock) NewTicker(d time.Duration) Ticker {
+	t := &wakingTimer{clock: c, c: make(chan time.Time, 1), period: d}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.arm(d)
+	return wakingTicker{t: t}
+}
+
+// wakingTimer is a timer, or a ticker if it has a period, of a wakingClock.
+// Every arming gets its own generation, so that an AfterFunc that fires after a Stop or Reset delivers no stale value.
+type wakingTimer struct {
+	clock  wakingClock
+	c      chan time.Time
+	timer  Timer
+	period time.Duration
+	gen    uint64
+	active bool
+	mu     sync.Mutex
+}
+
+// arm schedules the next firing, it must be called with the lock held.
+func (t *wakingTimer) arm(d time.Duration) {
+	t.gen++
+	gen := t.gen
+	t.active = true
+	t.timer = t.clock.Clock.AfterFunc(d, func() { t.fire(gen) })
+}
+
+func (t *wakingTimer) fire(gen uint64) {
+	t.mu.Lock()
+	if gen != t.gen {
+		t.mu.Unlock()
+		return
+	}
+	select {
+	case t.c <- t.clock.Now():
+	default: // A ticker that falls behind drops ticks, like a time.Ticker.
+	}
+	if t.period > 0 {
+		t.arm(t.period)
+	} else {
+		t.active = false
+	}
+	t.mu.Unlock()
+
+	t.clock.wake()
+}
+
+// disarm cancels the pending firing and drains the channel, it must be called with the lock held.
+func (t *wakingTimer) disarm() bool {
+	active := t.active
+	t.timer.Stop()
+	t.gen++
+	t.active = false
+	select {
+	case <-t.c:
+	default:
+	}
+
+	return active
+}
+
+func (t *wakingTimer) C() <-chan time.Time {
+	return t.c
+}
+
+func (t *wakingTimer) Stop() bool {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.disarm()
+}
+
+func (t *wakingTimer) Reset(d time.Duration) bool {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	active := t.disarm()
+	if t.period > 0 {
+		t.period = d
+	}
+	t.arm(d)
+	return active
+}
+
+type wakingTicker struct {
+	t *wakingTimer
+}
+
+func (t wakingTicker) C() <-chan time.Time {
+	return t.t.C()
+}
+
+func (t wakingTicker) Stop() {
+	t.t.Stop()
+}
+
+func (t wakingTicker) Reset(d time.Duration) {
+	t.t.Reset(d)
+}
@@ -0,0 +1,548 @@
+//go:build linux
+
+package websocket_manager
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"syscall"
+	"unicode/utf8"
+
+	"github.com/gorilla/websocket"
+)
+
+const (
+	// netpollReadSize is the space made available in the read buffer of a connection before each read.
+	netpollReadSize = 4096
+	// netpollEventBatch is how many epoll events are collected at once.
+	netpollEventBatch = 256
+	// epollET is syscall.EPOLLET, which is declared as a negative constant.
+	epollET = 1 << 31
+)
+
+// Netpoll runs connections on a single epoll event loop instead of a reader and a writer goroutine each.
+// An idle connection holds no read buffer, the writes that are ready run on at most runtime.GOMAXPROCS goroutines shared by the connections.
+// It holds no goroutine either, unless its Socket has a WriterChannel or priority lanes, which take a goroutine relaying them, see below.
+// It is meant for servers holding many mostly idle connections, Start is the better fit otherwise.
+// Netpoll reads the connection itself, so the websocket.Upgrader can use a small ReadBufferSize, e.g. 256, and a WriteBufferPool to keep the buffers of gorilla/websocket small while idle.
+//
+// It comes with trade-offs:
+//   - The connection must be a plain TCP connection without compression, e.g. TLS is terminated in front of the server.
+//   - The messages of a connection are handed over to its Socket in order from the goroutine reading them, so a handler that blocks holds the reads of its connection.
+//   - A SendQueueSize of 0 is served as 1, since no writer goroutine is waiting to receive the messages.
+//   - The WriterChannel and priority lanes of a Socket are relayed by a goroutine per connection.
+//     Sockets that only send through the Conn should return a nil WriterChannel, they have no relay then.
+//     The relayed messages keep their order, but may be written after the messages sent later through the Conn, use a single one of them for messages that must stay in order.
+//   - A write blocked on a client that does not read holds one of the shared writer goroutines, therefore the Config.WriteTimeout is required.
+//     A Config.Reload without one is not picked up by the connections of a Netpoll.
+//   - A Config.Reload is picked up by a connection the next time its writer runs.
+type Netpoll struct {
+	epfd int
+	// wakeR and wakeW are the ends of a pipe that interrupts the event loop once the Netpoll is closed.
+	wakeR, wakeW int
+	conns        map[int]*pollConn
+	closed       bool
+	mu           sync.Mutex
+	done         chan struct{}
+}
+
+// NewNetpoll creates a Netpoll and starts its event loop.
+// Returns the error of the system if the event loop cannot be set up.
+func NewNetpoll() (*Netpoll, error) {
+	epfd, err := syscall.EpollCreate1(syscall.EPOLL_CLOEXEC)
+	if err != nil {
+		return nil, fmt.Errorf("epoll_create1: %w", err)
+	}
+
+	var pipe [2]int
+	if err := syscall.Pipe2(pipe[:], syscall.O_NONBLOCK|syscall.O_CLOEXEC); err != nil {
+		_ = syscall.Close(epfd)
+		return nil, fmt.Errorf("pipe2: %w", err)
+	}
+	if err := syscall.EpollCtl(epfd, syscall.EPOLL_CTL_ADD, pipe[0], &syscall.EpollEvent{Events: syscall.EPOLLIN, Fd: int32(pipe[0])}); err != nil {
+		_ = syscall.Close(epfd)
+		_ = syscall.Close(pipe[0])
+		_ = syscall.Close(pipe[1])
+		return nil, fmt.Errorf("epoll_ctl: %w", err)
+	}
+
+	p := &Netpoll{
+		epfd:  epfd,
+		wakeR: pipe[0],
+		wakeW: pipe[1],
+		conns: make(map[int]*pollConn),
+		done:  make(chan struct{}),
+	}
+	go p.loop()
+
+	return p, nil
+}
+
+// Start starts the websocket on the event loop without waiting for it to close, like the package level Start.
+// The returned Conn reports the errors described in Run once the connection is closed.
+// Returns ErrNetpollClosed if the Netpoll is closed.
+// Returns ErrNetpollUnsupported if conn is not a plain TCP connection.
+// Returns ErrConfigBadWriteTimeout if the Config.WriteTimeout is not positive.
+// Returns the configuration errors described in Run, or any error of the SocketCreator.
+// conn is closed if any error is returned.
+func (p *Netpoll) Start(conn *websocket.Conn, socketCreator SocketCreator, conf *Config) (*Conn, error) {
+	raw, err := rawConnOf(conn)
+	if err != nil {
+		_ = conn.Close()
+		return nil, err
+	}
+
+	w, err := newWorker(conn, socketCreator, conf, true)
+	if err != nil {
+		return nil, err
+	}
+
+	pc := &pollConn{w: w, raw: raw, poll: p}
+	if err := raw.Control(func(fd uintptr) { pc.fd = int(fd) }); err != nil {
+		_ = conn.Close()
+		return nil, fmt.Errorf("%w: %w", ErrNetpollUnsupported, err)
+	}
+	pc.stream, _ = socketAs[StreamHandler](w.socket)
+	pc.pooled, _ = socketAs[PooledMessageHandler](w.socket)
+
+	writer := newEventWriter(w)
+	w.release = pc.release
+	if err := w.begin(); err != nil {
+		return nil, err
+	}
+	writer.start()
+
+	if err := p.register(pc); err != nil {
+		w.Close(err, nil)
+		return nil, err
+	}
+	pc.wake() // Reads whatever arrived before the registration.
+
+	return w.handle, nil
+}
+
+// Close closes the connections running on the event loop with ErrNetpollClosed and stops it.
+// Their Sockets are disconnected before it returns.
+func (p *Netpoll) Close() error {
+	p.mu.Lock()
+	if p.closed {
+		p.mu.Unlock()
+		return nil
+	}
+	p.closed = true
+	conns := make([]*pollConn, 0, len(p.conns))
+	for _, pc := range p.conns {
+		conns = append(conns, pc)
+	}
+	p.mu.Unlock()
+
+	for _, pc := range conns {
+		pc.w.Close(ErrNetpollClosed, nil)
+	}
+
+	_, _ = syscall.Write(p.wakeW, []byte{0})
+	<-p.done
+
+	return errors.Join(syscall.Close(p.epfd), syscall.Close(p.wakeR), syscall.Close(p.wakeW))
+}
+
+func (p *Netpoll) register(pc *pollConn) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.closed {
+		return ErrNetpollClosed
+	}
+
+	event := &syscall.EpollEvent{Events: syscall.EPOLLIN | syscall.EPOLLRDHUP | epollET, Fd: int32(pc.fd)}
+	if err := syscall.EpollCtl(p.epfd, syscall.EPOLL_CTL_ADD, pc.fd, event); err != nil {
+		return fmt.Errorf("%w: epoll_ctl: %w", ErrFailedToRead, err)
+	}
+	p.conns[pc.fd] = pc
+
+	return nil
+}
+
+// unregister stops watching pc, it is called before its connection is closed so that its descriptor cannot be reused meanwhile.
+func (p *Netpoll) unregister(pc *pollConn) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.conns[pc.fd] != pc {
+		return
+	}
+
+	delete(p.conns, pc.fd)
+	_ = syscall.EpollCtl(p.epfd, syscall.EPOLL_CTL_DEL, pc.fd, nil)
+}
+
+func (p *Netpoll) loop() {
+	defer close(p.done)
+
+	events := make([]syscall.EpollEvent, netpollEventBatch)
+	for {
+		n, err := syscall.EpollWait(p.epfd, events, -1)
+		if errors.Is(err, syscall.EINTR) {
+			continue
+		}
+		if err != nil {
+			return
+		}
+
+		for _, event := range events[:n] {
+			if int(event.Fd) == p.wakeR {
+				return
+			}
+
+			p.mu.Lock()
+			pc := p.conns[int(event.Fd)]
+			p.mu.Unlock()
+			if pc != nil {
+				pc.wake()
+			}
+		}
+	}
+}
+
+// rawConnOf returns the descriptor of the TCP connection underneath conn.
+func rawConnOf(conn *websocket.Conn) (syscall.RawConn, error) {
+	sc, ok := conn.NetConn().(syscall.Conn)
+	if !ok {
+		return nil, fmt.Errorf("%w: %T", ErrNetpollUnsupported, conn.NetConn())
+	}
+
+	raw, err := sc.SyscallConn()
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrNetpollUnsupported, err)
+	}
+
+	return raw, nil
+}
+
+// pollConn reads a connection of a Netpoll whenever the event loop reports it readable.
+type pollConn struct {
+	w    *worker
+	raw  syscall.RawConn
+	fd   int
+	poll *Netpoll
+	// stream and pooled are the optional handlers of the Socket.
+	stream StreamHandler
+	pooled PooledMessageHandler
+	// pending counts the wake ups that were not handled yet, the reader runs while it is not zero.
+	pending atomic.Int32
+
+	// The fields below are only accessed by the running reader.
+	// in holds the bytes read but not parsed yet and msg the payload of the message being received, they are only borrowed while in use.
+	in      *Buffer
+	msg     *Buffer
+	msgType int
+	stopped bool
+}
+
+func (c *pollConn) wake() {
+	if c.pending.Add(1) == 1 {
+		go c.run()
+	}
+}
+
+// run reads whatever is ready until no wake up is left, a single run is active at a time.
+func (c *pollConn) run() {
+	for {
+		n := c.pending.Load()
+		if !c.stopped && !c.read() {
+			c.stopped = true
+			c.releaseBuffers()
+		}
+		if c.pending.Add(-n) == 0 {
+			return
+		}
+	}
+}
+
+// release is called when the connection is torn down.
+func (c *pollConn) release() {
+	c.poll.unregister(c)
+	c.w.wakeWriter() // Lets the writer stop.
+	c.wake()         // Lets the reader release its buffers.
+}
+
+// read reads and handles the frames available on the connection, it reports false once the connection stopped.
+func (c *pollConn) read() bool {
+	for {
+		if c.w.State() == StateClosed {
+			return false
+		}
+
+		if c.in == nil {
+			c.in = getBuffer()
+		}
+		if free := cap(c.in.data) - len(c.in.data); free < netpollReadSize {
+			c.in.data = append(c.in.data[:cap(c.in.data)], make([]byte, netpollReadSize)...)[:len(c.in.data)]
+		}
+
+		var n int
+		var readErr error
+		if err := c.raw.Read(func(fd uintptr) bool {
+			n, readErr = syscall.Read(int(fd), c.in.data[len(c.in.data):cap(c.in.data)])
+			return true
+		}); err != nil {
+			readErr = err
+		}
+
+		switch {
+		case errors.Is(readErr, syscall.EINTR):
+			continue
+		case errors.Is(readErr, syscall.EAGAIN):
+			if len(c.in.data) == 0 { // Idle connections hold no buffer.
+				c.in.Release()
+				c.in = nil
+			}
+			return true
+		case readErr != nil:
+			c.w.handleReadError(readErr)
+			return false
+		case n == 0:
+			c.w.handleReadError(&websocket.CloseError{Code: websocket.CloseAbnormalClosure, Text: "unexpected EOF"})
+			return false
+		}
+
+		c.in.data = c.in.data[:len(c.in.data)+n]
+		if !c.parse() {
+			return false
+		}
+	}
+}
+
+// parse handles the complete frames of the read buffer and keeps the remainder for the next read.
+func (c *pollConn) parse() bool {
+	data := c.in.data
+	for {
+		header, ok := parseFrameHeader(data)
+		if !ok {
+			break
+		}
+		if err := c.checkFrame(header); err != nil {
+			return c.fail(err)
+		}
+		if uint64(len(data)-header.size) < header.length {
+			break
+		}
+
+		payload := data[header.size : header.size+int(header.length)]
+		for i := range payload {
+			payload[i] ^= header.mask[i%4]
+		}
+		data = data[header.size+int(header.length):]
+
+		if !c.handleFrame(header, payload) {
+			return false
+		}
+	}
+
+	c.in.data = c.in.data[:copy(c.in.data, data)]
+	return true
+}
+
+// frameHeader is the header of a frame sent by a client.
+type frameHeader struct {
+	fin    bool
+	rsv    byte
+	opcode int
+	masked bool
+	mask   [4]byte
+	length uint64
+	// size is the length of the header itself.
+	size int
+}
+
+// parseFrameHeader parses the header at the start of b, it reports false if b does not hold all of it.
+func parseFrameHeader(b []byte) (frameHeader, bool) {
+	if len(b) < 2 {
+		return frameHeader{}, false
+	}
+
+	h := frameHeader{
+		fin:    b[0]&0x80 != 0,
+		rsv:    b[0] & 0x70,
+		opcode: int(b[0] & 0x0f),
+		masked: b[1]&0x80 != 0,
+		length: uint64(b[1] & 0x7f),
+		size:   2,
+	}
+	switch h.length {
+	case 126:
+		h.size += 2
+		if len(b) < h.size {
+			return frameHeader{}, false
+		}
+		h.length = uint64(binary.BigEndian.Uint16(b[2:]))
+	case 127:
+		h.size += 8
+		if len(b) < h.size {
+			return frameHeader{}, false
+		}
+		h.length = binary.BigEndian.Uint64(b[2:])
+	}
+	if h.masked {
+		if len(b) < h.size+4 {
+			return frameHeader{}, false
+		}
+		copy(h.mask[:], b[h.size:])
+		h.size += 4
+	}
+
+	return h, true
+}
+
+// checkFrame validates a header before its payload is buffered, like the reader of gorilla/websocket.
+func (c *pollConn) checkFrame(h frameHeader) error {
+	if h.rsv != 0 {
+		return c.protocolError("unexpected reserved bits 0x" + strconv.FormatInt(int64(h.rsv), 16))
+	}
+
+	switch h.opcode {
+	case websocket.CloseMessage, websocket.PingMessage, websocket.PongMessage:
+		if h.length > 125 {
+			return c.protocolError("control frame length > 125")
+		}
+		if !h.fin {
+			return c.protocolError("control frame not final")
+		}
+	case websocket.TextMessage, websocket.BinaryMessage:
+		if c.msg != nil {
+			return c.protocolError("data before FIN")
+		}
+	case 0: // Continuation.
+		if c.msg == nil {
+			return c.protocolError("continuation after FIN")
+		}
+	default:
+		return c.protocolError("unknown opcode " + strconv.Itoa(h.opcode))
+	}
+
+	if !h.masked {
+		return c.protocolError("incorrect mask flag")
+	}
+
+	if limit := c.w.config().ReadLimit; limit > 0 && h.opcode <= websocket.BinaryMessage {
+		var received uint64
+		if c.msg != nil {
+			received = uint64(len(c.msg.data))
+		}
+		if received+h.length > uint64(limit) {
+			_ = c.w.writeClose(websocket.CloseMessageTooBig, "")
+			return websocket.ErrReadLimit
+		}
+	}
+
+	return nil
+}
+
+func (c *pollConn) protocolError(message string) error {
+	_ = c.w.writeClose(websocket.CloseProtocolError, message)
+	return errors.New("websocket: " + message)
+}
+
+// fail stops reading because of err, it reports false so that callers can return it.
+func (c *pollConn) fail(err error) bool {
+	c.w.handleReadError(err)
+	return false
+}
+
+// handleFrame handles a complete frame, it reports false once the connection stopped.
+func (c *pollConn) handleFrame(h frameHeader, payload []byte) bool {
+	switch h.opcode {
+	case websocket.PingMessage:
+		_ = c.w.handlePing(string(payload))
+	case websocket.PongMessage:
+		_ = c.w.handlePong(string(payload))
+	case websocket.CloseMessage:
+		return c.fail(c.handleCloseFrame(payload))
+	default:
+		if h.opcode != 0 {
+			c.msg, c.msgType = getBuffer(), h.opcode
+		}
+		c.msg.data = append(c.msg.data, payload...)
+		if h.fin {
+			c.deliver()
+		}
+	}
+
+	return true
+}
+
+// handleCloseFrame handles the close frame of the client and returns the error ending the reads, like the reader of gorilla/websocket.
+func (c *pollConn) handleCloseFrame(payload []byte) error {
+	code, text := websocket.CloseNoStatusReceived, ""
+	if len(payload) >= 2 {
+		code = int(binary.BigEndian.Uint16(payload))
+		if !isValidReceivedCloseCode(code) {
+			return c.protocolError("bad close code " + strconv.Itoa(code))
+		}
+		text = string(payload[2:])
+		if !utf8.ValidString(text) {
+			return c.protocolError("invalid utf8 payload in close frame")
+		}
+	}
+
+	_ = c.w.handleClose(code, text)
+	return &websocket.CloseError{Code: code, Text: text}
+}
+
+// deliver hands the message received over to the Socket, in the goroutine of the reader so that messages keep their order.
+func (c *pollConn) deliver() {
+	buf := c.msg
+	c.msg = nil
+	if !c.w.accept(buf.data) {
+		buf.Release()
+		return
+	}
+
+	switch {
+	case c.stream != nil:
+		filterMessage(c.w.filters, buf.data, func(payload []byte) {
+			c.stream.OnStream(c.msgType, bytes.NewReader(payload))
+		})
+		buf.Release()
+	case c.pooled != nil:
+		c.w.handPooled(c.pooled, buf)
+	default:
+		payload := bytes.Clone(buf.data)
+		buf.Release()
+		c.w.socket.OnMessage(payload)
+	}
+}
+
+func (c *pollConn) releaseBuffers() {
+	if c.in != nil {
+		c.in.Release()
+		c.in = nil
+	}
+	if c.msg != nil {
+		c.msg.Release()
+		c.msg = nil
+	}
+}
+
+// isValidReceivedCloseCode reports whether a client may send code, see RFC 6455 section 7.4.
+func isValidReceivedCloseCode(code int) bool {
+	switch code {
+	case websocket.CloseNormalClosure,
+		websocket.CloseGoingAway,
+		websocket.CloseProtocolError,
+		websocket.CloseUnsupportedData,
+		websocket.CloseInvalidFramePayloadData,
+		websocket.ClosePolicyViolation,
+		websocket.CloseMessageTooBig,
+		websocket.CloseMandatoryExtension,
+		websocket.CloseInternalServerErr,
+		websocket.CloseServiceRestart,
+		websocket.CloseTryAgainLater:
+		return true
+	}
+
+	return code >= 3000 && code <= 4999
+}
@@ -0,0 +1,204 @@
+//go:build linux
+
+package websocket_manager
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"runtime"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+// laneTestSocket is a testSocket with a high and a bulk priority lane.
+type laneTestSocket struct {
+	*testSocket
+	high, bulk chan Message
+}
+
+func (s laneTestSocket) PriorityChannels() map[Priority]<-chan Message {
+	return map[Priority]<-chan Message{PriorityHigh: s.high, PriorityBulk: s.bulk}
+}
+
+// startNetpollTest is startTest with a Netpoll of its own.
+func startNetpollTest(t testing.TB, conf *Config, socket Socket) (*Conn, *websocket.Conn) {
+	t.Helper()
+
+	poll, err := NewNetpoll()
+	if err != nil {
+		t.Fatalf("NewNetpoll: %v", err)
+	}
+	t.Cleanup(func() { _ = poll.Close() })
+
+	return startTestWith(t, socket, func(conn *websocket.Conn, creator SocketCreator) (*Conn, error) {
+		return poll.Start(conn, creator, conf)
+	})
+}
+
+// The messages of the WriterChannel, of each lane and of the Conn keep their order, and closing the WriterChannel closes the connection.
+func TestNetpollWriterChannels(t *testing.T) {
+	socket := laneTestSocket{testSocket: newTestSocket(), high: make(chan Message), bulk: make(chan Message)}
+	conn, client := startNetpollTest(t, &Config{GracePeriod: time.Second, WriteTimeout: time.Second}, socket)
+
+	const count = 20
+	sources := map[string]func(Message){
+		"writer": func(msg Message) { socket.writer <- msg },
+		"high":   func(msg Message) { socket.high <- msg },
+		"bulk":   func(msg Message) { socket.bulk <- msg },
+		"conn": func(msg Message) {
+			if err := conn.Send(msg); err != nil {
+				t.Errorf("Send: %v", err)
+			}
+		},
+	}
+	var wg sync.WaitGroup
+	for name, send := range sources {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range count {
+				send(TextMessage(name + " " + strconv.Itoa(i)))
+			}
+		}()
+	}
+
+	next := make(map[string]int)
+	for range count * len(sources) {
+		_, payload, err := client.ReadMessage()
+		if err != nil {
+			t.Fatalf("read: %v", err)
+		}
+		name, i, _ := strings.Cut(string(payload), " ")
+		if want := strconv.Itoa(next[name]); i != want {
+			t.Fatalf("message %s %s read, want %s %s", name, i, name, want)
+		}
+		next[name]++
+	}
+	wg.Wait()
+
+	close(socket.writer)
+	_ = readAll(client)
+	if err := waitClosed(t, conn); !errors.Is(err, ErrWriterChannelClosed) {
+		t.Fatalf("Err() = %v, want ErrWriterChannelClosed", err)
+	}
+}
+
+// The timers of the event driven workers wake their writer up, they are driven by the Config.Clock like the ones of the other workers.
+func TestNetpollTimeouts(t *testing.T) {
+	testTimeouts(t, startNetpollTest)
+}
+
+func TestNetpollCloseHandshake(t *testing.T) {
+	testCloseHandshake(t, startNetpollTest)
+}
+
+// The writers of many connections share the goroutines of the scheduler, each connection still reads its own messages in order.
+func TestNetpollSharedWriters(t *testing.T) {
+	const conns, count = 50, 100
+
+	poll, err := NewNetpoll()
+	if err != nil {
+		t.Fatalf("NewNetpoll: %v", err)
+	}
+	t.Cleanup(func() { _ = poll.Close() })
+
+	var wg sync.WaitGroup
+	for c := range conns {
+		conn, client := startTestWith(t, newTestSocket(), func(conn *websocket.Conn, creator SocketCreator) (*Conn, error) {
+			return poll.Start(conn, creator, &Config{GracePeriod: time.Second, WriteTimeout: time.Second, SendQueueSize: count})
+		})
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range count {
+				if err := conn.Send(TextMessage(fmt.Sprintf("%d %d", c, i))); err != nil {
+					t.Errorf("Send: %v", err)
+					return
+				}
+			}
+			for i := range count {
+				_, payload, err := client.ReadMessage()
+				if err != nil {
+					t.Errorf("read: %v", err)
+					return
+				}
+				if want := fmt.Sprintf("%d %d", c, i); string(payload) != want {
+					t.Errorf("read %q, want %q", payload, want)
+					return
+				}
+			}
+		}()
+	}
+	wg.Wait()
+}
+
+// A batch waiting for its Coalescing.MaxDelay does not hold a goroutine of the scheduler, the writes of the other connections go on meanwhile.
+func TestNetpollCoalescingDelay(t *testing.T) {
+	defer runtime.GOMAXPROCS(runtime.GOMAXPROCS(1))
+
+	clock := NewFakeClock(time.Unix(1000, 0))
+	delayed, delayedClient := startNetpollTest(t, &Config{
+		Clock:           clock,
+		GracePeriod:     time.Second,
+		WriteTimeout:    time.Second,
+		WriteCoalescing: &Coalescing{MaxDelay: 2 * time.Second},
+	}, newTestSocket())
+	plain, plainClient := startNetpollTest(t, &Config{GracePeriod: time.Second, WriteTimeout: time.Second}, newTestSocket())
+
+	if err := delayed.Send(TextMessage("delayed")); err != nil {
+		t.Fatalf("Send: %v", err)
+	}
+	clock.BlockUntil(1) // The batch waits for the MaxDelay.
+	if err := plain.Send(TextMessage("plain")); err != nil {
+		t.Fatalf("Send: %v", err)
+	}
+
+	_ = plainClient.SetReadDeadline(time.Now().Add(time.Second))
+	if _, payload, err := plainClient.ReadMessage(); err != nil || string(payload) != "plain" {
+		t.Fatalf("read %q, %v, want plain before the batch of the other connection is written", payload, err)
+	}
+
+	clock.Advance(2 * time.Second)
+	_ = delayedClient.SetReadDeadline(time.Now().Add(testTimeout))
+	if _, payload, err := delayedClient.ReadMessage(); err != nil || string(payload) != "delayed" {
+		t.Fatalf("read %q, %v, want delayed", payload, err)
+	}
+}
+
+// Netpoll.Start rejects a Config without a WriteTimeout, since a blocked write would hold a goroutine shared by every connection.
+func TestNetpollRequiresWriteTimeout(t *testing.T) {
+	poll, err := NewNetpoll()
+	if err != nil {
+		t.Fatalf("NewNetpoll: %v", err)
+	}
+	t.Cleanup(func() { _ = poll.Close() })
+
+	failed := make(chan error, 1)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		conn, err := (&websocket.Upgrader{}).Upgrade(w, r, nil)
+		if err != nil {
+			failed <- err
+			return
+		}
+		_, err = poll.Start(conn, SocketCreatorFunc(func() (Socket, error) { return newTestSocket(), nil }), &Config{GracePeriod: time.Second})
+		failed <- err
+	}))
+	t.Cleanup(srv.Close)
+
+	client, _, err := websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(srv.URL, "http"), nil)
+	if err != nil {
+		t.Fatalf("dial: %v", err)
+	}
+	t.Cleanup(func() { _ = client.Close() })
+
+	if err := receive(t, failed); !errors.Is(err, ErrConfigBadWriteTimeout) {
+		t.Fatalf("Start() = %v, want ErrConfigBadWriteTimeout", err)
+	}
+}
@@ -0,0 +1,25 @@
+//go:build !linux
+
+package websocket_manager
+
+import "github.com/gorilla/websocket"
+
+// Netpoll runs connections on a single epoll event loop instead of a reader and a writer goroutine each.
+// It is only available on Linux, NewNetpoll returns ErrNetpollUnsupported elsewhere.
+type Netpoll struct{}
+
+// NewNetpoll returns ErrNetpollUnsupported, since epoll is only available on Linux.
+func NewNetpoll() (*Netpoll, error) {
+	return nil, ErrNetpollUnsupported
+}
+
+// Start closes conn and returns ErrNetpollUnsupported.
+func (p *Netpoll) Start(conn *websocket.Conn, _ SocketCreator, _ *Config) (*Conn, error) {
+	_ = conn.Close()
+	return nil, ErrNetpollUnsupported
+}
+
+// Close does nothing.
+func (p *Netpoll) Close() error {
+	return nil
+}
@@ -0,0 +1,83 @@
+package websocket_manager
+
+import (
+	"sync/atomic"
+)
+
+// outbox holds the messages the writer took from its sources, it is only used by the writer goroutine.
+// Control messages are popped first, the other lanes are interleaved with a smooth weighted round-robin.
+type outbox struct {
+	lanes   [priorityCount][]Message
+	weights [priorityCount]int
+	credits [priorityCount]int
+	size    *atomic.Int64
+	// laneSize is how many messages a lane holds before the writer stops taking messages for it.
+	laneSize int
+}
+
+func newOutbox(weights PriorityWeights, laneSize int) *outbox {
+	o := &outbox{size: &atomic.Int64{}}
+	o.configure(weights, laneSize)
+	return o
+}
+
+// configure sets the weights and the lane size, the messages the lanes already hold are kept.
+func (o *outbox) configure(weights PriorityWeights, laneSize int) {
+	o.laneSize = laneSize
+	o.weights[PriorityHigh] = weights.High
+	o.weights[PriorityNormal] = weights.Normal
+	o.weights[PriorityBulk] = weights.Bulk
+}
+
+func (o *outbox) push(msg Message, priority Priority) {
+	o.lanes[priority] = append(o.lanes[priority], msg)
+	o.size.Add(1)
+}
+
+// full reports whether the lane of priority holds laneSize messages or more.
+func (o *outbox) full(priority Priority) bool {
+	return len(o.lanes[priority]) >= o.laneSize
+}
+
+func (o *outbox) len() int {
+	return int(o.size.Load())
+}
+
+// pop returns the next message to write, or nil if the outbox is empty.
+func (o *outbox) pop() Message {
+	if len(o.lanes[PriorityControl]) > 0 {
+		return o.popLane(PriorityControl)
+	}
+
+	total, next := 0, Priority(-1)
+	for p := PriorityHigh; p <= PriorityBulk; p++ {
+		if len(o.lanes[p]) == 0 {
+			o.credits[p] = 0 // An empty lane does not save up for later.
+			continue
+		}
+		o.credits[p] += o.weights[p]
+		total += o.weights[p]
+		if next < 0 || o.credits[p] > o.credits[next] {
+			next = p
+		}
+	}
+	if next < 0 {
+		return nil
+	}
+
+	o.credits[next] -= total
+	return o.popLane(next)
+}
+
+func (o *outbox) popLane(priority Priority) Message {
+	lane := o.lanes[priority]
+	msg := lane[0]
+	lane[0] = nil
+	if len(lane) == 1 {
+		o.lanes[priority] = lane[:0]
+	} else {
+		o.lanes[priority] = lane[1:]
+	}
+	o.size.Add(-1)
+	return msg
+}
@@ -0,0 +1,29 @@
+package websocket_manager
+
+import (
+	"fmt"
+)
+
+// ConfigOverrider can optionally be implemented by a Socket to run its connection with a Config of its own, e.g. for a class of clients.
+type ConfigOverrider interface {
+	// OverrideConfig receives a clone of the Config the connection is started with, it sets the fields to override on it.
+	// It is called again with a clone of the new Config on every Config.Reload, from the writer goroutine.
+	OverrideConfig(conf *Config)
+}
+
+// effectiveConfig returns the Config socket runs with, base itself unless socket implements ConfigOverrider.
+// Returns the configuration errors described in Run if the overridden Config is not valid.
+func effectiveConfig(socket Socket, base *Config) (*Config, error) {
+	overrider, ok := socketAs[ConfigOverrider](socket)
+	if !ok {
+		return base, nil
+	}
+
+	conf := base.Clone()
+	overrider.OverrideConfig(conf)
+	if err := conf.validate(); err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrConfigOverride, err)
+	}
+
+	return conf, nil
+}
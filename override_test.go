@@ -0,0 +1,126 @@
+package websocket_manager
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+// overrideTestSocket overrides the Config of its connection with override, and reports every Config it overrides.
+type overrideTestSocket struct {
+	reloadTestSocket
+	override   func(conf *Config)
+	overridden chan *Config
+}
+
+func (s overrideTestSocket) OverrideConfig(conf *Config) {
+	s.override(conf)
+	s.overridden <- conf
+}
+
+func newOverrideTestSocket(override func(conf *Config)) overrideTestSocket {
+	return overrideTestSocket{
+		reloadTestSocket: reloadTestSocket{testSocket: newTestSocket(), reloaded: make(chan *Config, 1)},
+		override:         override,
+		overridden:       make(chan *Config, 1),
+	}
+}
+
+// The overrides apply to a clone of the Config, the fields they leave alone keep the value of the Config.
+func TestConfigOverrider(t *testing.T) {
+	base := &Config{GracePeriod: time.Second, ReadLimit: 1000}
+	socket := newOverrideTestSocket(func(conf *Config) { conf.ReadLimit = 10 })
+	conn, client := startTest(t, base, socket)
+
+	if got := receive(t, socket.overridden); got == base {
+		t.Fatal("OverrideConfig received the Config itself instead of a clone")
+	}
+	if conf := conn.Config(); conf.ReadLimit != 10 || conf.GracePeriod != time.Second {
+		t.Fatalf("ReadLimit %d and GracePeriod %v, want the overridden 10 and 1s", conf.ReadLimit, conf.GracePeriod)
+	}
+	if base.ReadLimit != 1000 {
+		t.Fatalf("the override changed the ReadLimit of the Config to %d", base.ReadLimit)
+	}
+
+	if err := client.WriteMessage(websocket.TextMessage, []byte(strings.Repeat("x", 100))); err != nil {
+		t.Fatalf("write: %v", err)
+	}
+	_ = receive(t, readAll(client))
+	if err := waitClosed(t, conn); !errors.Is(err, websocket.ErrReadLimit) {
+		t.Fatalf("Err() = %v, want websocket.ErrReadLimit", err)
+	}
+}
+
+// Every reload goes through the override again, a reload the override turns invalid is rejected and the connection keeps its Config.
+func TestConfigOverriderReload(t *testing.T) {
+	const rejected = 99
+	base := &Config{GracePeriod: time.Second, ReadLimit: 1000}
+	socket := newOverrideTestSocket(func(conf *Config) {
+		if conf.SendQueueSize == rejected {
+			conf.IdleTimeout = -1
+		}
+		conf.ReadLimit = 10
+	})
+	conn, _ := startTest(t, base, socket)
+	_ = receive(t, socket.overridden)
+
+	if err := base.Reload(&Config{GracePeriod: time.Minute, ReadLimit: 2000}); err != nil {
+		t.Fatalf("Reload: %v", err)
+	}
+	_ = receive(t, socket.overridden)
+	if got := receive(t, socket.reloaded); got.ReadLimit != 10 || got.GracePeriod != time.Minute {
+		t.Fatalf("reloaded ReadLimit %d and GracePeriod %v, want the overridden 10 and the reloaded 1m", got.ReadLimit, got.GracePeriod)
+	}
+	applied := conn.Config()
+
+	if err := base.Reload(&Config{GracePeriod: time.Hour, SendQueueSize: rejected}); err != nil {
+		t.Fatalf("Reload: %v", err)
+	}
+	_ = receive(t, socket.overridden)
+	select {
+	case conf := <-socket.reloaded:
+		t.Fatalf("the rejected reload was applied: %+v", conf)
+	case <-time.After(20 * time.Millisecond):
+	}
+	if conn.Config() != applied {
+		t.Fatal("the rejected reload replaced the Config of the connection")
+	}
+	if conn.State() != StateOpen {
+		t.Fatalf("State() = %s, want open: %v", conn.State(), conn.Err())
+	}
+}
+
+// Start refuses a Config the override turns invalid.
+func TestConfigOverriderRejected(t *testing.T) {
+	socket := newOverrideTestSocket(func(conf *Config) { conf.ReadLimit = -1 })
+	failed := make(chan error, 1)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		conn, err := (&websocket.Upgrader{}).Upgrade(w, r, nil)
+		if err != nil {
+			failed <- err
+			return
+		}
+		_, err = Start(conn, SocketCreatorFunc(func() (Socket, error) { return socket, nil }), &Config{GracePeriod: time.Second})
+		failed <- err
+	}))
+	t.Cleanup(srv.Close)
+
+	client, _, err := websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(srv.URL, "http"), nil)
+	if err != nil {
+		t.Fatalf("dial: %v", err)
+	}
+	t.Cleanup(func() { _ = client.Close() })
+
+	err = receive(t, failed)
+	if !errors.Is(err, ErrConfigOverride) || !errors.Is(err, ErrConfigBadReadLimit) {
+		t.Fatalf("Start() = %v, want ErrConfigOverride and ErrConfigBadReadLimit", err)
+	}
+	if _, _, err := client.ReadMessage(); err == nil {
+		t.Fatal("the connection stayed open")
+	}
+}
@@ -0,0 +1,171 @@
+package websocket_manager
+
+import (
+	"errors"
+	"io"
+	"sync"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+const (
+	// minPooledBufferSize is the capacity of the buffers created by the pools.
+	minPooledBufferSize = 512
+	// maxPooledBufferSize is the capacity above which buffers are not returned to their pool, so that a few large messages do not pin memory.
+	maxPooledBufferSize = 256 * 1024
+)
+
+// PooledMessageHandler can optionally be implemented by a Socket to receive messages in pooled buffers instead of through OnMessage.
+// It saves the allocation of a payload per message. It is not used if the Socket implements StreamHandler.
+// The messages go through the wrappers of the Socket, e.g. Session.Socket, like with OnMessage. The payloads unwrapped by Reliable.Socket are copied to a Buffer of their own.
+type PooledMessageHandler interface {
+	// OnPooledMessage will be called in a separate goroutine, like OnMessage, with the payload of the message in a Buffer borrowed from a pool.
+	// The handler owns buf until it calls buf.Release, after which neither buf nor the slices returned by buf.Bytes may be used, e.g. copy what outlives it.
+	// Release must be called at most once, a Buffer that is never released is left to the garbage collector.
+	OnPooledMessage(buf *Buffer)
+}
+
+// Buffer holds the payload of a message received by a PooledMessageHandler.
+type Buffer struct {
+	data []byte
+}
+
+var bufferPool = sync.Pool{
+	New: func() any {
+		return &Buffer{data: make([]byte, 0, minPooledBufferSize)}
+	},
+}
+
+func getBuffer() *Buffer {
+	return bufferPool.Get().(*Buffer)
+}
+
+// Bytes returns the payload, it is only valid until Release is called.
+func (b *Buffer) Bytes() []byte {
+	return b.data
+}
+
+// Release returns the Buffer to its pool.
+func (b *Buffer) Release() {
+	if cap(b.data) > maxPooledBufferSize {
+		return
+	}
+
+	b.data = b.data[:0]
+	bufferPool.Put(b)
+}
+
+// readFrom replaces the content of the Buffer with everything read from r, growing it as needed.
+func (b *Buffer) readFrom(r io.Reader) error {
+	b.data = b.data[:0]
+	for {
+		if len(b.data) == cap(b.data) {
+			b.data = append(b.data, 0)[:len(b.data)]
+		}
+
+		n, err := r.Read(b.data[len(b.data):cap(b.data)])
+		b.data = b.data[:len(b.data)+n]
+		if errors.Is(err, io.EOF) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+	}
+}
+
+// readPooled reads the messages into pooled buffers and hands them over to handler.
+func (w *worker) readPooled(handler PooledMessageHandler) {
+	for {
+		w.applyReadLimit()
+		_, r, err := w.conn.NextReader()
+		if err != nil {
+			w.handleReadError(err)
+			return
+		}
+
+		buf := getBuffer()
+		if err := buf.readFrom(r); err != nil { // The next read reports the error.
+			buf.Release()
+			continue
+		}
+		if !w.accept(buf.data) {
+			buf.Release()
+			continue
+		}
+
+		go w.handPooled(handler, buf)
+	}
+}
+
+// handPooled hands buf over to handler once it went through the messageFilters of the Socket.
+// The payloads the filters unwrap from the messages they handle are copied to Buffers of their own.
+func (w *worker) handPooled(handler PooledMessageHandler, buf *Buffer) {
+	if len(w.filters) == 0 {
+		handler.OnPooledMessage(buf)
+		return
+	}
+
+	handed := false
+	filterMessage(w.filters, buf.data, func(payload []byte) {
+		if !handed && len(payload) == len(buf.data) && (len(payload) == 0 || &payload[0] == &buf.data[0]) {
+			handed = true
+			handler.OnPooledMessage(buf)
+			return
+		}
+
+		unwrapped := getBuffer()
+		unwrapped.data = append(unwrapped.data, payload...)
+		handler.OnPooledMessage(unwrapped)
+	})
+	if !handed {
+		buf.Release()
+	}
+}
+
+// chunkPool holds the buffers of the writes that copy their payload in chunks.
+var chunkPool = sync.Pool{
+	New: func() any {
+		chunk := make([]byte, streamChunkSize)
+		return &chunk
+	},
+}
+
+// UnpreparedMessage creates a new Message of messageType that writes payload without preparing it.
+// TextMessage and BinaryMessage prepare the frame once so that it can be written to many connections, which costs allocations that are wasted on a message written to a single connection.
+// Writing payload allocates nothing more if the websocket.Upgrader of the connection has a WriteBufferPool, e.g. a &sync.Pool{}.
+// payload must not be modified until the message is written.
+func UnpreparedMessage(messageType int, payload []byte) Message {
+	return &unpreparedMessage{typ: messageType, data: payload}
+}
+
+type unpreparedMessage struct {
+	data []byte
+	typ  int
+}
+
+func (m *unpreparedMessage) Write(conn *websocket.Conn, timeout time.Duration) error {
+	if timeout > 0 {
+		_ = conn.SetWriteDeadline(time.Now().Add(timeout))
+	}
+	if err := conn.WriteMessage(m.typ, m.data); err != nil {
+		return wrapWriteError(err)
+	}
+
+	return nil
+}
+
+func (m *unpreparedMessage) Type() int {
+	return m.typ
+}
+
+// Size returns the size of the payload.
+func (m *unpreparedMessage) Size() int {
+	return len(m.data)
+}
+
+// payload returns the message type and payload, it allows the writer to encode the frame itself.
+func (m *unpreparedMessage) payload() (int, []byte) {
+	return m.typ, m.data
+}
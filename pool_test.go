@@ -0,0 +1,102 @@
+package websocket_manager
+
+import (
+	"bytes"
+	"context"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+func TestBufferReadFrom(t *testing.T) {
+	for _, size := range []int{0, 1, minPooledBufferSize, 3*minPooledBufferSize + 1, maxPooledBufferSize + 1} {
+		payload := bytes.Repeat([]byte("p"), size)
+		buf := getBuffer()
+		if err := buf.readFrom(bytes.NewReader(payload)); err != nil {
+			t.Fatalf("readFrom of %d bytes: %v", size, err)
+		}
+		if !bytes.Equal(buf.Bytes(), payload) {
+			t.Fatalf("readFrom of %d bytes read %d bytes", size, len(buf.Bytes()))
+		}
+		buf.Release()
+	}
+}
+
+// countingSocket counts the messages it receives, through OnMessage or OnPooledMessage.
+type countingSocket struct {
+	*testSocket
+	count atomic.Int64
+}
+
+func (s *countingSocket) OnMessage([]byte) {
+	s.count.Add(1)
+}
+
+type pooledCountingSocket struct {
+	*countingSocket
+}
+
+func (s pooledCountingSocket) OnPooledMessage(buf *Buffer) {
+	buf.Release()
+	s.count.Add(1)
+}
+
+// BenchmarkReadPath reads 1KiB messages, through OnMessage and OnPooledMessage.
+func BenchmarkReadPath(b *testing.B) {
+	payload := bytes.Repeat([]byte("r"), 1024)
+	for _, tc := range []struct {
+		name   string
+		socket func(*countingSocket) Socket
+	}{
+		{"OnMessage", func(s *countingSocket) Socket { return s }},
+		{"OnPooledMessage", func(s *countingSocket) Socket { return pooledCountingSocket{s} }},
+	} {
+		b.Run(tc.name, func(b *testing.B) {
+			socket := &countingSocket{testSocket: newTestSocket()}
+			_, client := startTest(b, &Config{GracePeriod: time.Second}, tc.socket(socket))
+			prepared, err := websocket.NewPreparedMessage(websocket.BinaryMessage, payload)
+			if err != nil {
+				b.Fatal(err)
+			}
+
+			b.ReportAllocs()
+			b.ResetTimer()
+			for range b.N {
+				if err := client.WritePreparedMessage(prepared); err != nil {
+					b.Fatalf("write: %v", err)
+				}
+			}
+			for socket.count.Load() < int64(b.N) {
+				time.Sleep(100 * time.Microsecond)
+			}
+		})
+	}
+}
+
+// BenchmarkWriteMessage writes 1KiB messages created per write, prepared and unprepared.
+func BenchmarkWriteMessage(b *testing.B) {
+	payload := strings.Repeat("w", 1024)
+	for _, tc := range []struct {
+		name string
+		msg  func() Message
+	}{
+		{"TextMessage", func() Message { return TextMessage(payload) }},
+		{"UnpreparedMessage", func() Message { return UnpreparedMessage(websocket.TextMessage, []byte(payload)) }},
+	} {
+		b.Run(tc.name, func(b *testing.B) {
+			conn, client := startTest(b, &Config{GracePeriod: time.Second}, newTestSocket())
+			readAll(client)
+
+			b.ReportAllocs()
+			b.ResetTimer()
+			for range b.N {
+				if err := conn.SendAndWait(context.Background(), tc.msg()); err != nil {
+					b.Fatalf("SendAndWait: %v", err)
+				}
+			}
+		})
+	}
+}
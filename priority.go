@@ -0,0 +1,81 @@
+package websocket_manager
+
+// Priority selects the lane of the writer a message goes through.
+// Control messages are always written first, the other lanes share the connection according to Config.PriorityWeights.
+type Priority int
+
+const (
+	PriorityControl Priority = iota
+	PriorityHigh
+	PriorityNormal
+	PriorityBulk
+)
+
+// priorityCount is the number of lanes of the writer.
+const priorityCount = int(PriorityBulk) + 1
+
+func (p Priority) String() string {
+	switch p {
+	case PriorityControl:
+		return "control"
+	case PriorityHigh:
+		return "high"
+	case PriorityNormal:
+		return "normal"
+	case PriorityBulk:
+		return "bulk"
+	default:
+		return "unknown"
+	}
+}
+
+func (p Priority) valid() bool {
+	return p >= PriorityControl && p <= PriorityBulk
+}
+
+// PriorityWeights sets how many messages of each lane are written per round while the lanes compete for the connection.
+// The zero value uses 8 high, 4 normal and 1 bulk message per round.
+type PriorityWeights struct {
+	High   int
+	Normal int
+	Bulk   int
+}
+
+var defaultPriorityWeights = PriorityWeights{High: 8, Normal: 4, Bulk: 1}
+
+const defaultPriorityLaneSize = 64
+
+// PriorityWriter can optionally be implemented by a Socket to write messages through the priority lanes of the worker.
+type PriorityWriter interface {
+	// PriorityChannels returns the channels the worker reads alongside the WriterChannel, messages are written with the Priority of their channel unless they carry their own.
+	// Closing one of these channels stops it from being read, it does not close the connection.
+	PriorityChannels() map[Priority]<-chan Message
+}
+
+// WithPriority wraps msg so that it is written through the lane of priority.
+// Messages without a priority are written through the PriorityNormal lane, in the order they were sent.
+func WithPriority(msg Message, priority Priority) Message {
+	return &prioritizedMessage{Message: msg, priority: priority}
+}
+
+type prioritizedMessage struct {
+	Message
+	priority Priority
+}
+
+func (m *prioritizedMessage) Unwrap() Message {
+	return m.Message
+}
+
+func (m *prioritizedMessage) Priority() Priority {
+	return m.priority
+}
+
+// messagePriority returns the Priority msg carries, or fallback if it has none.
+func messagePriority(msg Message, fallback Priority) Priority {
+	if prioritized, ok := messageAs[interface{ Priority() Priority }](msg); ok && prioritized.Priority().valid() {
+		return prioritized.Priority()
+	}
+
+	return fallback
+}
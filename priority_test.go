@@ -0,0 +1,86 @@
+package websocket_manager
+
+import (
+	"slices"
+	"testing"
+	"time"
+)
+
+// prefilledTestSocket queues its messages before the writer starts, so that the writer finds them all at once.
+type prefilledTestSocket struct {
+	*testSocket
+	lanes map[Priority]chan Message
+	fill  map[Priority][]Message
+}
+
+func (s *prefilledTestSocket) OnConnect() {
+	for priority, messages := range s.fill {
+		for _, msg := range messages {
+			if priority == PriorityNormal {
+				s.writer <- msg
+				continue
+			}
+			s.lanes[priority] <- msg
+		}
+	}
+}
+
+func (s *prefilledTestSocket) PriorityChannels() map[Priority]<-chan Message {
+	channels := make(map[Priority]<-chan Message, len(s.lanes))
+	for priority, ch := range s.lanes {
+		channels[priority] = ch
+	}
+
+	return channels
+}
+
+func TestPriorityLanes(t *testing.T) {
+	messages := func(names ...string) []Message {
+		var out []Message
+		for _, name := range names {
+			out = append(out, TextMessage(name))
+		}
+		return out
+	}
+	fill := map[Priority][]Message{
+		PriorityControl: messages("c1", "c2"),
+		PriorityHigh:    messages("h1", "h2", "h3"),
+		// The WriterChannel is read as the normal lane, a message carrying its own priority overtakes the lane it is sent through.
+		PriorityNormal: append(messages("n1", "n2", "n3"), WithPriority(TextMessage("c3"), PriorityControl)),
+		PriorityBulk:   messages("b1", "b2", "b3"),
+	}
+
+	tests := []struct {
+		name    string
+		weights PriorityWeights
+		want    []string
+	}{
+		{"default weights", PriorityWeights{}, []string{"c1", "c2", "c3", "h1", "n1", "h2", "h3", "n2", "n3", "b1", "b2", "b3"}},
+		{"custom weights", PriorityWeights{High: 2, Normal: 1, Bulk: 1}, []string{"c1", "c2", "c3", "h1", "n1", "b1", "h2", "h3", "n2", "b2", "n3", "b3"}},
+		{"equal weights", PriorityWeights{High: 1, Normal: 1, Bulk: 1}, []string{"c1", "c2", "c3", "h1", "n1", "b1", "h2", "n2", "b2", "h3", "n3", "b3"}},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			inner := newTestSocket()
+			inner.writer = make(chan Message, 8)
+			socket := &prefilledTestSocket{
+				testSocket: inner,
+				lanes:      map[Priority]chan Message{PriorityControl: make(chan Message, 8), PriorityHigh: make(chan Message, 8), PriorityBulk: make(chan Message, 8)},
+				fill:       fill,
+			}
+			_, client := startTest(t, &Config{GracePeriod: time.Second, PriorityWeights: tc.weights}, socket)
+
+			var got []string
+			for range tc.want {
+				_, payload, err := client.ReadMessage()
+				if err != nil {
+					t.Fatalf("read: %v", err)
+				}
+				got = append(got, string(payload))
+			}
+			if !slices.Equal(got, tc.want) {
+				t.Fatalf("written in order %q, want %q", got, tc.want)
+			}
+		})
+	}
+}
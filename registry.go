@@ -0,0 +1,130 @@
+package websocket_manager
+
+import (
+	"sync"
+)
+
+// Registry tracks running connections by key, e.g. the Identity.Name or the Claims.Subject of their client.
+// A key may hold several connections, they are removed once they are done.
+type Registry struct {
+	conns map[string]map[*Conn]struct{}
+	mu    sync.RWMutex
+}
+
+func NewRegistry() *Registry {
+	return &Registry{
+		conns: make(map[string]map[*Conn]struct{}),
+	}
+}
+
+// Add registers conn under key until it is done.
+func (r *Registry) Add(key string, conn *Conn) {
+	r.add(key, conn)
+
+	go func() {
+		<-conn.Done()
+		r.Remove(key, conn)
+	}()
+}
+
+// Socket wraps socket so that its connection is registered under key while it runs, without the goroutine Add needs.
+func (r *Registry) Socket(key string, socket Socket) Socket {
+	return &socketWrapper{
+		Socket: socket,
+		attach: func(conn *Conn) { r.add(key, conn) },
+		detach: func(conn *Conn) { r.Remove(key, conn) },
+	}
+}
+
+func (r *Registry) add(key string, conn *Conn) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.conns[key] == nil {
+		r.conns[key] = make(map[*Conn]struct{})
+	}
+	r.conns[key][conn] = struct{}{}
+}
+
+// Remove unregisters conn from key.
+func (r *Registry) Remove(key string, conn *Conn) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	delete(r.conns[key], conn)
+	if len(r.conns[key]) == 0 {
+		delete(r.conns, key)
+	}
+}
+
+// Get returns the connections registered under key.
+func (r *Registry) Get(key string) []*Conn {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	conns := make([]*Conn, 0, len(r.conns[key]))
+	for conn := range r.conns[key] {
+		conns = append(conns, conn)
+	}
+
+	return conns
+}
+
+// Conns returns every registered connection, e.g. to Broadcast to them.
+func (r *Registry) Conns() []*Conn {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	conns := make([]*Conn, 0, len(r.conns))
+	for _, keyConns := range r.conns {
+		for conn := range keyConns {
+			conns = append(conns, conn)
+		}
+	}
+
+	return conns
+}
+
+// Keys returns the keys that hold at least one connection.
+func (r *Registry) Keys() []string {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	keys := make([]string, 0, len(r.conns))
+	for key := range r.conns {
+		keys = append(keys, key)
+	}
+
+	return keys
+}
+
+// Len returns the count of registered connections.
+func (r *Registry) Len() int {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	count := 0
+	for _, conns := range r.conns {
+		count += len(conns)
+	}
+
+	return count
+}
+
+// Range calls fn for every registered connection until it returns false.
+// fn is called on a snapshot, therefore it may use the Registry.
+func (r *Registry) Range(fn func(key string, conn *Conn) bool) {
+	type entry struct {
+		conn *Conn
+		key  string
+	}
+
+	r.mu.RLock()
+	entries := make([]entry, 0, len(r.conns))
+	for key, conns := range r.conns {
+		for conn := range conns {
+			entries = append(entries, entry{key: key, conn: conn})
+		}
+	}
+	r.mu.RUnlock()
+
+	for _, e := range entries {
+		if !fn(e.key, e.conn) {
+			return
+		}
+	}
+}
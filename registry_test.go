@@ -0,0 +1,32 @@
+package websocket_manager
+
+import (
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+func TestRegistryConnIdentity(t *testing.T) {
+	registry := NewRegistry()
+	conn, client := startTest(t, &Config{GracePeriod: time.Second}, registry.Socket("alice", newTestSocket()))
+	registry.Add("alice", conn) // Registering the handle returned by Start again must not duplicate it.
+
+	if got := registry.Get("alice"); len(got) != 1 || got[0] != conn {
+		t.Fatalf("Get(alice) = %v, want only the Conn returned by Start %p", got, conn)
+	}
+	if got := registry.Conns(); len(got) != 1 || got[0] != conn {
+		t.Fatalf("Conns() = %v, want only the Conn returned by Start %p", got, conn)
+	}
+
+	_ = conn.Close(websocket.CloseNormalClosure, "")
+	_ = receive(t, readAll(client))
+	_ = waitClosed(t, conn)
+	deadline := time.Now().Add(testTimeout)
+	for registry.Len() != 0 && time.Now().Before(deadline) {
+		time.Sleep(time.Millisecond) // Add unregisters from its own goroutine.
+	}
+	if n := registry.Len(); n != 0 {
+		t.Fatalf("Len() = %d after the connection closed, want 0", n)
+	}
+}
@@ -0,0 +1,289 @@
+package websocket_manager
+
+import (
+	"bytes"
+	"encoding/binary"
+	"log/slog"
+	"sync"
+	"time"
+)
+
+const defaultReliableRetransmitTimeout = 5 * time.Second
+
+// reliableReceiveWindow is how far ahead of the last delivered message inbound messages are buffered, the ones further ahead are dropped.
+const reliableReceiveWindow = 1024
+
+// reliableFrameMagic prefixes every binary message of the reliable delivery protocol, so that they can be told apart from the messages of the Socket.
+var reliableFrameMagic = []byte("WMRL")
+
+// Kinds of reliable delivery frames, both carry a sequence number (8 bytes big endian), the data frame carries the payload after it.
+const (
+	reliableFrameData byte = iota + 1
+	reliableFrameAck
+)
+
+// ReliableMessage is an outbound message waiting for its acknowledgement.
+type ReliableMessage struct {
+	Payload []byte
+	// Seq identifies the message within its stream, sequence numbers start at 1 and increase by 1.
+	Seq uint64
+}
+
+// ReliableStore persists the state of reliable streams so that it survives the connection that uses it, see NewMemoryReliableStore.
+type ReliableStore interface {
+	// Append persists an outbound message of stream and returns its sequence number.
+	Append(stream string, payload []byte) (uint64, error)
+	// Pending returns the outbound messages of stream that are not acknowledged yet, in order.
+	Pending(stream string) ([]ReliableMessage, error)
+	// Ack drops the outbound messages of stream up to seq, included.
+	Ack(stream string, seq uint64) error
+	// Received returns the sequence number of the last inbound message of stream that was delivered, or 0.
+	Received(stream string) (uint64, error)
+	// SetReceived records that the inbound messages of stream up to seq were delivered.
+	SetReceived(stream string, seq uint64) error
+}
+
+// Reliable implements at-least-once delivery over binary messages in both directions.
+// Every message carries a sequence number, starting at 1 and increasing by 1, and is acknowledged by the receiver; unacknowledged messages are retransmitted after RetransmitTimeout and when a connection is attached.
+// Acknowledgements are cumulative, acknowledging a sequence number acknowledges every message up to it.
+// Inbound messages are delivered in sequence order, the ones whose sequence number was already delivered are acknowledged again and dropped.
+// A frame consists of "WMRL", its kind (1 for data, 2 for ack), the sequence number (8 bytes big endian) and, for data frames, the payload.
+// A Reliable is plugged into a connection by wrapping its Socket with Reliable.Socket; it can be kept across reconnects, or created again with the same Store and Stream.
+type Reliable struct {
+	// Store persists the unacknowledged and delivered messages. It must not be nil.
+	Store ReliableStore
+	// Stream identifies the conversation in the Store across reconnects, e.g. the user ID.
+	Stream string
+	// RetransmitTimeout How long to wait for an acknowledgement before retransmitting a message. If 0, 5 seconds is used.
+	RetransmitTimeout time.Duration
+
+	conn *Conn
+	// sent holds when the unacknowledged messages were last sent on conn.
+	sent map[uint64]time.Time
+	// notify wakes up the goroutine sending through conn, stop ends it.
+	notify chan struct{}
+	stop   chan struct{}
+	mu     sync.Mutex
+	// early holds the inbound messages received ahead of the next one to deliver, recvMu serializes the inbound messages.
+	early  map[uint64][]byte
+	recvMu sync.Mutex
+}
+
+// Socket wraps socket so that the messages of the reliable delivery protocol are handled before reaching it.
+// The payloads of inbound data frames reach socket through OnMessage, at least once.
+func (r *Reliable) Socket(socket Socket) Socket {
+	return &socketWrapper{
+		Socket: socket,
+		attach: r.attach,
+		filter: r.handleFrame,
+		claims: func(head []byte) bool { return bytes.HasPrefix(head, reliableFrameMagic) },
+		detach: r.detach,
+	}
+}
+
+// Send persists payload in the Store and returns its sequence number, the message is sent once a connection is attached.
+// It does not wait for the acknowledgement, the message is retransmitted until it is acknowledged, including on later connections.
+// Returns the error of the Store if it fails to persist the message.
+func (r *Reliable) Send(payload []byte) (uint64, error) {
+	seq, err := r.Store.Append(r.Stream, payload)
+	if err != nil {
+		return 0, err
+	}
+
+	r.mu.Lock()
+	if r.notify != nil {
+		select {
+		case r.notify <- struct{}{}:
+		default: // A notification is already pending.
+		}
+	}
+	r.mu.Unlock()
+
+	return seq, nil
+}
+
+func (r *Reliable) retransmitTimeout() time.Duration {
+	if r.RetransmitTimeout <= 0 {
+		return defaultReliableRetransmitTimeout
+	}
+
+	return r.RetransmitTimeout
+}
+
+// attach makes r send through conn, the pending messages are sent right away and retransmitted until they are acknowledged.
+func (r *Reliable) attach(conn *Conn) {
+	notify, stop := make(chan struct{}, 1), make(chan struct{})
+	r.mu.Lock()
+	if r.stop != nil {
+		close(r.stop)
+	}
+	r.conn, r.sent, r.notify, r.stop = conn, make(map[uint64]time.Time), notify, stop
+	r.mu.Unlock()
+
+	go r.sendLoop(conn, notify, stop)
+}
+
+// detach stops sending through conn, unless another connection was attached since.
+func (r *Reliable) detach(conn *Conn) {
+	r.mu.Lock()
+	if r.conn != conn {
+		r.mu.Unlock()
+		return
+	}
+	close(r.stop)
+	r.conn, r.sent, r.notify, r.stop = nil, nil, nil, nil
+	r.mu.Unlock()
+
+	r.recvMu.Lock()
+	r.early = nil // The sender retransmits them.
+	r.recvMu.Unlock()
+}
+
+// sendLoop sends the pending messages through conn whenever notified, and retransmits the unacknowledged ones, until stop is closed.
+// Sending from a single goroutine keeps the messages in order, and does not block the callers since conn.Send waits for the writer.
+func (r *Reliable) sendLoop(conn *Conn, notify, stop <-chan struct{}) {
+	ticker := conn.Config().clock().NewTicker(r.retransmitTimeout() / 2)
+	defer ticker.Stop()
+
+	for {
+		r.sendPending(conn)
+		select {
+		case <-notify:
+		case <-ticker.C():
+		case <-stop:
+			return
+		}
+	}
+}
+
+// sendPending sends the pending messages that were not sent on conn within the RetransmitTimeout.
+func (r *Reliable) sendPending(conn *Conn) {
+	pending, err := r.Store.Pending(r.Stream)
+	if err != nil {
+		conn.Logger().Warn("failed to load pending reliable messages", slog.Any("error", err))
+		return
+	}
+
+	now := conn.Config().clock().Now()
+	for _, msg := range pending {
+		r.mu.Lock()
+		if r.conn != conn {
+			r.mu.Unlock()
+			return
+		}
+		if sentAt, sent := r.sent[msg.Seq]; sent && now.Sub(sentAt) < r.retransmitTimeout() {
+			r.mu.Unlock()
+			continue
+		}
+		r.sent[msg.Seq] = now
+		r.mu.Unlock()
+
+		if err := conn.Send(BinaryMessage(reliableFrame(reliableFrameData, msg.Seq, msg.Payload))); err != nil {
+			return
+		}
+	}
+}
+
+// handleFrame handles a message of the reliable delivery protocol, it reports false if payload is not one.
+func (r *Reliable) handleFrame(payload []byte, deliver func([]byte)) bool {
+	if len(payload) < len(reliableFrameMagic)+1+8 || !bytes.HasPrefix(payload, reliableFrameMagic) {
+		return false
+	}
+
+	kind := payload[len(reliableFrameMagic)]
+	seq := binary.BigEndian.Uint64(payload[len(reliableFrameMagic)+1:])
+	switch kind {
+	case reliableFrameData:
+		r.handleData(seq, payload[len(reliableFrameMagic)+1+8:], deliver)
+	case reliableFrameAck:
+		r.handleAck(seq)
+	}
+
+	return true
+}
+
+// handleData delivers the inbound messages that are next in sequence and acknowledges the last one delivered.
+// Inbound messages are handled concurrently, the ones received ahead of their turn wait in early.
+func (r *Reliable) handleData(seq uint64, data []byte, deliver func([]byte)) {
+	r.recvMu.Lock()
+	defer r.recvMu.Unlock()
+
+	received, err := r.Store.Received(r.Stream)
+	if err != nil {
+		r.logWarn("failed to load the received reliable sequence", err)
+		return // Not acknowledging makes the sender retransmit.
+	}
+
+	delivered := received
+	switch {
+	case seq == received+1:
+		deliver(data)
+		delivered++
+	case seq > received && seq-received <= reliableReceiveWindow:
+		if r.early == nil {
+			r.early = make(map[uint64][]byte)
+		}
+		r.early[seq] = bytes.Clone(data) // data is only valid during the call, see messageFilter.
+	}
+	for next, ok := r.early[delivered+1]; ok; next, ok = r.early[delivered+1] {
+		delete(r.early, delivered+1)
+		deliver(next)
+		delivered++
+	}
+	if delivered > received {
+		if err := r.Store.SetReceived(r.Stream, delivered); err != nil {
+			r.logWarn("failed to store the received reliable sequence", err)
+			return
+		}
+	}
+
+	if delivered > 0 {
+		r.send(reliableFrame(reliableFrameAck, delivered, nil))
+	}
+}
+
+func (r *Reliable) handleAck(seq uint64) {
+	if err := r.Store.Ack(r.Stream, seq); err != nil {
+		r.logWarn("failed to acknowledge reliable messages", err)
+		return
+	}
+
+	r.mu.Lock()
+	for sent := range r.sent {
+		if sent <= seq {
+			delete(r.sent, sent)
+		}
+	}
+	r.mu.Unlock()
+}
+
+// send sends a frame on the attached connection, if any.
+func (r *Reliable) send(frame []byte) {
+	r.mu.Lock()
+	conn := r.conn
+	r.mu.Unlock()
+	if conn == nil {
+		return
+	}
+
+	_ = conn.Send(WithPriority(BinaryMessage(frame), PriorityHigh))
+}
+
+func (r *Reliable) logWarn(msg string, err error) {
+	r.mu.Lock()
+	conn := r.conn
+	r.mu.Unlock()
+	if conn == nil {
+		return
+	}
+
+	conn.Logger().Warn(msg, slog.Any("error", err))
+}
+
+func reliableFrame(kind byte, seq uint64, payload []byte) []byte {
+	frame := make([]byte, 0, len(reliableFrameMagic)+1+8+len(payload))
+	frame = append(frame, reliableFrameMagic...)
+	frame = append(frame, kind)
+	frame = binary.BigEndian.AppendUint64(frame, seq)
+	return append(frame, payload...)
+}
@@ -0,0 +1,74 @@
+package websocket_manager
+
+import (
+	"sync"
+)
+
+// NewMemoryReliableStore creates a ReliableStore that keeps the streams in memory.
+// It survives reconnects and worker restarts but not the process, implement ReliableStore on top of a database otherwise.
+func NewMemoryReliableStore() ReliableStore {
+	return &memoryReliableStore{streams: make(map[string]*memoryReliableStream)}
+}
+
+type memoryReliableStore struct {
+	streams map[string]*memoryReliableStream
+	mu      sync.Mutex
+}
+
+type memoryReliableStream struct {
+	pending  []ReliableMessage
+	lastSeq  uint64
+	received uint64
+}
+
+// stream returns the state of name, it must be called with the lock held.
+func (s *memoryReliableStore) stream(name string) *memoryReliableStream {
+	stream, ok := s.streams[name]
+	if !ok {
+		stream = &memoryReliableStream{}
+		s.streams[name] = stream
+	}
+
+	return stream
+}
+
+func (s *memoryReliableStore) Append(name string, payload []byte) (uint64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	stream := s.stream(name)
+	stream.lastSeq++
+	stream.pending = append(stream.pending, ReliableMessage{Seq: stream.lastSeq, Payload: payload})
+	return stream.lastSeq, nil
+}
+
+func (s *memoryReliableStore) Pending(name string) ([]ReliableMessage, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]ReliableMessage(nil), s.stream(name).pending...), nil
+}
+
+func (s *memoryReliableStore) Ack(name string, seq uint64) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	stream := s.stream(name)
+	acked := 0
+	for acked < len(stream.pending) && stream.pending[acked].Seq <= seq {
+		acked++
+	}
+	stream.pending = append(stream.pending[:0], stream.pending[acked:]...)
+	return nil
+}
+
+func (s *memoryReliableStore) Received(name string) (uint64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.stream(name).received, nil
+}
+
+func (s *memoryReliableStore) SetReceived(name string, seq uint64) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	stream := s.stream(name)
+	stream.received = max(stream.received, seq)
+	return nil
+}
@@ -0,0 +1,154 @@
+package websocket_manager
+
+import (
+	"encoding/binary"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+// readReliableFrame reads a frame of the reliable delivery protocol on the client side.
+func readReliableFrame(t *testing.T, client *websocket.Conn) (byte, uint64, string) {
+	t.Helper()
+
+	_, frame, err := client.ReadMessage()
+	if err != nil {
+		t.Fatalf("read: %v", err)
+	}
+	header := len(reliableFrameMagic) + 1 + 8
+	if len(frame) < header || string(frame[:len(reliableFrameMagic)]) != string(reliableFrameMagic) {
+		t.Fatalf("read %q, want a reliable frame", frame)
+	}
+
+	return frame[len(reliableFrameMagic)], binary.BigEndian.Uint64(frame[len(reliableFrameMagic)+1:]), string(frame[header:])
+}
+
+func writeReliableFrame(t *testing.T, client *websocket.Conn, kind byte, seq uint64, payload string) {
+	t.Helper()
+
+	if err := client.WriteMessage(websocket.BinaryMessage, reliableFrame(kind, seq, []byte(payload))); err != nil {
+		t.Fatalf("write: %v", err)
+	}
+}
+
+// Unacknowledged messages are retransmitted once the RetransmitTimeout elapses, according to the Config.Clock.
+func TestReliableRetransmit(t *testing.T) {
+	clock := NewFakeClock(time.Unix(1000, 0))
+	reliable := &Reliable{Store: NewMemoryReliableStore(), Stream: "user", RetransmitTimeout: time.Minute}
+	_, client := startTest(t, &Config{Clock: clock, GracePeriod: time.Second}, reliable.Socket(newTestSocket()))
+
+	if _, err := reliable.Send([]byte("order")); err != nil {
+		t.Fatalf("Send: %v", err)
+	}
+	if kind, seq, payload := readReliableFrame(t, client); kind != reliableFrameData || seq != 1 || payload != "order" {
+		t.Fatalf("read frame %d %d %q, want data 1 order", kind, seq, payload)
+	}
+
+	// The retransmission ticker ticks every half RetransmitTimeout.
+	clock.BlockUntil(1)
+	clock.Advance(30 * time.Second)
+	clock.Advance(30 * time.Second)
+	if kind, seq, payload := readReliableFrame(t, client); kind != reliableFrameData || seq != 1 || payload != "order" {
+		t.Fatalf("read frame %d %d %q, want the retransmission of data 1 order", kind, seq, payload)
+	}
+
+	writeReliableFrame(t, client, reliableFrameAck, 1, "")
+	for deadline := time.Now().Add(testTimeout); ; time.Sleep(time.Millisecond) {
+		if pending, _ := reliable.Store.Pending("user"); len(pending) == 0 {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("the acknowledgement was not stored")
+		}
+	}
+	clock.Advance(2 * time.Minute)
+	if _, err := reliable.Send([]byte("next")); err != nil {
+		t.Fatalf("Send: %v", err)
+	}
+	// The acknowledged message is not retransmitted, the next frame is the next message.
+	if kind, seq, payload := readReliableFrame(t, client); kind != reliableFrameData || seq != 2 || payload != "next" {
+		t.Fatalf("read frame %d %d %q, want data 2 next", kind, seq, payload)
+	}
+}
+
+// Inbound messages are delivered once and in sequence order, and acknowledged cumulatively.
+func TestReliableInbound(t *testing.T) {
+	tests := []struct {
+		name string
+		seqs []uint64
+		want []string
+	}{
+		{"in order", []uint64{1, 2, 3}, []string{"1", "2", "3"}},
+		{"duplicates", []uint64{1, 1, 2, 1, 3, 3}, []string{"1", "2", "3"}},
+		{"out of order", []uint64{3, 2, 1}, []string{"1", "2", "3"}},
+		{"gap filled later", []uint64{1, 3, 4, 2}, []string{"1", "2", "3", "4"}},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			reliable := &Reliable{Store: NewMemoryReliableStore(), Stream: "user"}
+			inner := newTestSocket()
+			_, client := startTest(t, &Config{GracePeriod: time.Second}, reliable.Socket(inner))
+
+			for _, seq := range tc.seqs {
+				writeReliableFrame(t, client, reliableFrameData, seq, string(rune('0'+seq)))
+			}
+			var got []string
+			for range tc.want {
+				got = append(got, string(receive(t, inner.messages)))
+			}
+			if !slices.Equal(got, tc.want) {
+				t.Fatalf("delivered %q, want %q", got, tc.want)
+			}
+
+			// The acknowledgements never go backward and end with the last message delivered.
+			last := uint64(len(tc.want))
+			for acked := uint64(0); acked != last; {
+				kind, seq, _ := readReliableFrame(t, client)
+				if kind != reliableFrameAck || seq < acked {
+					t.Fatalf("read frame %d %d after ack %d, want a later ack", kind, seq, acked)
+				}
+				acked = seq
+			}
+			if received, _ := reliable.Store.Received("user"); received != last {
+				t.Fatalf("Received = %d, want %d", received, last)
+			}
+		})
+	}
+}
+
+// A Reliable kept across reconnects retransmits the unacknowledged messages on the next connection, and drops the inbound duplicates.
+func TestReliableReconnect(t *testing.T) {
+	reliable := &Reliable{Store: NewMemoryReliableStore(), Stream: "user"}
+	first := newTestSocket()
+	conn, client := startTest(t, &Config{GracePeriod: time.Second}, reliable.Socket(first))
+
+	if _, err := reliable.Send([]byte("order")); err != nil {
+		t.Fatalf("Send: %v", err)
+	}
+	_, _, _ = readReliableFrame(t, client)
+	writeReliableFrame(t, client, reliableFrameData, 1, "hello")
+	if got := receive(t, first.messages); string(got) != "hello" {
+		t.Fatalf("OnMessage(%q), want hello", got)
+	}
+	_ = client.NetConn().Close() // Drops the connection before acknowledging.
+	_ = waitClosed(t, conn)
+
+	second := newTestSocket()
+	_, client = startTest(t, &Config{GracePeriod: time.Second}, reliable.Socket(second))
+	if kind, seq, payload := readReliableFrame(t, client); kind != reliableFrameData || seq != 1 || payload != "order" {
+		t.Fatalf("read frame %d %d %q, want the retransmission of data 1 order", kind, seq, payload)
+	}
+
+	// The client did not see the acknowledgement of its message and sends it again.
+	writeReliableFrame(t, client, reliableFrameData, 1, "hello")
+	if kind, seq, _ := readReliableFrame(t, client); kind != reliableFrameAck || seq != 1 {
+		t.Fatalf("read frame %d %d, want ack 1", kind, seq)
+	}
+	select {
+	case payload := <-second.messages:
+		t.Fatalf("the duplicate %q was delivered", payload)
+	case <-time.After(20 * time.Millisecond):
+	}
+}
@@ -0,0 +1,131 @@
+package websocket_manager
+
+import (
+	"log/slog"
+)
+
+// ConfigReloadHandler can optionally be implemented by a Socket to observe the Config reloads its connection picks up.
+type ConfigReloadHandler interface {
+	// OnConfigReload will be called with the Config in effect before and after the reload.
+	// It should finish quickly since it is called from the writer goroutine.
+	OnConfigReload(old, new *Config)
+}
+
+// configState is the Config in effect for the connections started with a Config, changed is closed once it gets replaced.
+type configState struct {
+	conf    *Config
+	changed chan struct{}
+}
+
+func (c *Config) state() *configState {
+	if s := c.live.Load(); s != nil {
+		return s
+	}
+
+	c.live.CompareAndSwap(nil, &configState{conf: c, changed: make(chan struct{})})
+	return c.live.Load()
+}
+
+// Current returns the Config in effect for the connections started with c, which is c itself until Reload is called.
+func (c *Config) Current() *Config {
+	return c.state().conf
+}
+
+// Reload validates next and puts it in effect for the connections started with c, including the running ones.
+// Running connections pick up the ping, pong, heartbeat, write and close timeouts, idle timeouts, priority lanes, write coalescing and close frames at their next writer iteration.
+// Their reader applies the Config.ReadLimit picked up by the writer before reading each message, the message it already waits for keeps the previous limit.
+// The ping ticker is restarted when the Config.PingFrequency changes, a changed Config.PongTimeout counts from the last pong.
+// Config.SendQueueSize, Config.MaxLifetime and Config.Clock only apply to the connections started after the reload.
+// next must not be modified nor reloaded itself afterward, use Reload on c again instead.
+// Returns the configuration errors described in Run if next is not valid, in which case the Config in effect is kept.
+func (c *Config) Reload(next *Config) error {
+	if err := next.validate(); err != nil {
+		return err
+	}
+
+	c.reloadMu.Lock()
+	defer c.reloadMu.Unlock()
+	prev := c.state()
+	c.live.Store(&configState{conf: next, changed: make(chan struct{})})
+	close(prev.changed)
+
+	return nil
+}
+
+// config returns the Config currently in effect for the connection.
+func (w *worker) config() *Config {
+	return w.effective.Load()
+}
+
+// applyConfig makes the writer use the Config in effect, restarting the timers whose settings changed.
+// If the Config overridden by a ConfigOverrider is not valid, the connection keeps its Config.
+func (w *worker) applyConfig(s *writerState) {
+	state := w.conf.state()
+	s.reloadCh = state.changed
+	conf, err := effectiveConfig(w.socket, state.conf)
+	if err != nil {
+		w.logger.Warn("config reload rejected by the override", slog.Any("error", err))
+		return
+	}
+	if conf == s.conf {
+		return
+	}
+	if w.wake != nil && conf.WriteTimeout <= 0 {
+		w.logger.Warn("config reload rejected, event driven connections need a write timeout")
+		return
+	}
+	old := s.conf
+	s.conf = conf
+	w.effective.Store(conf)
+
+	switch {
+	case conf.isPingPongConfigured() && s.pingTicker == nil:
+		w.startPingPong(s)
+	case conf.isPingPongConfigured():
+		if conf.PingFrequency != old.PingFrequency {
+			s.pingTicker.Reset(conf.PingFrequency)
+			s.pingJittered = false
+		}
+		if conf.PongTimeout != old.PongTimeout {
+			s.pongTimer.Reset(max(w.pongRemaining(conf), 0))
+		}
+	case s.pingTicker != nil:
+		w.stopPingPong(s)
+	}
+
+	switch {
+	case conf.Heartbeat != nil && s.heartbeatTicker == nil:
+		w.startHeartbeat(s)
+	case conf.Heartbeat != nil:
+		if conf.Heartbeat.Frequency != old.Heartbeat.Frequency {
+			s.heartbeatTicker.Reset(conf.Heartbeat.Frequency)
+		}
+		if conf.Heartbeat.Timeout != old.Heartbeat.Timeout {
+			s.heartbeatTimer.Reset(max(w.heartbeatRemaining(conf), 0))
+		}
+	case s.heartbeatTicker != nil:
+		w.stopHeartbeat(s)
+	}
+
+	switch {
+	case conf.isIdleTimeoutConfigured() && s.idle == nil:
+		w.startIdleTracking(s, conf)
+	case conf.isIdleTimeoutConfigured():
+		s.idle.conf = conf
+		wait, _, _ := s.idle.next(w.clock.Now())
+		s.idleTimer.Reset(wait)
+	case s.idle != nil:
+		s.idleTimer.Stop()
+		s.idle, s.idleTimer, s.idleCh = nil, nil, nil
+	}
+
+	s.out.configure(conf.priorityWeights(), conf.priorityLaneSize())
+	if conf.WriteCoalescing != nil {
+		w.batch.conf = conf.WriteCoalescing
+	}
+
+	w.logger.Info("config reloaded")
+	if handler, ok := socketAs[ConfigReloadHandler](w.socket); ok {
+		handler.OnConfigReload(old, conf)
+	}
+}
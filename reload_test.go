@@ -0,0 +1,142 @@
+package websocket_manager
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+// The reader applies a reloaded ReadLimit before reading each message, the message it already waits for keeps the previous limit.
+func TestReloadReadLimit(t *testing.T) {
+	tests := []struct {
+		name          string
+		before, after int64
+		wantTooBig    bool
+	}{
+		{"lowered", 0, 10, true},
+		{"lifted", 10, 0, false},
+		{"raised", 10, 1000, false},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			conf := &Config{GracePeriod: time.Second, ReadLimit: tc.before}
+			socket := newTestSocket()
+			conn, client := startTest(t, conf, socket)
+
+			if err := conf.Reload(&Config{GracePeriod: time.Second, ReadLimit: tc.after}); err != nil {
+				t.Fatalf("Reload: %v", err)
+			}
+			for deadline := time.Now().Add(testTimeout); conn.Config().ReadLimit != tc.after; time.Sleep(time.Millisecond) {
+				if time.Now().After(deadline) {
+					t.Fatal("the reload was not picked up")
+				}
+			}
+
+			// Read under the limit in effect when the reader started waiting, the reader applies the reloaded one afterward.
+			if err := client.WriteMessage(websocket.TextMessage, []byte("small")); err != nil {
+				t.Fatalf("write: %v", err)
+			}
+			if got := receive(t, socket.messages); string(got) != "small" {
+				t.Fatalf("OnMessage(%q), want small", got)
+			}
+
+			if err := client.WriteMessage(websocket.TextMessage, []byte(strings.Repeat("x", 100))); err != nil {
+				t.Fatalf("write: %v", err)
+			}
+			if !tc.wantTooBig {
+				if got := receive(t, socket.messages); len(got) != 100 {
+					t.Fatalf("OnMessage of %d bytes, want 100", len(got))
+				}
+				return
+			}
+
+			_ = receive(t, readAll(client))
+			if err := waitClosed(t, conn); !errors.Is(err, websocket.ErrReadLimit) {
+				t.Fatalf("Err() = %v, want websocket.ErrReadLimit", err)
+			}
+		})
+	}
+}
+
+// reloadTestSocket reports the Config reloads its connection picks up.
+type reloadTestSocket struct {
+	*testSocket
+	reloaded chan *Config
+}
+
+func (s reloadTestSocket) OnConfigReload(_, conf *Config) {
+	s.reloaded <- conf
+}
+
+// The running connections restart the timers whose settings a reload changed.
+func TestReloadRestartsTimers(t *testing.T) {
+	ping := func(frequency, timeout time.Duration) *Config {
+		return &Config{PingMessage: PingMessage(nil), PingFrequency: frequency, PongTimeout: timeout}
+	}
+
+	tests := []struct {
+		name          string
+		before, after *Config
+		advance       time.Duration
+		wantPing      bool
+		// wantErr is the error the connection is closed with once advanced, or nil if it stays open.
+		wantErr error
+	}{
+		{"ping frequency lowered", ping(time.Hour, 2*time.Hour), ping(time.Minute, 2*time.Hour), time.Minute, true, nil},
+		{"ping frequency raised", ping(time.Minute, 2*time.Hour), ping(time.Hour, 2*time.Hour), 59 * time.Minute, false, nil},
+		{"pong timeout lowered", ping(time.Hour, 2*time.Hour), ping(time.Hour, 90*time.Minute), 90 * time.Minute, true, ErrPongTimeoutExceeded},
+		{"pings enabled", &Config{}, ping(time.Minute, 2*time.Minute), time.Minute, true, nil},
+		{"pings disabled", ping(time.Minute, 2*time.Minute), &Config{}, time.Hour, false, nil},
+		{"idle timeout enabled", &Config{}, &Config{IdleTimeout: time.Minute}, time.Minute, false, ErrIdleTimeoutExceeded},
+		{"idle timeout raised", &Config{IdleTimeout: time.Minute}, &Config{IdleTimeout: time.Hour}, 59 * time.Minute, false, nil},
+		{"idle timeout disabled", &Config{IdleTimeout: time.Minute}, &Config{}, time.Hour, false, nil},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			clock := NewFakeClock(time.Unix(1000, 0))
+			before, after := tc.before, tc.after
+			before.Clock, before.GracePeriod = clock, time.Minute
+			after.Clock, after.GracePeriod = clock, time.Minute
+			socket := reloadTestSocket{testSocket: newTestSocket(), reloaded: make(chan *Config, 1)}
+			conn, client := startTest(t, before, socket)
+
+			// The client records the pings without answering them, the pong timeout counts from the start.
+			pings := make(chan string, 8)
+			client.SetPingHandler(func(payload string) error {
+				pings <- payload
+				return nil
+			})
+			_ = readAll(client)
+
+			if err := before.Reload(after); err != nil {
+				t.Fatalf("Reload: %v", err)
+			}
+			if got := receive(t, socket.reloaded); got != after {
+				t.Fatal("the reloaded Config was not picked up")
+			}
+			clock.Advance(tc.advance)
+
+			if tc.wantPing {
+				_ = receive(t, pings)
+			} else {
+				select {
+				case <-pings:
+					t.Fatal("unexpected ping")
+				case <-time.After(20 * time.Millisecond):
+				}
+			}
+			if tc.wantErr == nil {
+				if conn.State() != StateOpen {
+					t.Fatalf("State() = %s, want open: %v", conn.State(), conn.Err())
+				}
+				return
+			}
+			if err := waitClosed(t, conn); !errors.Is(err, tc.wantErr) {
+				t.Fatalf("Err() = %v, want %v", err, tc.wantErr)
+			}
+		})
+	}
+}
@@ -19,10 +19,141 @@ type Socket interface {
 	// The message will be nil if the connection was not upon a client request.
 	OnDisconnect(msg *ClientCloseMessage)
 	// OnMessage will be called in a separate goroutine, it is used to handle messages coming from the connection.
+	// It is not called if the Socket implements StreamHandler or PooledMessageHandler.
 	OnMessage(payload []byte)
 	// WriterChannel should return a channel that will be used to send messages to the connection.
+	// It may return nil if the Socket only sends through the Conn, see ConnAware.
 	// If the channel is closed, the connection will be closed.
 	// If an error occurs, the connection will be closed.
 	// If the channel returns a Message with type gorilla/websocket.CloseMessage, the connection will be closed after writing the message.
 	WriterChannel() <-chan Message
 }
+
+// ConnAware can optionally be implemented by a Socket to receive the Conn handle of its connection.
+// SetConn will be called before OnConnect, with the same Conn that Start returns.
+type ConnAware interface {
+	SetConn(conn *Conn)
+}
+
+// socketAs finds the first Socket in the chain of socket that implements T.
+// The chain consists of socket, followed by the Sockets returned by repeatedly calling its Unwrap() Socket method, if any.
+// It allows wrappers to forward the optional interfaces of the Socket they wrap.
+func socketAs[T any](socket Socket) (T, bool) {
+	for socket != nil {
+		if target, ok := socket.(T); ok {
+			return target, true
+		}
+
+		wrapper, ok := socket.(interface{ Unwrap() Socket })
+		if !ok {
+			break
+		}
+		socket = wrapper.Unwrap()
+	}
+
+	var zero T
+	return zero, false
+}
+
+// messageFilter handles the messages of a feature of a socketWrapper, it reports whether it handled payload.
+// The payloads it unwraps from the messages it handles are passed to deliver, toward the wrapped Socket.
+// payload may be a pooled buffer that is only valid during the call, filters copy what they keep.
+type messageFilter func(payload []byte, deliver func([]byte)) bool
+
+// messageFilters returns the filters of the socketWrappers in the chain of socket, outermost first.
+// The messages read for a StreamHandler or a PooledMessageHandler go through them, since they do not reach socket through OnMessage.
+func messageFilters(socket Socket) []messageFilter {
+	var filters []messageFilter
+	for _, wrapper := range socketWrappers(socket) {
+		if wrapper.filter != nil {
+			filters = append(filters, wrapper.filter)
+		}
+	}
+
+	return filters
+}
+
+// messageClaims returns the claims of the socketWrappers in the chain of socket.
+// A streamed message too large to be buffered up front only goes through the messageFilters if one of them reports true for its start.
+func messageClaims(socket Socket) []func(head []byte) bool {
+	var claims []func(head []byte) bool
+	for _, wrapper := range socketWrappers(socket) {
+		if wrapper.claims != nil {
+			claims = append(claims, wrapper.claims)
+		}
+	}
+
+	return claims
+}
+
+// socketWrappers returns the socketWrappers in the chain of socket, outermost first.
+func socketWrappers(socket Socket) []*socketWrapper {
+	var wrappers []*socketWrapper
+	for socket != nil {
+		if wrapper, ok := socket.(*socketWrapper); ok {
+			wrappers = append(wrappers, wrapper)
+		}
+
+		wrapper, ok := socket.(interface{ Unwrap() Socket })
+		if !ok {
+			break
+		}
+		socket = wrapper.Unwrap()
+	}
+
+	return wrappers
+}
+
+// filterMessage passes payload through filters like the OnMessage of their socketWrappers, deliver receives what reaches the innermost one.
+func filterMessage(filters []messageFilter, payload []byte, deliver func([]byte)) {
+	if len(filters) == 0 {
+		deliver(payload)
+		return
+	}
+
+	next := func(payload []byte) { filterMessage(filters[1:], payload, deliver) }
+	if !filters[0](payload, next) {
+		next(payload)
+	}
+}
+
+// socketWrapper wraps a Socket for a feature that follows the lifecycle of the connection, and may handle some of its messages itself.
+// The optional interfaces of the wrapped Socket keep working, see socketAs.
+type socketWrapper struct {
+	Socket
+	// attach is called with the Conn of the connection before the wrapped Socket receives it.
+	attach func(conn *Conn)
+	// filter handles the messages of the feature before they reach the wrapped Socket, it is nil if the feature handles none.
+	filter messageFilter
+	// claims reports from the start of a streamed message too large to be buffered up front whether filter handles it, the whole message is then buffered for filter.
+	// If nil, filter only sees the streamed messages that fit in their start, see StreamHandler.
+	claims func(head []byte) bool
+	// detach is called with the Conn once the connection is closed, before the wrapped Socket is told.
+	detach func(conn *Conn)
+	conn   *Conn
+}
+
+func (s *socketWrapper) Unwrap() Socket {
+	return s.Socket
+}
+
+func (s *socketWrapper) SetConn(conn *Conn) {
+	s.conn = conn
+	s.attach(conn)
+	if aware, ok := socketAs[ConnAware](s.Socket); ok {
+		aware.SetConn(conn)
+	}
+}
+
+func (s *socketWrapper) OnMessage(payload []byte) {
+	if s.filter != nil && s.filter(payload, s.Socket.OnMessage) {
+		return
+	}
+
+	s.Socket.OnMessage(payload)
+}
+
+func (s *socketWrapper) OnDisconnect(msg *ClientCloseMessage) {
+	s.detach(s.conn)
+	s.Socket.OnDisconnect(msg)
+}
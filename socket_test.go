@@ -0,0 +1,190 @@
+package websocket_manager
+
+import (
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+// recordingSocket records the calls it receives through the wrappers around it.
+type recordingSocket struct {
+	testSocket
+	calls *[]string
+}
+
+func (s *recordingSocket) SetConn(*Conn) {
+	*s.calls = append(*s.calls, "inner SetConn")
+}
+
+func (s *recordingSocket) OnMessage(payload []byte) {
+	*s.calls = append(*s.calls, "inner OnMessage "+string(payload))
+}
+
+func (s *recordingSocket) OnDisconnect(*ClientCloseMessage) {
+	*s.calls = append(*s.calls, "inner OnDisconnect")
+}
+
+func TestSocketWrapper(t *testing.T) {
+	var calls []string
+	wrap := func(name string, socket Socket) Socket {
+		return &socketWrapper{
+			Socket: socket,
+			attach: func(*Conn) { calls = append(calls, name+" attach") },
+			filter: func(payload []byte, deliver func([]byte)) bool {
+				unwrapped, ok := strings.CutPrefix(string(payload), name+":")
+				if ok {
+					deliver([]byte(unwrapped))
+				}
+				return ok || string(payload) == name
+			},
+			detach: func(*Conn) { calls = append(calls, name+" detach") },
+		}
+	}
+	socket := wrap("outer", wrap("inner", &recordingSocket{calls: &calls}))
+
+	tests := []struct {
+		name string
+		call func()
+		want []string
+	}{
+		{"SetConn", func() { socket.(ConnAware).SetConn(nil) }, []string{"outer attach", "inner attach", "inner SetConn"}},
+		{"passed on", func() { socket.OnMessage([]byte("hello")) }, []string{"inner OnMessage hello"}},
+		{"handled by the outer filter", func() { socket.OnMessage([]byte("outer")) }, nil},
+		{"handled by the inner filter", func() { socket.OnMessage([]byte("inner")) }, nil},
+		{"unwrapped by both filters", func() { socket.OnMessage([]byte("outer:inner:hello")) }, []string{"inner OnMessage hello"}},
+		{"OnDisconnect", func() { socket.OnDisconnect(nil) }, []string{"outer detach", "inner detach", "inner OnDisconnect"}},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			calls = nil
+			tc.call()
+			if !slices.Equal(calls, tc.want) {
+				t.Fatalf("calls = %q, want %q", calls, tc.want)
+			}
+		})
+	}
+
+	if _, ok := socketAs[*recordingSocket](socket); !ok {
+		t.Fatal("socketAs does not find the wrapped Socket")
+	}
+}
+
+func TestSocketWrapperConnection(t *testing.T) {
+	attached, detached := make(chan *Conn, 1), make(chan *Conn, 1)
+	inner := newTestSocket()
+	conn, client := startTest(t, &Config{GracePeriod: time.Second}, &socketWrapper{
+		Socket: inner,
+		attach: func(conn *Conn) { attached <- conn },
+		filter: func(payload []byte, _ func([]byte)) bool { return string(payload) == "handled" },
+		detach: func(conn *Conn) { detached <- conn },
+	})
+
+	if got := receive(t, attached); got != conn {
+		t.Fatal("attach did not receive the Conn returned by Start")
+	}
+	for _, payload := range []string{"handled", "passed"} {
+		if err := client.WriteMessage(websocket.TextMessage, []byte(payload)); err != nil {
+			t.Fatalf("write: %v", err)
+		}
+	}
+	if got := receive(t, inner.messages); string(got) != "passed" {
+		t.Fatalf("OnMessage(%q), want passed", got)
+	}
+
+	_ = client.Close()
+	if got := receive(t, detached); got != conn {
+		t.Fatal("detach did not receive the Conn returned by Start")
+	}
+	_ = receive(t, inner.disconnected)
+}
+
+// The messages read for a StreamHandler or a PooledMessageHandler go through the filters of the wrappers like with OnMessage.
+func TestSocketWrapperReadPaths(t *testing.T) {
+	tests := []struct {
+		name   string
+		socket func(*testSocket) Socket
+	}{
+		{"OnMessage", func(s *testSocket) Socket { return s }},
+		{"OnPooledMessage", func(s *testSocket) Socket { return pooledTestSocket{s} }},
+		{"OnStream", func(s *testSocket) Socket { return streamTestSocket{s} }},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			inner := newTestSocket()
+			_, client := startTest(t, &Config{GracePeriod: time.Second}, &socketWrapper{
+				Socket: tc.socket(inner),
+				attach: func(*Conn) {},
+				filter: func(payload []byte, deliver func([]byte)) bool {
+					unwrapped, ok := strings.CutPrefix(string(payload), "wrapped:")
+					if ok {
+						deliver([]byte(unwrapped))
+					}
+					return ok || string(payload) == "handled"
+				},
+				detach: func(*Conn) {},
+			})
+
+			for _, payload := range []string{"handled", "wrapped:unwrapped", "plain"} {
+				if err := client.WriteMessage(websocket.TextMessage, []byte(payload)); err != nil {
+					t.Fatalf("write: %v", err)
+				}
+			}
+			got := []string{string(receive(t, inner.messages)), string(receive(t, inner.messages))}
+			slices.Sort(got)
+			if want := []string{"plain", "unwrapped"}; !slices.Equal(got, want) {
+				t.Fatalf("messages %q, want %q", got, want)
+			}
+			select {
+			case payload := <-inner.messages:
+				t.Fatalf("unexpected message %q", payload)
+			case <-time.After(20 * time.Millisecond):
+			}
+		})
+	}
+}
+
+// The streamed messages too large to be buffered up front only go through the filters if a wrapper claims them, the others are streamed as is.
+func TestSocketWrapperStreamClaims(t *testing.T) {
+	inner := newTestSocket()
+	_, client := startTest(t, &Config{GracePeriod: time.Second}, &socketWrapper{
+		Socket: streamTestSocket{inner},
+		attach: func(*Conn) {},
+		filter: func(payload []byte, deliver func([]byte)) bool {
+			for _, prefix := range []string{"wrapped:", "claimed:"} {
+				if unwrapped, ok := strings.CutPrefix(string(payload), prefix); ok {
+					deliver([]byte(unwrapped))
+					return true
+				}
+			}
+			return false
+		},
+		claims: func(head []byte) bool { return strings.HasPrefix(string(head), "claimed:") },
+		detach: func(*Conn) {},
+	})
+	large := strings.Repeat("l", 3*streamHeadSize)
+
+	tests := []struct {
+		name    string
+		payload string
+		want    string
+	}{
+		{"small", "wrapped:small", "small"},
+		{"small and claimed", "claimed:small", "small"},
+		{"large", "wrapped:" + large, "wrapped:" + large},
+		{"large and claimed", "claimed:" + large, large},
+		{"head sized", "wrapped:" + large[:streamHeadSize-len("wrapped:")], large[:streamHeadSize-len("wrapped:")]},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			if err := client.WriteMessage(websocket.TextMessage, []byte(tc.payload)); err != nil {
+				t.Fatalf("write: %v", err)
+			}
+			if got := string(receive(t, inner.messages)); got != tc.want {
+				t.Fatalf("OnStream read %d bytes starting with %.16q, want %d bytes starting with %.16q", len(got), got, len(tc.want), tc.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,37 @@
+package websocket_manager
+
+// State describes where a connection is in its lifecycle.
+type State int32
+
+const (
+	// StateOpen messages flow in both directions.
+	StateOpen State = iota
+	// StateClosingByUs a close message was sent to the client and the worker waits for it to be acknowledged within Config.GracePeriod.
+	StateClosingByUs
+	// StateClosingByPeer the client sent a close message and the worker echoes its close code before closing the connection.
+	StateClosingByPeer
+	// StateClosed the connection is closed.
+	StateClosed
+)
+
+func (s State) String() string {
+	switch s {
+	case StateOpen:
+		return "open"
+	case StateClosingByUs:
+		return "closing-by-us"
+	case StateClosingByPeer:
+		return "closing-by-peer"
+	case StateClosed:
+		return "closed"
+	default:
+		return "unknown"
+	}
+}
+
+// StateHandler can optionally be implemented by a Socket to observe the state of its connection.
+type StateHandler interface {
+	// OnStateChange will be called every time the connection moves from one State to another.
+	// It should finish quickly since it is called from the goroutine that caused the transition.
+	OnStateChange(from, to State)
+}
@@ -0,0 +1,145 @@
+package websocket_manager
+
+import (
+	"errors"
+	"slices"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+// stateTestSocket records the state transitions of its connection.
+type stateTestSocket struct {
+	*testSocket
+	transitions []State
+	mu          sync.Mutex
+}
+
+func (s *stateTestSocket) OnStateChange(from, to State) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if len(s.transitions) == 0 {
+		s.transitions = append(s.transitions, from)
+	}
+	s.transitions = append(s.transitions, to)
+}
+
+func (s *stateTestSocket) states() []State {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return slices.Clone(s.transitions)
+}
+
+func TestCloseHandshake(t *testing.T) {
+	testCloseHandshake(t, startTest)
+}
+
+// testCloseHandshake checks the close handshakes of the connections started by start, e.g. startTest.
+func testCloseHandshake(t *testing.T, start func(testing.TB, *Config, Socket) (*Conn, *websocket.Conn)) {
+	closeByUs := func(t *testing.T, conn *Conn) {
+		if err := conn.Close(4000, "bye"); err != nil {
+			t.Fatalf("Close: %v", err)
+		}
+		for conn.State() == StateOpen {
+			time.Sleep(time.Millisecond)
+		}
+	}
+	closeByPeer := func(t *testing.T, client *websocket.Conn) {
+		if err := client.WriteControl(websocket.CloseMessage, websocket.FormatCloseMessage(4001, "bye"), time.Now().Add(testTimeout)); err != nil {
+			t.Fatalf("write close: %v", err)
+		}
+	}
+
+	tests := []struct {
+		name       string
+		run        func(t *testing.T, clock *FakeClock, conn *Conn, client *websocket.Conn)
+		wantErr    error
+		wantClean  bool
+		wantStates []State
+		// wantClient is the close message handed over to Socket.OnDisconnect.
+		wantClient *ClientCloseMessage
+	}{
+		{
+			name: "by us, acknowledged",
+			run: func(t *testing.T, _ *FakeClock, conn *Conn, client *websocket.Conn) {
+				closeByUs(t, conn)
+				if err := receive(t, readAll(client)); !websocket.IsCloseError(err, 4000) {
+					t.Fatalf("the client read %v, want a close message with code 4000", err)
+				}
+			},
+			wantErr:    ErrCloseMessageSent,
+			wantClean:  true,
+			wantStates: []State{StateOpen, StateClosingByUs, StateClosed},
+			wantClient: &ClientCloseMessage{Code: 4000},
+		},
+		{
+			name: "by us, grace period exceeded",
+			run: func(t *testing.T, clock *FakeClock, conn *Conn, _ *websocket.Conn) {
+				closeByUs(t, conn)
+				clock.BlockUntil(1)
+				clock.Advance(time.Minute)
+			},
+			wantErr:    ErrCloseHandshakeTimeout,
+			wantStates: []State{StateOpen, StateClosingByUs, StateClosed},
+		},
+		{
+			name: "by us, connection dropped",
+			run: func(t *testing.T, _ *FakeClock, conn *Conn, client *websocket.Conn) {
+				closeByUs(t, conn)
+				_ = client.NetConn().Close()
+			},
+			wantErr:    ErrCloseHandshakeFailed,
+			wantStates: []State{StateOpen, StateClosingByUs, StateClosed},
+		},
+		{
+			name: "by peer, echoed",
+			run: func(t *testing.T, _ *FakeClock, _ *Conn, client *websocket.Conn) {
+				read := readAll(client)
+				closeByPeer(t, client)
+				if err := receive(t, read); !websocket.IsCloseError(err, 4001) {
+					t.Fatalf("the client read %v, want the echo of its close code 4001", err)
+				}
+			},
+			wantErr:    ErrCloseMessageReceived,
+			wantClean:  true,
+			wantStates: []State{StateOpen, StateClosingByPeer, StateClosed},
+			wantClient: &ClientCloseMessage{Code: 4001, Text: "bye"},
+		},
+		{
+			name: "by peer, connection dropped",
+			run: func(t *testing.T, _ *FakeClock, _ *Conn, client *websocket.Conn) {
+				_ = client.NetConn().Close()
+			},
+			wantErr:    ErrFailedToRead,
+			wantStates: []State{StateOpen, StateClosed},
+		},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			clock := NewFakeClock(time.Unix(1000, 0))
+			socket := &stateTestSocket{testSocket: newTestSocket()}
+			conn, client := start(t, &Config{Clock: clock, GracePeriod: time.Minute, WriteTimeout: time.Second}, socket)
+
+			tc.run(t, clock, conn, client)
+
+			err := waitClosed(t, conn)
+			if !errors.Is(err, tc.wantErr) {
+				t.Fatalf("Err() = %v, want %v", err, tc.wantErr)
+			}
+			if IsCleanClose(err) != tc.wantClean {
+				t.Fatalf("IsCleanClose(%v) = %t, want %t", err, !tc.wantClean, tc.wantClean)
+			}
+			if waiters := clock.Waiters(); waiters != 0 {
+				t.Fatalf("%d timers left running once closed", waiters)
+			}
+			if got := socket.states(); !slices.Equal(got, tc.wantStates) {
+				t.Fatalf("states %v, want %v", got, tc.wantStates)
+			}
+			if got := receive(t, socket.disconnected); (got == nil) != (tc.wantClient == nil) || got != nil && *got != *tc.wantClient {
+				t.Fatalf("OnDisconnect(%+v), want %+v", got, tc.wantClient)
+			}
+		})
+	}
+}
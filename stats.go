@@ -0,0 +1,91 @@
+package websocket_manager
+
+import (
+	"sync/atomic"
+	"time"
+)
+
+// Stats is a snapshot of the traffic of a connection.
+type Stats struct {
+	// ConnectedAt is when the worker started.
+	ConnectedAt time.Time
+	// LastActivity is when the last message, ping or pong frame was read or written.
+	LastActivity time.Time
+	// BytesRead is the sum of the payload sizes of the messages, ping and pong frames read.
+	BytesRead uint64
+	// BytesWritten is the sum of the payload sizes of the messages, ping and pong frames written.
+	BytesWritten uint64
+	// FramesRead is the count of messages, ping and pong frames read.
+	FramesRead uint64
+	// FramesWritten is the count of messages, ping and pong frames written.
+	FramesWritten uint64
+	// MessagesExpired is the count of messages dropped because they expired before they could be written, see WithExpiry.
+	MessagesExpired uint64
+	// QueueDepth is the count of messages waiting in the Conn.Send and Socket.WriterChannel buffers, and in the priority lanes of the writer.
+	QueueDepth int
+}
+
+type stats struct {
+	clock        Clock
+	connectedAt  time.Time
+	lastActivity atomic.Int64
+	// lastMessageRead and lastMessageWritten only track messages, they are used for the idle timeouts.
+	lastMessageRead    atomic.Int64
+	lastMessageWritten atomic.Int64
+	bytesRead          atomic.Uint64
+	bytesWritten       atomic.Uint64
+	framesRead         atomic.Uint64
+	framesWritten      atomic.Uint64
+	messagesExpired    atomic.Uint64
+}
+
+func newStats(clock Clock) *stats {
+	s := &stats{clock: clock, connectedAt: clock.Now()}
+	s.lastActivity.Store(s.connectedAt.UnixNano())
+	s.lastMessageRead.Store(s.connectedAt.UnixNano())
+	s.lastMessageWritten.Store(s.connectedAt.UnixNano())
+	return s
+}
+
+// read records a frame read from the connection and returns the time it was recorded at.
+func (s *stats) read(size int) int64 {
+	now := s.clock.Now().UnixNano()
+	s.framesRead.Add(1)
+	s.bytesRead.Add(uint64(size))
+	s.lastActivity.Store(now)
+	return now
+}
+
+// written records a frame written to the connection and returns the time it was recorded at.
+func (s *stats) written(size int) int64 {
+	now := s.clock.Now().UnixNano()
+	s.framesWritten.Add(1)
+	s.bytesWritten.Add(uint64(size))
+	s.lastActivity.Store(now)
+	return now
+}
+
+func (s *stats) messageRead(size int) {
+	s.lastMessageRead.Store(s.read(size))
+}
+
+func (s *stats) messageWritten(size int) {
+	s.lastMessageWritten.Store(s.written(size))
+}
+
+func (s *stats) messageExpired() {
+	s.messagesExpired.Add(1)
+}
+
+func (s *stats) snapshot(queueDepth int) Stats {
+	return Stats{
+		ConnectedAt:     s.connectedAt,
+		LastActivity:    time.Unix(0, s.lastActivity.Load()),
+		BytesRead:       s.bytesRead.Load(),
+		BytesWritten:    s.bytesWritten.Load(),
+		FramesRead:      s.framesRead.Load(),
+		FramesWritten:   s.framesWritten.Load(),
+		MessagesExpired: s.messagesExpired.Load(),
+		QueueDepth:      queueDepth,
+	}
+}
@@ -0,0 +1,113 @@
+package websocket_manager
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"sync/atomic"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+// streamChunkSize is the size of the chunks a StreamMessage reads from its reader.
+const streamChunkSize = 32 * 1024
+
+// streamHeadSize is how much of a message the reader buffers before calling OnStream.
+const streamHeadSize = maxHeartbeatReplySize
+
+// StreamHandler can optionally be implemented by a Socket to receive messages as streams instead of through OnMessage.
+type StreamHandler interface {
+	// OnStream will be called for every message with its type (gorilla/websocket.TextMessage or gorilla/websocket.BinaryMessage) and a reader of its payload.
+	// It is called from the reader goroutine and no other message is read until it returns, whatever is left unread gets discarded afterward.
+	// The reader must not be used after OnStream returns.
+	// The first 4KiB of the message are read before OnStream is called, to filter out the heartbeat replies.
+	// If the Socket is wrapped by Session.Socket, FileTransfer.Socket or Reliable.Socket, the messages that fit in those 4KiB go through the wrappers,
+	// and the reader gets the payload they unwrapped. Larger messages are only read whole beforehand if they start like a frame of FileTransfer or Reliable,
+	// the others are streamed as is: the refresh requests of a Session must fit in 4KiB.
+	OnStream(messageType int, r io.Reader)
+}
+
+// StreamMessage creates a new Message that writes everything read from r as a single message of messageType.
+// The payload is written in chunks, the write timeout applies to each of them rather than to the whole message.
+// If reading from r fails, the connection is closed since the message cannot be completed.
+// It can only be written once. Panics if messageType is not gorilla/websocket.TextMessage or gorilla/websocket.BinaryMessage.
+func StreamMessage(messageType int, r io.Reader) Message {
+	if messageType != websocket.TextMessage && messageType != websocket.BinaryMessage {
+		panic(fmt.Errorf("failed to prepare stream message: unsupported message type %d", messageType))
+	}
+
+	return &streamMessage{
+		typ:     messageType,
+		r:       r,
+		written: &atomic.Int64{},
+	}
+}
+
+type streamMessage struct {
+	r       io.Reader
+	written *atomic.Int64
+	typ     int
+}
+
+func (m *streamMessage) Write(conn *websocket.Conn, timeout time.Duration) error {
+	setDeadline := func() {
+		if timeout > 0 {
+			_ = conn.SetWriteDeadline(time.Now().Add(timeout))
+		}
+	}
+
+	setDeadline()
+	w, err := conn.NextWriter(m.typ)
+	if err != nil {
+		return wrapWriteError(err)
+	}
+
+	chunk := chunkPool.Get().(*[]byte)
+	defer chunkPool.Put(chunk)
+	buf := *chunk
+	for {
+		n, readErr := m.r.Read(buf)
+		if n > 0 {
+			setDeadline()
+			if _, err := w.Write(buf[:n]); err != nil {
+				return wrapWriteError(err)
+			}
+			m.written.Add(int64(n))
+		}
+		if errors.Is(readErr, io.EOF) {
+			break
+		}
+		if readErr != nil {
+			return fmt.Errorf("%w: %w", ErrStreamRead, readErr)
+		}
+	}
+
+	setDeadline()
+	if err := w.Close(); err != nil {
+		return wrapWriteError(err)
+	}
+
+	return nil
+}
+
+func (m *streamMessage) Type() int {
+	return m.typ
+}
+
+// Size returns how much of the payload was written so far.
+func (m *streamMessage) Size() int {
+	return int(m.written.Load())
+}
+
+// countingReader counts the bytes read through it.
+type countingReader struct {
+	r io.Reader
+	n int
+}
+
+func (c *countingReader) Read(p []byte) (int, error) {
+	n, err := c.r.Read(p)
+	c.n += n
+	return n, err
+}
@@ -0,0 +1,278 @@
+package websocket_manager
+
+import (
+	"sync"
+	"time"
+)
+
+const (
+	// wheelBits is the log2 of the slots per level of a TimingWheel.
+	wheelBits  = 6
+	wheelSlots = 1 << wheelBits
+	wheelMask  = wheelSlots - 1
+	// wheelLevels is how many levels a TimingWheel has, each one spans wheelSlots times the level below it.
+	wheelLevels = 4
+)
+
+// TimingWheel is a Clock that schedules the timers and tickers of every connection using it on a shared hierarchical timing wheel,
+// driven by a single runtime ticker instead of a runtime timer per ping ticker, pong deadline, idle timeout and grace period.
+// Share it between connections through their Config.Clock, and see Config.PingJitter to spread their pings.
+//
+// Timers fire on the first tick at or after they are due, never early, so the tick is the precision of every deadline of the connections.
+// Each of the 4 levels holds 64 slots, the top one spanning 64^4 ticks; timers due further away are rescheduled as the wheel turns.
+// Scheduling and stopping a timer takes constant time, and the functions of Clock.AfterFunc run in their own goroutine like with the real time.
+type TimingWheel struct {
+	tick  time.Duration
+	start time.Time
+	// current is the last tick processed, counted from start.
+	current uint64
+	levels  [wheelLevels][wheelSlots]wheelBucket
+	mu      sync.Mutex
+	stop    chan struct{}
+	stopped bool
+}
+
+// NewTimingWheel creates a TimingWheel advancing every tick and starts driving it.
+// A tick of 10 to 100 milliseconds suits pings and timeouts of seconds. It panics if tick is not positive.
+func NewTimingWheel(tick time.Duration) *TimingWheel {
+	if tick <= 0 {
+		panic("non-positive tick for NewTimingWheel")
+	}
+
+	tw := &TimingWheel{tick: tick, start: time.Now(), stop: make(chan struct{})}
+	go tw.run(time.NewTicker(tick))
+
+	return tw
+}
+
+// Stop stops driving the wheel, the timers and tickers scheduled on it do not fire afterward.
+// The connections using it must be closed beforehand, since their timeouts no longer fire.
+func (tw *TimingWheel) Stop() {
+	tw.mu.Lock()
+	defer tw.mu.Unlock()
+	if tw.stopped {
+		return
+	}
+
+	tw.stopped = true
+	close(tw.stop)
+}
+
+func (tw *TimingWheel) Now() time.Time {
+	return time.Now()
+}
+
+func (tw *TimingWheel) NewTimer(d time.Duration) Timer {
+	return tw.schedule(&wheelTimer{wheel: tw, ch: make(chan time.Time, 1)}, d)
+}
+
+func (tw *TimingWheel) NewTicker(d time.Duration) Ticker {
+	if d <= 0 {
+		panic("non-positive interval for TimingWheel.NewTicker")
+	}
+
+	return wheelTicker{t: tw.schedule(&wheelTimer{wheel: tw, ch: make(chan time.Time, 1), period: d}, d)}
+}
+
+func (tw *TimingWheel) AfterFunc(d time.Duration, f func()) Timer {
+	return tw.schedule(&wheelTimer{wheel: tw, fn: f}, d)
+}
+
+func (tw *TimingWheel) schedule(t *wheelTimer, d time.Duration) *wheelTimer {
+	tw.mu.Lock()
+	defer tw.mu.Unlock()
+	t.setDue(time.Since(tw.start) + max(d, 0))
+	tw.add(t)
+	return t
+}
+
+func (tw *TimingWheel) run(ticker *time.Ticker) {
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-tw.stop:
+			return
+		case now := <-ticker.C:
+			tw.advance(uint64(now.Sub(tw.start) / tw.tick))
+		}
+	}
+}
+
+// advance processes the ticks up to target, catching up on the ones missed if the driver fell behind.
+func (tw *TimingWheel) advance(target uint64) {
+	tw.mu.Lock()
+	defer tw.mu.Unlock()
+
+	for tw.current < target && !tw.stopped {
+		tw.current++
+		tw.cascade()
+
+		bucket := &tw.levels[0][tw.current&wheelMask]
+		for t := bucket.head; t != nil; t = bucket.head {
+			bucket.remove(t)
+			t.fire()
+		}
+	}
+}
+
+// cascade moves the timers of the upper level slots reached by the current tick down to the levels matching how soon they are due.
+// The upper levels go first, so that their timers can move down more than one level within the same tick.
+func (tw *TimingWheel) cascade() {
+	for level := wheelLevels - 1; level > 0; level-- {
+		shift := uint(level * wheelBits)
+		if tw.current&(1<<shift-1) != 0 {
+			continue
+		}
+
+		bucket := &tw.levels[level][(tw.current>>shift)&wheelMask]
+		timers := bucket.head
+		bucket.head = nil
+		for t := timers; t != nil; {
+			next := t.next
+			t.bucket, t.prev, t.next = nil, nil, nil
+			tw.add(t)
+			t = next
+		}
+	}
+}
+
+// add puts t in the slot of the lowest level whose span covers how soon it is due, it must be called with the lock held.
+// A timer due beyond the span of the top level is put in the top level slot of its due tick, which is reached before it is due.
+func (tw *TimingWheel) add(t *wheelTimer) {
+	delta := t.due - tw.current
+	level := 0
+	for level < wheelLevels-1 && delta >= 1<<uint((level+1)*wheelBits) {
+		level++
+	}
+
+	tw.levels[level][(t.due>>uint(level*wheelBits))&wheelMask].push(t)
+}
+
+// wheelBucket is a slot of a TimingWheel, a doubly linked list of timers.
+type wheelBucket struct {
+	head *wheelTimer
+}
+
+func (b *wheelBucket) push(t *wheelTimer) {
+	t.bucket, t.prev, t.next = b, nil, b.head
+	if b.head != nil {
+		b.head.prev = t
+	}
+	b.head = t
+}
+
+func (b *wheelBucket) remove(t *wheelTimer) {
+	if t.prev != nil {
+		t.prev.next = t.next
+	} else {
+		b.head = t.next
+	}
+	if t.next != nil {
+		t.next.prev = t.prev
+	}
+	t.bucket, t.prev, t.next = nil, nil, nil
+}
+
+// wheelTimer is a timer, a ticker if it has a period, or the timer of an AfterFunc if it has a fn.
+type wheelTimer struct {
+	wheel *TimingWheel
+	// at is when the timer is due, counted from the start of the wheel, and due the first tick at or after it.
+	at     time.Duration
+	due    uint64
+	ch     chan time.Time
+	fn     func()
+	period time.Duration
+	// bucket is the slot holding the timer while it is scheduled.
+	bucket     *wheelBucket
+	prev, next *wheelTimer
+}
+
+// setDue sets when the timer is due, it must be called with the wheel locked.
+// Timers are never due before the next tick, so the ones due by now fire on it.
+func (t *wheelTimer) setDue(at time.Duration) {
+	t.at = at
+	t.due = max(uint64((at+t.wheel.tick-1)/t.wheel.tick), t.wheel.current+1)
+}
+
+// fire is called with the wheel locked once the timer is due.
+// A ticker is due again a period after it was due, so that it does not drift when its period is not a multiple of the tick,
+// skipping the periods that already elapsed if the wheel fell behind.
+func (t *wheelTimer) fire() {
+	if t.period > 0 {
+		next := t.at + t.period
+		if now := time.Duration(t.wheel.current) * t.wheel.tick; next <= now {
+			next += (now-next)/t.period*t.period + t.period
+		}
+		t.setDue(next)
+		t.wheel.add(t)
+	}
+
+	if t.fn != nil {
+		go t.fn()
+		return
+	}
+	select {
+	case t.ch <- time.Now():
+	default: // A ticker that falls behind drops ticks, like a time.Ticker.
+	}
+}
+
+func (t *wheelTimer) C() <-chan time.Time {
+	return t.ch
+}
+
+func (t *wheelTimer) Stop() bool {
+	t.wheel.mu.Lock()
+	defer t.wheel.mu.Unlock()
+	return t.unschedule()
+}
+
+// Reset of a ticker also changes its period, like time.Ticker.Reset.
+func (t *wheelTimer) Reset(d time.Duration) bool {
+	t.wheel.mu.Lock()
+	defer t.wheel.mu.Unlock()
+	active := t.unschedule()
+	if t.period > 0 {
+		t.period = d
+	}
+	t.setDue(time.Since(t.wheel.start) + max(d, 0))
+	t.wheel.add(t)
+	return active
+}
+
+// unschedule removes the timer from its slot and drains its channel, it reports whether it was scheduled.
+// It must be called with the wheel locked, which is held while timers fire so that no stale value is received afterward.
+func (t *wheelTimer) unschedule() bool {
+	if t.ch != nil {
+		select {
+		case <-t.ch:
+		default:
+		}
+	}
+	if t.bucket == nil {
+		return false
+	}
+
+	t.bucket.remove(t)
+	return true
+}
+
+type wheelTicker struct {
+	t *wheelTimer
+}
+
+func (t wheelTicker) C() <-chan time.Time {
+	return t.t.C()
+}
+
+func (t wheelTicker) Stop() {
+	t.t.Stop()
+}
+
+func (t wheelTicker) Reset(d time.Duration) {
+	if d <= 0 {
+		panic("non-positive interval for Ticker.Reset")
+	}
+	t.t.Reset(d)
+}
@@ -0,0 +1,127 @@
+package websocket_manager
+
+import (
+	"errors"
+	"slices"
+	"testing"
+	"time"
+)
+
+// newManualWheel creates a TimingWheel that is not driven, the tests advance it with advance.
+// Its start is a minute ahead, so that the time spent by the test does not move the timers of an hour tick to the next tick.
+func newManualWheel() *TimingWheel {
+	return &TimingWheel{tick: time.Hour, start: time.Now().Add(time.Minute), stop: make(chan struct{})}
+}
+
+func TestTimingWheelTimers(t *testing.T) {
+	// The delays, in ticks, cover every level and the boundaries between them.
+	for _, ticks := range []uint64{1, 2, wheelSlots - 1, wheelSlots, wheelSlots + 1, wheelSlots * wheelSlots, wheelSlots*wheelSlots*wheelSlots + 5} {
+		tw := newManualWheel()
+		timer := tw.NewTimer(time.Duration(ticks) * time.Hour)
+
+		tw.advance(ticks - 1)
+		if fired(timer.C()) {
+			t.Fatalf("the timer of %d ticks fired early", ticks)
+		}
+		tw.advance(ticks)
+		if !fired(timer.C()) {
+			t.Fatalf("the timer of %d ticks did not fire", ticks)
+		}
+	}
+}
+
+func TestTimingWheel(t *testing.T) {
+	tests := []struct {
+		name string
+		run  func(t *testing.T, tw *TimingWheel)
+	}{
+		{"stopped timer", func(t *testing.T, tw *TimingWheel) {
+			timer := tw.NewTimer(2 * time.Hour)
+			if !timer.Stop() {
+				t.Fatal("Stop of an active timer = false")
+			}
+			tw.advance(10)
+			if fired(timer.C()) {
+				t.Fatal("the stopped timer fired")
+			}
+		}},
+		{"reset timer", func(t *testing.T, tw *TimingWheel) {
+			timer := tw.NewTimer(2 * time.Hour)
+			tw.advance(1)
+			timer.Reset(5 * time.Hour) // Due 5 ticks after the start, the reset counts from the real time.
+			tw.advance(4)
+			if fired(timer.C()) {
+				t.Fatal("the timer fired at its previous deadline")
+			}
+			tw.advance(5)
+			if !fired(timer.C()) {
+				t.Fatal("the reset timer did not fire")
+			}
+		}},
+		{"ticker without drift", func(t *testing.T, tw *TimingWheel) {
+			// A period of 1.5 ticks is due on the first tick at or after each multiple of it.
+			ticker := tw.NewTicker(90 * time.Minute)
+			defer ticker.Stop()
+			var ticks []uint64
+			for tick := uint64(1); tick <= 6; tick++ {
+				tw.advance(tick)
+				if fired(ticker.C()) {
+					ticks = append(ticks, tick)
+				}
+			}
+			if want := []uint64{2, 3, 5, 6}; !slices.Equal(ticks, want) {
+				t.Fatalf("ticked at %v, want %v", ticks, want)
+			}
+		}},
+		{"ticker behind", func(t *testing.T, tw *TimingWheel) {
+			ticker := tw.NewTicker(time.Hour)
+			defer ticker.Stop()
+			tw.advance(10)
+			if !fired(ticker.C()) || fired(ticker.C()) {
+				t.Fatal("an undrained ticker did not deliver a single tick")
+			}
+			tw.advance(11)
+			if !fired(ticker.C()) {
+				t.Fatal("the ticker did not tick after catching up")
+			}
+		}},
+		{"AfterFunc", func(t *testing.T, tw *TimingWheel) {
+			called := make(chan time.Time, 1)
+			tw.AfterFunc(3*time.Hour, func() { called <- time.Now() })
+			tw.AfterFunc(3*time.Hour, func() { t.Error("a stopped AfterFunc was called") }).Stop()
+			tw.advance(3)
+			_ = receive(t, called)
+		}},
+		{"stopped wheel", func(t *testing.T, tw *TimingWheel) {
+			timer := tw.NewTimer(time.Hour)
+			tw.Stop()
+			tw.advance(10)
+			if fired(timer.C()) {
+				t.Fatal("a timer of a stopped wheel fired")
+			}
+		}},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			tc.run(t, newManualWheel())
+		})
+	}
+}
+
+// A TimingWheel drives the timeouts of the connections sharing it.
+func TestTimingWheelTimeouts(t *testing.T) {
+	tw := NewTimingWheel(5 * time.Millisecond)
+	defer tw.Stop()
+
+	conn, _ := startTest(t, &Config{
+		Clock:         tw,
+		GracePeriod:   time.Second,
+		PingMessage:   PingMessage(nil),
+		PingFrequency: 20 * time.Millisecond,
+		PingJitter:    10 * time.Millisecond,
+		PongTimeout:   50 * time.Millisecond,
+	}, newTestSocket())
+	if err := waitClosed(t, conn); !errors.Is(err, ErrPongTimeoutExceeded) {
+		t.Fatalf("Err() = %v, want ErrPongTimeoutExceeded", err)
+	}
+}
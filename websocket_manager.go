@@ -13,44 +13,126 @@ import (
 // Returns ErrWriterChannelClosed if the WriterChannel of the Socket is closed.
 // Returns ErrFailedToWrite if it fails to write a message.
 // Returns ErrWriteTimeoutExceeded if the write timeout is exceeded.
-// Returns ErrCloseMessageSent if the Socket sends a CloseMessage through the WriterChannel.
-// Returns ErrCloseMessageReceived if the Socket receives a CloseMessage from the connection.
+// Returns ErrCloseMessageSent if the Socket sends a CloseMessage through the WriterChannel and the client acknowledges it.
+// Returns ErrCloseMessageReceived if the client sends a CloseMessage and it gets echoed back.
+// Returns ErrCloseHandshakeTimeout if the client does not acknowledge a CloseMessage within the Config.GracePeriod.
+// Returns ErrCloseHandshakeFailed if the close handshake fails for any other reason.
+// Use IsCleanClose to tell whether the close handshake was completed.
 // Returns ErrFailedToRead if it fails to read a message.
 // Returns ErrPongTimeoutExceeded if the pong timeout is exceeded.
+// Returns ErrHeartbeatTimeoutExceeded if no heartbeat reply is read within the Config.Heartbeat timeout.
+// Returns ErrIdleTimeoutExceeded alongside the outcome of the close handshake if no message was exchanged within the idle timeouts.
+// Returns ErrMaxLifetimeExceeded alongside the outcome of the close handshake if the connection was recycled after Config.MaxLifetime.
+// Returns ErrAuthTokenExpired alongside the outcome of the close handshake if the token of the Session wrapping the Socket expired.
+// Returns ErrSendQueueOverflow alongside the outcome of the close handshake if a Broadcaster with OverflowClose found the send queue full.
 // Returns ErrConnectionClosed if the connection is closed.
+// Returns ErrNetpollClosed if the Netpoll running the connection is closed.
 // Returns ErrConfigPartialPingConfiguration if the ping configuration is incomplete.
-// Returns ErrConfigBadPingFrequency if the Config.PongTimeout is less or equal to Config.PingFrequency + Config.WriteTimeout.
+// Returns ErrConfigBadPingFrequency if the Config.PongTimeout is less or equal to Config.PingFrequency + Config.WriteTimeout, or the Config.PingJitter is negative or not less than the Config.PingFrequency.
 // Returns ErrConfigBadGracePeriod if the Config.GracePeriod is less or equal to 0
+// Returns ErrConfigBadIdleTimeout if any of the Config idle timeouts is negative.
+// Returns ErrConfigBadMaxLifetime if the Config.MaxLifetime or Config.MaxLifetimeJitter is negative, or the Config.MaxLifetimeCloseMessage is not a close message.
+// Returns ErrConfigBadReadLimit if the Config.ReadLimit is negative.
+// Returns ErrConfigBadSendQueueSize if the Config.SendQueueSize is negative.
+// Returns ErrConfigBadHeartbeat if the Config.Heartbeat misses its message, reply, or frequency, or its timeout is less or equal to its frequency + Config.WriteTimeout.
+// Returns ErrConfigBadWriteCoalescing if any of the Config.WriteCoalescing limits is negative.
+// Returns ErrConfigBadPriorityLanes if the Config.PriorityLaneSize is negative, or the Config.PriorityWeights are set but not all positive.
+// Returns ErrConfigOverride alongside the configuration errors if the Config overridden by a ConfigOverrider is not valid.
+// The configuration errors are joined when several apply, see Config.Validate.
 // Returns any error that occurs during the run.
 func Run(
 	conn *websocket.Conn,
 	socketCreator SocketCreator,
 	conf *Config,
 ) error {
-	if err := conf.validate(); err != nil {
+	c, err := Start(conn, socketCreator, conf)
+	if err != nil {
+		return err
+	}
+
+	<-c.Done()
+	return c.Err()
+}
+
+// Start starts the websocket without waiting for it to close.
+// The returned Conn can be used to interact with the connection while it runs, Conn.Err reports the errors described in Run.
+// Returns the configuration errors described in Run, or any error of the SocketCreator.
+func Start(
+	conn *websocket.Conn,
+	socketCreator SocketCreator,
+	conf *Config,
+) (*Conn, error) {
+	w, err := newWorker(conn, socketCreator, conf, false)
+	if err != nil {
+		return nil, err
+	}
+	if err := w.start(); err != nil {
+		return nil, err
+	}
+
+	return w.handle, nil
+}
+
+// newWorker validates conf, creates the Socket and the worker of the connection, closing conn if any of them fails.
+// The writer of an event driven worker only runs once woken up, its send queue and close requests are buffered so that they can wait for it.
+func newWorker(conn *websocket.Conn, socketCreator SocketCreator, conf *Config, eventDriven bool) (*worker, error) {
+	base := conf.state()
+	if err := base.conf.validate(); err != nil {
 		if connCloseErr := conn.Close(); connCloseErr != nil {
-			return fmt.Errorf("%w: %w", err, connCloseErr)
+			return nil, fmt.Errorf("%w: %w", err, connCloseErr)
 		}
-		return err
+		return nil, err
 	}
 
 	socket, err := socketCreator.Create()
 	if err != nil {
 		if connCloseErr := conn.Close(); connCloseErr != nil {
-			return fmt.Errorf("%w: %w", err, connCloseErr)
+			return nil, fmt.Errorf("%w: %w", err, connCloseErr)
 		}
-		return err
+		return nil, err
 	}
 
+	current, err := effectiveConfig(socket, base.conf)
+	if err != nil {
+		if connCloseErr := conn.Close(); connCloseErr != nil {
+			return nil, fmt.Errorf("%w: %w", err, connCloseErr)
+		}
+		return nil, err
+	}
+
+	if eventDriven && current.WriteTimeout <= 0 {
+		err := &ConfigError{Field: "WriteTimeout", Err: ErrConfigBadWriteTimeout}
+		if connCloseErr := conn.Close(); connCloseErr != nil {
+			return nil, fmt.Errorf("%w: %w", err, connCloseErr)
+		}
+		return nil, err
+	}
+
+	id := newConnectionID()
 	w := &worker{
-		conn:             conn,
-		socket:           socket,
-		conf:             conf,
-		closed:           &atomic.Bool{},
-		hasRan:           &atomic.Bool{},
-		closeMessageSent: &atomic.Bool{},
-		closeCh:          make(chan error, 1),
+		id:         id,
+		logger:     connLogger(current, id, socketCreator, socket),
+		conn:       conn,
+		socket:     socket,
+		conf:       conf,
+		base:       base,
+		hasRan:     &atomic.Bool{},
+		state:      &atomic.Int32{},
+		stats:      newStats(current.clock()),
+		clock:      current.clock(),
+		outbox:     newOutbox(current.priorityWeights(), current.priorityLaneSize()),
+		sendCh:     make(chan Message, current.SendQueueSize),
+		batch:      newBatch(current.WriteCoalescing),
+		closeReqCh: make(chan closeRequest, 1),
+		done:       make(chan struct{}),
+		writerDone: make(chan struct{}),
+		writeLock:  make(chan struct{}, 1),
+	}
+	w.handle = &Conn{w: w}
+	w.effective.Store(current)
+	if eventDriven {
+		w.sendCh = make(chan Message, max(current.SendQueueSize, 1))
 	}
 
-	return w.run()
+	return w, nil
 }
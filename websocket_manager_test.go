@@ -0,0 +1,133 @@
+package websocket_manager
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+// testTimeout bounds every wait of the tests, so that a broken connection fails the test instead of hanging it.
+const testTimeout = 5 * time.Second
+
+// testSocket records what its connection hands over to it.
+type testSocket struct {
+	writer       chan Message
+	messages     chan []byte
+	disconnected chan *ClientCloseMessage
+}
+
+func newTestSocket() *testSocket {
+	return &testSocket{
+		writer:       make(chan Message),
+		messages:     make(chan []byte, 64),
+		disconnected: make(chan *ClientCloseMessage, 1),
+	}
+}
+
+func (s *testSocket) OnConnect() {}
+
+func (s *testSocket) OnDisconnect(msg *ClientCloseMessage) {
+	s.disconnected <- msg
+}
+
+func (s *testSocket) OnMessage(payload []byte) {
+	s.messages <- payload
+}
+
+func (s *testSocket) WriterChannel() <-chan Message {
+	return s.writer
+}
+
+// startTest starts a connection running socket behind a test server and returns its handle and the client side.
+func startTest(t testing.TB, conf *Config, socket Socket) (*Conn, *websocket.Conn) {
+	t.Helper()
+	return startTestWith(t, socket, func(conn *websocket.Conn, creator SocketCreator) (*Conn, error) {
+		return Start(conn, creator, conf)
+	})
+}
+
+// startTestWith is startTest with the function starting the server side, e.g. Netpoll.Start.
+func startTestWith(t testing.TB, socket Socket, start func(*websocket.Conn, SocketCreator) (*Conn, error)) (*Conn, *websocket.Conn) {
+	t.Helper()
+
+	started := make(chan *Conn, 1)
+	failed := make(chan error, 1)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		conn, err := (&websocket.Upgrader{}).Upgrade(w, r, nil)
+		if err != nil {
+			failed <- err
+			return
+		}
+		handle, err := start(conn, SocketCreatorFunc(func() (Socket, error) { return socket, nil }))
+		if err != nil {
+			failed <- err
+			return
+		}
+		started <- handle
+	}))
+	t.Cleanup(srv.Close)
+
+	client, _, err := websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(srv.URL, "http"), nil)
+	if err != nil {
+		t.Fatalf("dial: %v", err)
+	}
+	t.Cleanup(func() { _ = client.Close() })
+
+	select {
+	case handle := <-started:
+		return handle, client
+	case err := <-failed:
+		t.Fatalf("start: %v", err)
+	case <-time.After(testTimeout):
+		t.Fatal("the connection did not start")
+	}
+
+	return nil, nil
+}
+
+// waitClosed waits for the connection to close and returns its error.
+func waitClosed(t testing.TB, conn *Conn) error {
+	t.Helper()
+
+	select {
+	case <-conn.Done():
+		return conn.Err()
+	case <-time.After(testTimeout):
+		t.Fatal("the connection did not close")
+		return nil
+	}
+}
+
+// readAll reads the client side in the background until it fails, answering close messages like a well-behaved client.
+// The returned channel delivers the error that ended the reads.
+func readAll(client *websocket.Conn) <-chan error {
+	errCh := make(chan error, 1)
+	go func() {
+		for {
+			if _, _, err := client.ReadMessage(); err != nil {
+				errCh <- err
+				return
+			}
+		}
+	}()
+
+	return errCh
+}
+
+// receive waits for a value of ch.
+func receive[T any](t testing.TB, ch <-chan T) T {
+	t.Helper()
+
+	select {
+	case v := <-ch:
+		return v
+	case <-time.After(testTimeout):
+		t.Fatal("nothing received")
+		var zero T
+		return zero
+	}
+}
@@ -1,124 +1,806 @@
 package websocket_manager
 
 import (
+	"bytes"
+	"errors"
 	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"sync"
 	"sync/atomic"
 	"time"
 
 	"github.com/gorilla/websocket"
 )
 
+// closeRequest asks the writer to start the close handshake with msg, reason is reported alongside its outcome.
+type closeRequest struct {
+	msg    Message
+	reason error
+}
+
 type worker struct {
-	conn             *websocket.Conn
-	socket           Socket
-	conf             *Config
-	closed           *atomic.Bool
-	hasRan           *atomic.Bool
-	closeMessageSent *atomic.Bool
-	closeCh          chan error
+	// handle is the Conn of the connection, the same one is handed to the Socket and returned by Start.
+	handle *Conn
+	id     string
+	logger *slog.Logger
+	conn   *websocket.Conn
+	socket Socket
+	// conf is the Config the connection was started with, base its state at the time.
+	conf *Config
+	base *configState
+	// effective is the Config the connection runs with, see ConfigOverrider.
+	effective atomic.Pointer[Config]
+	clock     Clock
+	// lastPong and lastHeartbeatReply are when the last pong and heartbeat reply were read, in Unix nanoseconds of the Clock.
+	lastPong           atomic.Int64
+	lastHeartbeatReply atomic.Int64
+	hasRan             *atomic.Bool
+	state              *atomic.Int32
+	stats              *stats
+	outbox             *outbox
+	// batch is only used by the writer goroutine, when the Config enables write coalescing.
+	batch    *batch
+	writerCh <-chan Message
+	sendCh   chan Message
+	// closeReqCh holds a single close request, so that it can be queued while the writer is busy, see Conn.tryCloseWithReason.
+	closeReqCh chan closeRequest
+	// overflowClosed is set by the first Broadcaster that closes the connection with OverflowClose, so that it is closed once.
+	overflowClosed atomic.Bool
+	done           chan struct{}
+	// writeLock serializes the batches written straight to the network connection with the close frames, see writeClose.
+	// It is a channel so that a close frame gives up waiting for a stuck batch at its deadline.
+	writeLock chan struct{}
+	// closeSent is set once a close frame was written by writeClose, it is guarded by writeLock.
+	closeSent bool
+	// writerDone is closed once the writer stopped, nothing queued afterward is written.
+	writerDone chan struct{}
+	err        error
+	// filters are the messageFilters of the Socket, applied by the reader to the messages that do not go through OnMessage.
+	filters []messageFilter
+	// claims are the claims of the socketWrappers of the Socket, they pick the streamed messages buffered for the filters.
+	claims []func(head []byte) bool
+	// readLimit is the Config.ReadLimit applied to the websocket.Conn, it is only accessed by the reader goroutine.
+	readLimit int64
+	// echoErr holds the error of echoing the close message of the client, it is only accessed by the reader goroutine.
+	echoErr error
+	// closeReason holds why the server initiated the close handshake and closeCode the code it sent, they are set by the writer goroutine before leaving StateOpen.
+	closeReason error
+	closeCode   int
+	// graceTimer closes the connection once the GracePeriod of a close handshake initiated by the server is exceeded, Close stops it.
+	graceTimer Timer
+	graceMu    sync.Mutex
+	// wake schedules the writer of an event driven worker and release unregisters it from its engine, they are nil otherwise.
+	wake    func()
+	release func()
 }
 
-func (w *worker) run() error {
-	if w.hasRan.Load() {
-		return ErrWorkerAlreadyRun
+// start calls Socket.OnConnect and starts the reader and writer goroutines, it does not wait for the connection to close.
+func (w *worker) start() error {
+	if err := w.begin(); err != nil {
+		return err
 	}
-	w.hasRan.Store(true)
 
-	w.socket.OnConnect()
 	go w.readMessages()
 	go w.writeMessages()
 
-	defer close(w.closeCh)
-	return <-w.closeCh
+	return nil
+}
+
+// begin installs the handlers of the connection, hands the Conn over to the Socket and calls Socket.OnConnect.
+// The caller starts reading and writing afterward.
+func (w *worker) begin() error {
+	if !w.hasRan.CompareAndSwap(false, true) {
+		return ErrWorkerAlreadyRun
+	}
+
+	w.conn.SetCloseHandler(w.handleClose)
+	w.conn.SetPongHandler(w.handlePong)
+	w.conn.SetPingHandler(w.handlePing)
+	w.applyReadLimit()
+	w.filters = messageFilters(w.socket)
+	w.claims = messageClaims(w.socket)
+	w.writerCh = w.socket.WriterChannel()
+
+	if aware, ok := socketAs[ConnAware](w.socket); ok {
+		aware.SetConn(w.handle)
+	}
+
+	w.logger.Info("websocket connected")
+	w.socket.OnConnect()
+
+	return nil
+}
+
+// wakeWriter schedules the writer of an event driven worker once something is queued for it.
+func (w *worker) wakeWriter() {
+	if w.wake != nil {
+		w.wake()
+	}
+}
+
+func (w *worker) queueDepth() int {
+	return len(w.sendCh) + len(w.writerCh) + w.outbox.len()
+}
+
+// State returns the current State of the connection.
+func (w *worker) State() State {
+	return State(w.state.Load())
+}
+
+// transition moves the connection from one State to another, it reports whether the connection was in the from State.
+func (w *worker) transition(from, to State) bool {
+	if !w.state.CompareAndSwap(int32(from), int32(to)) {
+		return false
+	}
+
+	w.notifyStateChange(from, to)
+	return true
+}
+
+func (w *worker) notifyStateChange(from, to State) {
+	if handler, ok := socketAs[StateHandler](w.socket); ok {
+		handler.OnStateChange(from, to)
+	}
+}
+
+// writerState holds what the writer goroutine keeps between iterations.
+type writerState struct {
+	// conf is the Config the writer currently uses, reloadCh is closed once it gets replaced.
+	conf       *Config
+	reloadCh   <-chan struct{}
+	out        *outbox
+	pingTicker Ticker
+	pongTimer  Timer
+	idle       *idleTracker
+	idleTimer  Timer
+	pingCh     <-chan time.Time
+	pongCh     <-chan time.Time
+	// pingJittered is set while the first ping is due ahead of the PingFrequency, the ticker is reset to it once the first ping is written.
+	pingJittered bool
+	// heartbeatCh delivers the heartbeat ticks, heartbeatReplyCh fires when the reply timeout may be exceeded.
+	heartbeatTicker  Ticker
+	heartbeatTimer   Timer
+	heartbeatCh      <-chan time.Time
+	heartbeatReplyCh <-chan time.Time
+	lifetimeTimer    Timer
+	lifetimeCh       <-chan time.Time
+	idleCh           <-chan time.Time
+	// batchTimer fires once the pending batch waited for the Coalescing.MaxDelay, it is nil while no batch waits.
+	batchTimer Timer
+	batchCh    <-chan time.Time
+	sendCh     <-chan Message
+	writerCh   <-chan Message
+	lanes      [priorityCount]<-chan Message
+	// writerClosed is set once the WriterChannel is closed, the connection is closed after the outbox is flushed.
+	writerClosed bool
 }
 
 func (w *worker) writeMessages() {
-	var pingTickerCh <-chan time.Time
-	if w.conf.isPingPongConfigured() {
-		// Setup ping pong handlers.
-		_ = w.conn.SetReadDeadline(time.Now().Add(w.conf.PongTimeout))
-		w.conn.SetPongHandler(func(_ string) error {
-			return w.conn.SetReadDeadline(time.Now().Add(w.conf.PongTimeout))
-		})
-		pingTicker := time.NewTicker(w.conf.PingFrequency)
-		defer pingTicker.Stop()
-		pingTickerCh = pingTicker.C
-	}
-
-	// Setup message writer.
-	writerCh := w.socket.WriterChannel()
-	for {
-		select {
-		case <-pingTickerCh:
-			if err := w.conf.PingMessage.Write(w.conn, w.conf.WriteTimeout); err != nil {
-				w.Close(fmt.Errorf("%w: %w", ErrPingMessage, err), nil)
-				return
+	s := w.newWriterState()
+	defer w.stopWriter(s)
+
+	for w.pump(s) {
+		if !w.wait(s) {
+			return
+		}
+	}
+}
+
+// newWriterState starts the timers of the writer and collects the channels it reads.
+func (w *worker) newWriterState() *writerState {
+	s := &writerState{conf: w.config(), reloadCh: w.base.changed, out: w.outbox, sendCh: w.sendCh, writerCh: w.writerCh}
+	if s.conf.isPingPongConfigured() {
+		w.startPingPong(s)
+	}
+
+	if s.conf.Heartbeat != nil {
+		w.startHeartbeat(s)
+	}
+
+	if s.conf.isMaxLifetimeConfigured() {
+		s.lifetimeTimer = w.clock.NewTimer(s.conf.lifetime())
+		s.lifetimeCh = s.lifetimeTimer.C()
+	}
+
+	if s.conf.isIdleTimeoutConfigured() {
+		w.startIdleTracking(s, s.conf)
+	}
+
+	if writer, ok := socketAs[PriorityWriter](w.socket); ok {
+		for priority, ch := range writer.PriorityChannels() {
+			if priority.valid() {
+				s.lanes[priority] = ch
 			}
-		case payload, ok := <-writerCh:
-			if !ok {
-				w.Close(ErrWriterChannelClosed, nil)
-				return
+		}
+	}
+
+	return s
+}
+
+// stopWriter stops the timers of the writer and fails the delivery of the messages it did not write.
+func (w *worker) stopWriter(s *writerState) {
+	if s.pingTicker != nil {
+		s.pingTicker.Stop()
+		s.pongTimer.Stop()
+	}
+	if s.heartbeatTicker != nil {
+		w.stopHeartbeat(s)
+	}
+	if s.lifetimeTimer != nil {
+		s.lifetimeTimer.Stop()
+	}
+	if s.idleTimer != nil {
+		s.idleTimer.Stop()
+	}
+	w.stopBatchTimer(s)
+	close(w.writerDone)
+	w.abandonQueued(s)
+}
+
+// pump takes in whatever is ready, then writes the most urgent messages until there is nothing left to write.
+// It reports whether the writer should keep running, in which case it is idle until a timer fires or a message arrives.
+func (w *worker) pump(s *writerState) bool {
+	for {
+		if !w.handleTimers(s) || !w.intake(s) {
+			return false
+		}
+
+		msg := w.next(s)
+		if msg == nil {
+			if s.writerClosed {
+				if w.sendBatch(s) {
+					w.Close(ErrWriterChannelClosed, nil)
+				}
+				return false
 			}
+			return true
+		}
 
-			if err := payload.Write(w.conn, w.conf.WriteTimeout); err != nil {
-				w.Close(fmt.Errorf("%w: %w", ErrFailedToWrite, err), nil)
-				return
+		if _, _, ok := batchPayload(msg); ok && s.conf.WriteCoalescing != nil {
+			if !w.writeBatch(s, msg) {
+				return false
 			}
+			continue
+		}
+
+		if !w.sendBatch(s) || !w.write(msg) {
+			return false
+		}
+	}
+}
+
+// startPingPong starts the ping ticker and the pong timer, the Config.PongTimeout counts from now on.
+func (w *worker) startPingPong(s *writerState) {
+	w.lastPong.Store(w.clock.Now().UnixNano())
+	first := s.conf.firstPing()
+	s.pingTicker = w.clock.NewTicker(first)
+	s.pingJittered = first != s.conf.PingFrequency
+	s.pingCh = s.pingTicker.C()
+	s.pongTimer = w.clock.NewTimer(s.conf.PongTimeout)
+	s.pongCh = s.pongTimer.C()
+}
+
+// stopPingPong stops the ping ticker and the pong timer.
+func (w *worker) stopPingPong(s *writerState) {
+	s.pingTicker.Stop()
+	s.pongTimer.Stop()
+	s.pingTicker, s.pingCh, s.pongTimer, s.pongCh = nil, nil, nil, nil
+}
+
+// handlePong records when the last pong was read and calls the PongHandler if any, it is called from the reader goroutine.
+func (w *worker) handlePong(appData string) error {
+	w.lastPong.Store(w.stats.read(len(appData)))
+	if handler, ok := socketAs[PongHandler](w.socket); ok {
+		handler.OnPong([]byte(appData))
+	}
+
+	return nil
+}
+
+// pongRemaining returns how long is left before the Config.PongTimeout is exceeded.
+func (w *worker) pongRemaining(conf *Config) time.Duration {
+	return conf.PongTimeout - w.clock.Now().Sub(time.Unix(0, w.lastPong.Load()))
+}
+
+// checkPong closes the connection if no pong was read within the Config.PongTimeout, it reports whether the writer should keep running.
+func (w *worker) checkPong(s *writerState) bool {
+	if remaining := w.pongRemaining(s.conf); remaining > 0 {
+		s.pongTimer.Reset(remaining)
+		return true
+	}
+
+	w.Close(ErrPongTimeoutExceeded, nil)
+	return false
+}
 
-			if payload.Type() == websocket.CloseMessage {
-				w.closeMessageSent.Store(true)
-				_ = w.conn.SetReadDeadline(time.Now().Add(w.conf.GracePeriod))
+func (w *worker) startIdleTracking(s *writerState, conf *Config) {
+	s.idle = &idleTracker{stats: w.stats, conf: conf}
+	wait, _, _ := s.idle.next(w.clock.Now())
+	s.idleTimer = w.clock.NewTimer(wait)
+	s.idleCh = s.idleTimer.C()
+}
+
+// handleTimers handles the timers that fired without blocking, it reports whether the writer should keep running.
+func (w *worker) handleTimers(s *writerState) bool {
+	select {
+	case <-w.done:
+		return false
+	case <-s.pingCh:
+		return w.ping(s)
+	case <-s.pongCh:
+		return w.checkPong(s)
+	case <-s.heartbeatCh:
+		return w.writeHeartbeat(s.conf)
+	case <-s.heartbeatReplyCh:
+		return w.checkHeartbeat(s)
+	case <-s.lifetimeCh:
+		w.writeCloseMessage(s.conf.maxLifetimeCloseMessage(), ErrMaxLifetimeExceeded)
+		return false
+	case <-s.idleCh:
+		return w.checkIdle(s.idle, s.idleTimer)
+	case <-s.batchCh:
+		return w.sendBatch(s)
+	case <-s.reloadCh:
+		w.applyConfig(s)
+		return true
+	default:
+		return true
+	}
+}
+
+// intake moves the messages that are ready into the outbox without blocking, the most urgent sources first.
+// It reports whether the writer should keep running.
+func (w *worker) intake(s *writerState) bool {
+	select {
+	case req := <-w.closeReqCh:
+		w.writeCloseMessage(req.msg, req.reason)
+		return false
+	default:
+	}
+
+	for priority := PriorityControl; priority <= PriorityBulk; priority++ {
+		if priority == PriorityNormal {
+			w.drain(s, &s.sendCh, PriorityNormal)
+			w.drain(s, &s.writerCh, PriorityNormal)
+		}
+		w.drain(s, &s.lanes[priority], priority)
+	}
+
+	return true
+}
+
+// drain moves messages from ch into the outbox until ch has none ready or the lane of the last message is full.
+func (w *worker) drain(s *writerState, ch *<-chan Message, fallback Priority) {
+	for *ch != nil {
+		select {
+		case msg, ok := <-*ch:
+			if !w.enqueue(s, ch, msg, ok, fallback) {
 				return
 			}
+		default:
+			return
 		}
 	}
 }
 
+// enqueue puts a message received from ch into the outbox, it reports whether more messages can be taken from ch.
+func (w *worker) enqueue(s *writerState, ch *<-chan Message, msg Message, ok bool, fallback Priority) bool {
+	if !ok {
+		if ch == &s.writerCh {
+			s.writerClosed = true
+		}
+		*ch = nil
+		return false
+	}
+
+	priority := messagePriority(msg, fallback)
+	s.out.push(msg, priority)
+	return !s.out.full(priority)
+}
+
+// wait blocks until a timer fires or a message arrives, it reports whether the writer should keep running.
+func (w *worker) wait(s *writerState) bool {
+	select {
+	case <-w.done:
+		return false
+	case <-s.pingCh:
+		return w.ping(s)
+	case <-s.pongCh:
+		return w.checkPong(s)
+	case <-s.heartbeatCh:
+		return w.writeHeartbeat(s.conf)
+	case <-s.heartbeatReplyCh:
+		return w.checkHeartbeat(s)
+	case <-s.lifetimeCh:
+		w.writeCloseMessage(s.conf.maxLifetimeCloseMessage(), ErrMaxLifetimeExceeded)
+		return false
+	case <-s.idleCh:
+		return w.checkIdle(s.idle, s.idleTimer)
+	case <-s.batchCh:
+		return w.sendBatch(s)
+	case <-s.reloadCh:
+		w.applyConfig(s)
+	case req := <-w.closeReqCh:
+		w.writeCloseMessage(req.msg, req.reason)
+		return false
+	case msg, ok := <-s.sendCh:
+		w.enqueue(s, &s.sendCh, msg, ok, PriorityNormal)
+	case msg, ok := <-s.writerCh:
+		w.enqueue(s, &s.writerCh, msg, ok, PriorityNormal)
+	case msg, ok := <-s.lanes[PriorityControl]:
+		w.enqueue(s, &s.lanes[PriorityControl], msg, ok, PriorityControl)
+	case msg, ok := <-s.lanes[PriorityHigh]:
+		w.enqueue(s, &s.lanes[PriorityHigh], msg, ok, PriorityHigh)
+	case msg, ok := <-s.lanes[PriorityNormal]:
+		w.enqueue(s, &s.lanes[PriorityNormal], msg, ok, PriorityNormal)
+	case msg, ok := <-s.lanes[PriorityBulk]:
+		w.enqueue(s, &s.lanes[PriorityBulk], msg, ok, PriorityBulk)
+	}
+
+	return true
+}
+
+// ping writes the ping message on a tick of the ping ticker, it reports whether the writer should keep running.
+func (w *worker) ping(s *writerState) bool {
+	if s.pingJittered {
+		s.pingTicker.Reset(s.conf.PingFrequency)
+		s.pingJittered = false
+	}
+
+	return w.writePing(s.conf)
+}
+
+// writePing writes the ping message, it reports whether the writer should keep running.
+func (w *worker) writePing(conf *Config) bool {
+	if w.State() != StateOpen {
+		return false
+	}
+	if err := conf.PingMessage.Write(w.conn, conf.WriteTimeout); err != nil {
+		w.logger.Warn("failed to write ping", slog.Any("error", err))
+		w.Close(fmt.Errorf("%w: %w", ErrPingMessage, err), nil)
+		return false
+	}
+	w.stats.written(messageSize(conf.PingMessage))
+
+	return true
+}
+
+// write writes a message coming from the Socket or the Conn, it reports whether the writer should keep running.
+func (w *worker) write(payload Message) bool {
+	if payload.Type() == websocket.CloseMessage {
+		w.writeCloseMessage(payload, nil)
+		return false
+	}
+
+	if w.State() != StateOpen {
+		deliver(payload, ErrConnectionClosed)
+		return false
+	}
+	if err := payload.Write(w.conn, w.config().WriteTimeout); err != nil {
+		err = fmt.Errorf("%w: %w", ErrFailedToWrite, err)
+		deliver(payload, err)
+		w.Close(err, nil)
+		return false
+	}
+	w.stats.messageWritten(messageSize(payload))
+	deliver(payload, nil)
+
+	return true
+}
+
+// checkIdle closes the connection if it exceeded an idle timeout, it reports whether the writer should keep running.
+func (w *worker) checkIdle(idle *idleTracker, timer Timer) bool {
+	now := w.clock.Now()
+	wait, direction, isIdle := idle.next(now)
+	if isIdle {
+		handler, ok := socketAs[IdleHandler](w.socket)
+		if !ok {
+			w.writeCloseMessage(idleCloseMessage, fmt.Errorf("%w: %s", ErrIdleTimeoutExceeded, direction))
+			return false
+		}
+
+		extension := handler.OnIdle(direction)
+		if extension <= 0 {
+			w.writeCloseMessage(idleCloseMessage, fmt.Errorf("%w: %s", ErrIdleTimeoutExceeded, direction))
+			return false
+		}
+
+		idle.extend(now, extension)
+		wait, _, _ = idle.next(now)
+	}
+
+	timer.Reset(wait)
+	return true
+}
+
+// writeCloseMessage starts a close handshake initiated by the server, reason is reported alongside its outcome.
+// The reader keeps running until the client acknowledges the close message, or the connection is closed once the grace period is exceeded.
+func (w *worker) writeCloseMessage(msg Message, reason error) {
+	if !w.flushBatch() { // Messages accepted before the close message are written first.
+		deliver(msg, ErrConnectionClosed)
+		return
+	}
+
+	w.closeReason = reason
+	w.closeCode = closeCode(msg)
+	if !w.transition(StateOpen, StateClosingByUs) {
+		deliver(msg, ErrConnectionClosed)
+		return
+	}
+
+	if err := msg.Write(w.conn, w.config().WriteTimeout); err != nil {
+		err = fmt.Errorf("%w: %w", ErrFailedToWrite, err)
+		deliver(msg, err)
+		w.Close(err, nil)
+		return
+	}
+	w.stats.written(messageSize(msg))
+	deliver(msg, nil)
+
+	timer := w.clock.AfterFunc(w.config().GracePeriod, func() {
+		w.Close(w.withCloseReason(ErrCloseHandshakeTimeout), nil)
+	})
+	w.graceMu.Lock()
+	defer w.graceMu.Unlock()
+	w.graceTimer = timer
+	if w.State() == StateClosed { // The handshake completed before the timer was recorded.
+		timer.Stop()
+	}
+}
+
+// handleClose is called by the reader when the client sends a close message.
+func (w *worker) handleClose(code int, text string) error {
+	if handler, ok := socketAs[CloseHandler](w.socket); ok {
+		handler.OnClose(code, text)
+	}
+
+	// The transition is made under the write lock, so that the batch being written goes out before the echo and none after it.
+	locked := w.lockWrites()
+	if locked {
+		defer w.unlockWrites()
+	}
+	if w.transition(StateOpen, StateClosingByPeer) {
+		// Echo the close code of the client to complete the handshake it initiated.
+		if !locked {
+			w.echoErr = os.ErrDeadlineExceeded
+			return nil
+		}
+		w.echoErr = w.writeCloseLocked(code, "")
+	}
+
+	return nil
+}
+
+// writeClose writes a close frame once the batch being written to the network connection, if any, is written.
+// The batches are not written afterward, since data frames must not follow a close frame.
+// Returns os.ErrDeadlineExceeded if the batch is still being written at the deadline of the control frames.
+func (w *worker) writeClose(code int, text string) error {
+	if !w.lockWrites() {
+		return os.ErrDeadlineExceeded
+	}
+	defer w.unlockWrites()
+
+	return w.writeCloseLocked(code, text)
+}
+
+// writeCloseLocked is writeClose with the write lock held.
+func (w *worker) writeCloseLocked(code int, text string) error {
+	w.closeSent = true
+	return w.conn.WriteControl(websocket.CloseMessage, websocket.FormatCloseMessage(code, text), w.config().controlFrameDeadline())
+}
+
+// lockWrites takes the write lock, waiting for the batch being written up to the deadline of the control frames.
+// It reports whether the lock was taken.
+func (w *worker) lockWrites() bool {
+	select {
+	case w.writeLock <- struct{}{}:
+		return true
+	default:
+	}
+
+	timer := time.NewTimer(time.Until(w.config().controlFrameDeadline()))
+	defer timer.Stop()
+	select {
+	case w.writeLock <- struct{}{}:
+		return true
+	case <-timer.C:
+		return false
+	}
+}
+
+func (w *worker) unlockWrites() {
+	<-w.writeLock
+}
+
+// applyReadLimit puts the Config.ReadLimit in effect for the next message read, the websocket.Conn only allows its reader to change it.
+func (w *worker) applyReadLimit() {
+	if limit := w.config().ReadLimit; limit != w.readLimit {
+		w.readLimit = limit
+		w.conn.SetReadLimit(limit)
+	}
+}
+
 func (w *worker) readMessages() {
+	if handler, ok := socketAs[StreamHandler](w.socket); ok {
+		w.readStreams(handler)
+		return
+	}
+	if handler, ok := socketAs[PooledMessageHandler](w.socket); ok {
+		w.readPooled(handler)
+		return
+	}
+
 	for {
+		w.applyReadLimit()
 		_, payload, err := w.conn.ReadMessage()
 		if err != nil {
-			if isConnectionClosedError(err) {
-				w.Close(fmt.Errorf("%w: %w", ErrConnectionClosed, err), nil)
-				return
+			w.handleReadError(err)
+			return
+		}
+		if w.accept(payload) {
+			go w.socket.OnMessage(payload)
+		}
+	}
+}
+
+func (w *worker) readStreams(handler StreamHandler) {
+	for {
+		w.applyReadLimit()
+		messageType, r, err := w.conn.NextReader()
+		if err != nil {
+			w.handleReadError(err)
+			return
+		}
+
+		// The start of the message is buffered, the messages it holds entirely go through accept and the messageFilters like in the other read paths.
+		head := getBuffer()
+		if err := head.readFrom(io.LimitReader(r, streamHeadSize+1)); err != nil { // The next read reports the error.
+			head.Release()
+			continue
+		}
+		filtered := len(head.data) <= streamHeadSize
+		if !filtered && w.claimed(head.data) {
+			// The messageFilters handle whole messages, the rest of the message is buffered as well.
+			whole := getBuffer()
+			err := whole.readFrom(io.MultiReader(bytes.NewReader(head.data), r))
+			head.Release()
+			if err != nil {
+				whole.Release()
+				continue
 			}
-			if isTimeoutExceededError(err) { // At the moment, only pong timeout is supported; Therefore, it is safe to assume that it is a pong timeout.
-				w.Close(fmt.Errorf("%w: %w", ErrPongTimeoutExceeded, err), nil)
-				return
+			head, filtered = whole, true
+		}
+		if filtered {
+			if w.accept(head.data) {
+				filterMessage(w.filters, head.data, func(payload []byte) {
+					handler.OnStream(messageType, bytes.NewReader(payload))
+				})
 			}
+			head.Release()
+			continue
+		}
 
-			clientCloseMessage := clientCloseMessageFromError(err)
-			if clientCloseMessage != nil {
-				w.Close(ErrCloseMessageReceived, clientCloseMessage)
-				return
-			}
+		// Larger messages that no filter claims are streamed, they are too large to be heartbeat replies and are counted once consumed.
+		reader := &countingReader{r: r}
+		if w.State() == StateOpen { // Messages received while closing are discarded.
+			handler.OnStream(messageType, io.MultiReader(bytes.NewReader(head.data), reader))
+		}
+		_, _ = io.Copy(io.Discard, reader)
+		w.stats.messageRead(len(head.data) + reader.n)
+		head.Release()
+	}
+}
 
-			w.Close(fmt.Errorf("%w: %w", ErrFailedToRead, err), clientCloseMessage)
+// claimed reports whether one of the claims picks the streamed message starting with head.
+func (w *worker) claimed(head []byte) bool {
+	for _, claims := range w.claims {
+		if claims(head) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// accept reports whether a message read from the connection is handed over to the Socket, after counting it in the Stats.
+// Heartbeat replies are recorded as such and not handed over, and the messages received while closing are discarded.
+// Every read path calls it, the streamed messages too large to be heartbeat replies aside.
+func (w *worker) accept(payload []byte) bool {
+	if w.isHeartbeatReply(payload) {
+		return false
+	}
+	w.stats.messageRead(len(payload))
+
+	return w.State() == StateOpen
+}
+
+func (w *worker) handleReadError(err error) {
+	clientCloseMessage := clientCloseMessageFromError(err)
+
+	switch w.State() {
+	case StateClosingByUs:
+		if clientCloseMessage != nil {
+			w.Close(w.withCloseReason(ErrCloseMessageSent), clientCloseMessage)
+			return
+		}
+		w.Close(w.withCloseReason(fmt.Errorf("%w: %w", ErrCloseHandshakeFailed, err)), nil)
+	case StateClosingByPeer:
+		if w.echoErr != nil {
+			w.Close(fmt.Errorf("%w: %w", ErrCloseHandshakeFailed, w.echoErr), clientCloseMessage)
 			return
 		}
 
-		if w.closeMessageSent.Load() {
-			continue
+		w.Close(ErrCloseMessageReceived, clientCloseMessage)
+	default:
+		if isConnectionClosedError(err) {
+			w.Close(fmt.Errorf("%w: %w", ErrConnectionClosed, err), nil)
+			return
 		}
+		w.Close(fmt.Errorf("%w: %w", ErrFailedToRead, err), nil)
+	}
+}
 
-		go w.socket.OnMessage(payload)
+// withCloseReason prefixes the outcome of a close handshake initiated by the server with the reason it was initiated for.
+func (w *worker) withCloseReason(err error) error {
+	if w.closeReason == nil {
+		return err
 	}
+
+	return fmt.Errorf("%w: %w", w.closeReason, err)
 }
 
 func (w *worker) Close(cause error, clientCloseMessage *ClientCloseMessage) {
-	if w.closed.Load() {
+	prev := State(w.state.Swap(int32(StateClosed)))
+	if prev == StateClosed {
 		return
 	}
-	w.closed.Store(true)
-	if w.closeMessageSent.Load() {
-		cause = fmt.Errorf("%w: %w", ErrCloseMessageSent, cause)
+	w.notifyStateChange(prev, StateClosed)
+	w.graceMu.Lock()
+	if w.graceTimer != nil {
+		w.graceTimer.Stop()
+	}
+	w.graceMu.Unlock()
+
+	var code int
+	switch prev {
+	case StateOpen:
+		code = w.writeCloseFrame(cause)
+	case StateClosingByUs:
+		code = w.closeCode
+	}
+	w.logClose(cause, clientCloseMessage, code)
+
+	if handler, ok := socketAs[ErrorHandler](w.socket); ok && !IsCleanClose(cause) {
+		handler.OnError(cause)
 	}
 
 	w.socket.OnDisconnect(clientCloseMessage)
 
+	if w.release != nil {
+		w.release()
+	}
 	if err := w.conn.Close(); err != nil {
 		cause = fmt.Errorf("%w: %w", err, cause)
 	}
 
-	w.closeCh <- cause
+	w.err = cause
+	close(w.done)
+}
+
+// writeCloseFrame attempts to tell the client why the connection is being torn down, it returns the code it sent if any.
+// Failures are ignored since the connection is closed right after.
+func (w *worker) writeCloseFrame(cause error) int {
+	if errors.Is(cause, ErrConnectionClosed) {
+		return 0
+	}
+
+	frame, ok := w.config().closeFrameFor(cause)
+	if !ok {
+		return 0
+	}
+
+	_ = w.writeClose(frame.Code, frame.Text)
+	return frame.Code
 }
@@ -0,0 +1,217 @@
+package websocket_manager
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+type pooledTestSocket struct {
+	*testSocket
+}
+
+func (s pooledTestSocket) OnPooledMessage(buf *Buffer) {
+	s.messages <- bytes.Clone(buf.Bytes())
+	buf.Release()
+}
+
+type streamTestSocket struct {
+	*testSocket
+}
+
+func (s streamTestSocket) OnStream(_ int, r io.Reader) {
+	payload, _ := io.ReadAll(r)
+	s.messages <- payload
+}
+
+// Every read path counts the messages and filters out the heartbeat replies.
+func TestReadPaths(t *testing.T) {
+	large := bytes.Repeat([]byte("l"), 3*maxHeartbeatReplySize)
+	tests := []struct {
+		name   string
+		socket func(*testSocket) Socket
+	}{
+		{"OnMessage", func(s *testSocket) Socket { return s }},
+		{"OnPooledMessage", func(s *testSocket) Socket { return pooledTestSocket{s} }},
+		{"OnStream", func(s *testSocket) Socket { return streamTestSocket{s} }},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			inner := newTestSocket()
+			conf := &Config{
+				GracePeriod: time.Second,
+				Heartbeat:   &Heartbeat{Message: TextMessage("ping"), Reply: []byte("pong"), Frequency: time.Hour, Timeout: 2 * time.Hour},
+			}
+			conn, client := startTest(t, conf, tc.socket(inner))
+
+			for _, payload := range [][]byte{[]byte("pong"), []byte("data"), large} {
+				if err := client.WriteMessage(websocket.BinaryMessage, payload); err != nil {
+					t.Fatalf("write: %v", err)
+				}
+			}
+			// The pooled messages are handed over in goroutines of their own, in any order.
+			got := map[int]bool{}
+			for range 2 {
+				payload := receive(t, inner.messages)
+				if !bytes.Equal(payload, []byte("data")) && !bytes.Equal(payload, large) {
+					t.Fatalf("unexpected message of %d bytes", len(payload))
+				}
+				got[len(payload)] = true
+			}
+			if len(got) != 2 {
+				t.Fatal("a message was handed over twice")
+			}
+
+			// The heartbeat reply is counted as a frame read, it is not handed over.
+			want := uint64(len("pong") + len("data") + len(large))
+			for deadline := time.Now().Add(testTimeout); conn.Stats().BytesRead < want; time.Sleep(time.Millisecond) {
+				if time.Now().After(deadline) {
+					t.Fatal("the messages were not counted")
+				}
+			}
+			if stats := conn.Stats(); stats.FramesRead != 3 || stats.BytesRead != want {
+				t.Fatalf("read %d frames of %d bytes, want 3 of %d", stats.FramesRead, stats.BytesRead, want)
+			}
+		})
+	}
+}
+
+// The timeouts of the worker are driven by the Config.Clock, a FakeClock fires them without waiting.
+func TestTimeouts(t *testing.T) {
+	testTimeouts(t, startTest)
+}
+
+// testTimeouts checks the timeouts of the connections started by start, e.g. startTest.
+func testTimeouts(t *testing.T, start func(testing.TB, *Config, Socket) (*Conn, *websocket.Conn)) {
+	tests := []struct {
+		name string
+		conf *Config
+		// timers is how many timers and tickers the worker starts, ack whether the client acknowledges the close message.
+		timers  int
+		advance time.Duration
+		ack     bool
+		wantErr error
+		// wantCode is the code of the close message the client reads, if it reads.
+		wantCode int
+	}{
+		{
+			name:    "pong timeout",
+			conf:    &Config{PingMessage: PingMessage(nil), PingFrequency: time.Minute, PongTimeout: 90 * time.Second},
+			timers:  2,
+			advance: 90 * time.Second,
+			wantErr: ErrPongTimeoutExceeded,
+		},
+		{
+			name:     "idle",
+			conf:     &Config{IdleTimeout: time.Minute},
+			timers:   1,
+			advance:  time.Minute,
+			ack:      true,
+			wantErr:  ErrIdleTimeoutExceeded,
+			wantCode: websocket.CloseGoingAway,
+		},
+		{
+			name:     "inbound idle",
+			conf:     &Config{InboundIdleTimeout: time.Minute, OutboundIdleTimeout: time.Hour},
+			timers:   1,
+			advance:  time.Minute,
+			ack:      true,
+			wantErr:  ErrIdleTimeoutExceeded,
+			wantCode: websocket.CloseGoingAway,
+		},
+		{
+			name:     "max lifetime",
+			conf:     &Config{MaxLifetime: time.Hour},
+			timers:   1,
+			advance:  time.Hour,
+			ack:      true,
+			wantErr:  ErrMaxLifetimeExceeded,
+			wantCode: websocket.CloseServiceRestart,
+		},
+		{
+			name:     "max lifetime with a custom close message",
+			conf:     &Config{MaxLifetime: time.Hour, MaxLifetimeCloseMessage: CloseMessage(4000, "bye")},
+			timers:   1,
+			advance:  time.Hour,
+			ack:      true,
+			wantErr:  ErrMaxLifetimeExceeded,
+			wantCode: 4000,
+		},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			clock := NewFakeClock(time.Unix(1000, 0))
+			conf := tc.conf
+			conf.Clock, conf.GracePeriod, conf.WriteTimeout = clock, time.Minute, time.Second
+			conn, client := start(t, conf, newTestSocket())
+
+			var read <-chan error
+			if tc.ack {
+				read = readAll(client)
+			}
+			clock.BlockUntil(tc.timers)
+			clock.Advance(tc.advance - time.Nanosecond)
+			select {
+			case <-conn.Done():
+				t.Fatalf("closed before the timeout: %v", conn.Err())
+			case <-time.After(20 * time.Millisecond):
+			}
+			clock.Advance(time.Nanosecond)
+
+			err := waitClosed(t, conn)
+			if !errors.Is(err, tc.wantErr) {
+				t.Fatalf("Err() = %v, want %v", err, tc.wantErr)
+			}
+			if IsCleanClose(err) != tc.ack {
+				t.Fatalf("IsCleanClose(%v) = %t, want %t", err, !tc.ack, tc.ack)
+			}
+			if tc.ack {
+				if readErr := receive(t, read); !websocket.IsCloseError(readErr, tc.wantCode) {
+					t.Fatalf("the client read %v, want a close message with code %d", readErr, tc.wantCode)
+				}
+			}
+		})
+	}
+}
+
+// pongTestSocket reports the pongs of the client.
+type pongTestSocket struct {
+	*testSocket
+	pongs chan []byte
+}
+
+func (s pongTestSocket) OnPong(payload []byte) {
+	s.pongs <- payload
+}
+
+// The pongs of the client keep pushing the pong timeout back.
+func TestPongsKeepConnectionOpen(t *testing.T) {
+	clock := NewFakeClock(time.Unix(1000, 0))
+	socket := pongTestSocket{testSocket: newTestSocket(), pongs: make(chan []byte, 1)}
+	conn, client := startTest(t, &Config{
+		Clock:         clock,
+		GracePeriod:   time.Minute,
+		PingMessage:   PingMessage([]byte("ping")),
+		PingFrequency: time.Minute,
+		PongTimeout:   90 * time.Second,
+	}, socket)
+	_ = readAll(client)
+
+	clock.BlockUntil(2)
+	for range 5 {
+		clock.Advance(time.Minute)
+		if got := receive(t, socket.pongs); string(got) != "ping" {
+			t.Fatalf("OnPong(%q), want ping", got)
+		}
+	}
+	if conn.State() != StateOpen {
+		t.Fatalf("State() = %s with pongs read every minute, want open: %v", conn.State(), conn.Err())
+	}
+	if stats := conn.Stats(); !stats.LastActivity.Equal(clock.Now()) {
+		t.Fatalf("LastActivity = %v, want the time of the last pong %v", stats.LastActivity, clock.Now())
+	}
+}